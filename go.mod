@@ -1,3 +1,3 @@
 module swp-spec-kit
 
-go 1.22
+go 1.24
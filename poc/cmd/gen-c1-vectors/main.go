@@ -291,6 +291,38 @@ func e1Spec(id string) fixtureSpec {
 		outcome, code, rejectReason = "reject", "INVALID_FRAME", "truncated bytes field"
 		body, _ := core.EncodeEnvelopeE1(env)
 		framed = frameFromBody(body[:len(body)-1])
+	case "e1_0009_non_minimal_uvarint_strict_invalid", "e1_0010_non_minimal_uvarint_lenient_accepted":
+		if id == "e1_0009_non_minimal_uvarint_strict_invalid" {
+			outcome, code, rejectReason = "reject", "INVALID_FRAME", "uvarint is not minimally encoded"
+			assertions["strict"] = true
+		}
+		body, _ := core.EncodeEnvelopeE1(baseEnv(1, 1, []byte{}))
+		// profile_id 1 padded to two octets
+		padded := append([]byte{body[0], 0x81, 0x00}, body[2:]...)
+		framed = frameFromBody(padded)
+	case "e1_0011_duplicate_extension_type_strict_invalid":
+		outcome, code, rejectReason = "reject", "INVALID_ENVELOPE", "duplicate extension type"
+		assertions["strict"] = true
+		env = baseEnv(1, 1, []byte{})
+		env.Extensions = []core.Extension{{Type: 16, Value: []byte("a")}, {Type: 16, Value: []byte("b")}}
+		framed = frameFromEnv(env)
+	case "e1_0012_non_ascending_extension_types_strict_invalid":
+		outcome, code, rejectReason = "reject", "INVALID_ENVELOPE", "extension types not ascending"
+		assertions["strict"] = true
+		env = baseEnv(1, 1, []byte{})
+		env.Extensions = []core.Extension{{Type: 17, Value: []byte("a")}, {Type: 16, Value: []byte("b")}}
+		framed = frameFromEnv(env)
+	case "e1_0013_extension_value_too_large_strict_invalid":
+		outcome, code, rejectReason = "reject", "INVALID_ENVELOPE", "extension value exceeds MAX_EXT_VALUE_BYTES"
+		assertions["strict"] = true
+		env = baseEnv(1, 1, []byte{})
+		env.Extensions = []core.Extension{{Type: 4097, Value: make([]byte, 1100)}}
+		framed = frameFromEnv(env)
+	case "e1_0014_canonical_extensions_strict_valid":
+		assertions["strict"] = true
+		env = baseEnv(1, 1, []byte{})
+		env.Extensions = []core.Extension{{Type: 16, Value: []byte("a")}, {Type: 4097, Value: []byte("b")}}
+		framed = frameFromEnv(env)
 	default:
 		panic(fmt.Errorf("unknown e1 vector: %s", id))
 	}
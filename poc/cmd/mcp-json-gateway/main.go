@@ -1,18 +1,18 @@
 package main
 
 import (
-	"crypto/rand"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"net/http"
 	"sync"
 	"time"
 
-	"swp-spec-kit/poc/internal/core"
+	"swp-spec-kit/poc/pkg/swpclient"
 )
 
 const profileMCPMap = 1
@@ -35,7 +35,7 @@ func main() {
 type handler struct {
 	swpAddr string
 	mu      sync.Mutex
-	conn    net.Conn
+	client  *swpclient.Client
 }
 
 func (h *handler) handleMCP(w http.ResponseWriter, r *http.Request) {
@@ -55,23 +55,19 @@ func (h *handler) handleMCP(w http.ResponseWriter, r *http.Request) {
 		msgType = 3
 	}
 
-	msgID, err := newMsgID(16)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	env := core.Envelope{
-		Version:   core.CoreVersion,
+	env := swpclient.Envelope{
 		ProfileID: profileMCPMap,
 		MsgType:   msgType,
-		MsgID:     msgID,
-		TsUnixMs:  uint64(time.Now().UnixMilli()),
 		Payload:   payload,
 	}
 
-	respPayload, err := h.send(env, msgType != 3)
+	respPayload, err := h.send(r.Context(), env, msgType != 3)
 	if err != nil {
+		var rerr *swpclient.RemoteError
+		if errors.As(err, &rerr) {
+			writeRemoteError(w, payload, rerr)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadGateway)
 		return
 	}
@@ -86,51 +82,36 @@ func (h *handler) handleMCP(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(respPayload)
 }
 
-func (h *handler) send(env core.Envelope, wantResponse bool) ([]byte, error) {
-	body, err := core.EncodeEnvelopeE1(env)
-	if err != nil {
-		return nil, fmt.Errorf("encode envelope: %w", err)
-	}
-
-	h.mu.Lock()
-	defer h.mu.Unlock()
+func (h *handler) send(ctx context.Context, env swpclient.Envelope, wantResponse bool) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
 
 	var lastErr error
 	for attempt := 0; attempt < 2; attempt++ {
-		conn, err := h.ensureConnLocked()
+		c, err := h.ensureClient(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("dial swp: %w", err)
 		}
 
-		if err := conn.SetWriteDeadline(time.Now().Add(5 * time.Second)); err != nil {
-			lastErr = fmt.Errorf("set write deadline: %w", err)
-			h.resetConnLocked()
-			continue
-		}
-		if err := core.WriteFrame(conn, body, core.DefaultLimits().MaxFrameBytes); err != nil {
-			lastErr = fmt.Errorf("write frame: %w", err)
-			h.resetConnLocked()
-			continue
-		}
 		if !wantResponse {
+			if err := c.Send(ctx, env); err != nil {
+				lastErr = fmt.Errorf("send: %w", err)
+				if !retryable(c, err) {
+					break
+				}
+				h.resetClient(c)
+				continue
+			}
 			return nil, nil
 		}
 
-		if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
-			lastErr = fmt.Errorf("set read deadline: %w", err)
-			h.resetConnLocked()
-			continue
-		}
-		respFrame, err := core.ReadFrame(conn, core.DefaultLimits().MaxFrameBytes)
-		if err != nil {
-			lastErr = fmt.Errorf("read frame: %w", err)
-			h.resetConnLocked()
-			continue
-		}
-		resp, err := core.DecodeEnvelopeE1(respFrame, core.DefaultLimits())
+		resp, err := c.Call(ctx, env)
 		if err != nil {
-			lastErr = fmt.Errorf("decode response: %w", err)
-			h.resetConnLocked()
+			lastErr = fmt.Errorf("call: %w", err)
+			if ctx.Err() != nil || !retryable(c, err) {
+				break
+			}
+			h.resetClient(c)
 			continue
 		}
 		return resp.Payload, nil
@@ -141,29 +122,77 @@ func (h *handler) send(env core.Envelope, wantResponse bool) ([]byte, error) {
 	return nil, lastErr
 }
 
-func (h *handler) ensureConnLocked() (net.Conn, error) {
-	if h.conn != nil {
-		return h.conn, nil
+// retryable reports whether err left c's connection unusable, so the
+// request may be sent again on a new one. A non-fatal error the server
+// returned answers the request and leaves c serving other requests, and
+// local errors would only repeat.
+func retryable(c *swpclient.Client, err error) bool {
+	var rerr *swpclient.RemoteError
+	if errors.As(err, &rerr) {
+		return rerr.Fatal
+	}
+	select {
+	case <-c.Done():
+		return true
+	default:
+		return false
 	}
-	conn, err := net.Dial("tcp", h.swpAddr)
+}
+
+func (h *handler) ensureClient(ctx context.Context) (*swpclient.Client, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.client != nil {
+		select {
+		case <-h.client.Done():
+			h.client = nil
+		default:
+			return h.client, nil
+		}
+	}
+	c, err := swpclient.Dial(ctx, "tcp", h.swpAddr)
 	if err != nil {
 		return nil, err
 	}
-	h.conn = conn
-	return h.conn, nil
+	h.client = c
+	return h.client, nil
 }
 
-func (h *handler) resetConnLocked() {
-	if h.conn != nil {
-		_ = h.conn.Close()
-		h.conn = nil
+func (h *handler) resetClient(c *swpclient.Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.client == c {
+		_ = h.client.Close()
+		h.client = nil
 	}
 }
 
 func (h *handler) close() {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.resetConnLocked()
+	if h.client != nil {
+		_ = h.client.Close()
+		h.client = nil
+	}
+}
+
+func writeRemoteError(w http.ResponseWriter, payload []byte, rerr *swpclient.RemoteError) {
+	var req struct {
+		ID any `json:"id"`
+	}
+	_ = json.Unmarshal(payload, &req)
+	body, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      req.ID,
+		"error": map[string]any{
+			"code":    -32603,
+			"message": rerr.Message,
+			"data":    map[string]any{"swp_code": rerr.Code},
+		},
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadGateway)
+	_, _ = w.Write(body)
 }
 
 func isNotification(payload []byte) bool {
@@ -174,11 +203,3 @@ func isNotification(payload []byte) bool {
 	_, hasID := msg["id"]
 	return !hasID
 }
-
-func newMsgID(n int) ([]byte, error) {
-	b := make([]byte, n)
-	if _, err := rand.Read(b); err != nil {
-		return nil, err
-	}
-	return b, nil
-}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -22,6 +24,7 @@ import (
 	"swp-spec-kit/poc/internal/p1obs"
 	"swp-spec-kit/poc/internal/p1state"
 	"swp-spec-kit/poc/internal/p1tooldisc"
+	"swp-spec-kit/poc/internal/server"
 )
 
 type fixtureRef struct {
@@ -105,23 +108,22 @@ var defaultGlobs = []string{
 	"conformance/vectors/relay_*.json",
 }
 
-var knownProfiles = map[uint64]struct{}{
-	1: {}, 2: {}, 10: {}, 11: {}, 12: {}, 13: {}, 14: {}, 15: {}, 16: {}, 17: {}, 18: {}, 19: {},
-}
+// knownProfiles and supportedMsgType are derived from the reference
+// server's router so the runner and runtime share one profile registry.
+var knownProfiles, supportedMsgType = profileRegistry()
 
-var supportedMsgType = map[string]map[uint64]struct{}{
-	"mcp":        set(1, 2, 3),
-	"a2a":        set(1, 2, 3, 4),
-	"agdisc":     set(1, 2, 3, 4),
-	"tooldisc":   set(1, 2, 3, 4, 5),
-	"rpc":        set(1, 2, 3, 4, 5),
-	"events":     set(1, 2, 3, 4, 5),
-	"artifact":   set(1, 2, 3, 4, 5),
-	"cred":       set(1, 2, 3, 4),
-	"policyhint": set(1, 2, 3, 4),
-	"state":      set(1, 2, 3, 4),
-	"obs":        set(1, 2, 3, 4),
-	"relay":      set(1, 2, 3, 4, 5),
+func profileRegistry() (map[uint64]struct{}, map[string]map[uint64]struct{}) {
+	known := make(map[uint64]struct{})
+	msgTypes := make(map[string]map[uint64]struct{})
+	for _, r := range server.New(log.New(io.Discard, "", 0)).Routes() {
+		known[r.ProfileID] = struct{}{}
+		name := server.ProfileName(r.ProfileID)
+		if msgTypes[name] == nil {
+			msgTypes[name] = make(map[uint64]struct{})
+		}
+		msgTypes[name][r.MsgType] = struct{}{}
+	}
+	return known, msgTypes
 }
 
 func main() {
@@ -445,6 +447,9 @@ func applyAssertionsPolicy(v *core.Validator, assertions map[string]interface{},
 	if assertions == nil {
 		return
 	}
+	if b, ok := asBool(assertions["strict"]); ok && b {
+		v.Limits.StrictE1 = true
+	}
 	if limits, ok := assertions["limits"].(map[string]interface{}); ok {
 		if n, ok := asUint32(limits["max_payload_bytes"]); ok {
 			v.Limits.MaxPayloadBytes = n
@@ -747,14 +752,6 @@ func detectGitSHA() string {
 	return sha
 }
 
-func set(values ...uint64) map[uint64]struct{} {
-	m := make(map[uint64]struct{}, len(values))
-	for _, v := range values {
-		m[v] = struct{}{}
-	}
-	return m
-}
-
 func asUint32(v interface{}) (uint32, bool) {
 	n, ok := asUint64(v)
 	if !ok {
@@ -1,16 +1,18 @@
 package main
 
 import (
-	"crypto/rand"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
-	"net"
+	"os"
+	"os/exec"
+	"strings"
 	"time"
 
-	"swp-spec-kit/poc/internal/core"
 	"swp-spec-kit/poc/internal/p1rpc"
+	"swp-spec-kit/poc/pkg/swpclient"
 )
 
 const (
@@ -20,29 +22,47 @@ const (
 
 func main() {
 	addr := flag.String("addr", "127.0.0.1:7777", "server TCP address")
+	rawURL := flag.String("url", "", "connect over the HTTP/2 binding (http, https) or the WebSocket binding (ws, wss) instead, e.g. http://127.0.0.1:7778/swp")
+	unixPath := flag.String("unix", "", "connect to this Unix socket instead")
+	command := flag.String("exec", "", "run this command and speak SWP on its stdin/stdout instead, e.g. \"swp-server -stdio\"")
 	flag.Parse()
 
-	conn, err := net.Dial("tcp", *addr)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var c *swpclient.Client
+	var err error
+	switch {
+	case *command != "":
+		args := strings.Fields(*command)
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stderr = os.Stderr
+		c, err = swpclient.DialCommand(ctx, cmd)
+	case *unixPath != "":
+		c, err = swpclient.Dial(ctx, "unix", *unixPath)
+	case strings.HasPrefix(*rawURL, "ws://"), strings.HasPrefix(*rawURL, "wss://"):
+		c, err = swpclient.DialWebSocket(ctx, *rawURL, nil)
+	case *rawURL != "":
+		c, err = swpclient.DialHTTP2(ctx, *rawURL, nil)
+	default:
+		c, err = swpclient.Dial(ctx, "tcp", *addr)
+	}
 	if err != nil {
 		log.Fatalf("dial: %v", err)
 	}
-	defer conn.Close()
+	defer c.Close()
 
-	if err := demoMCP(conn); err != nil {
+	if err := demoMCP(ctx, c); err != nil {
 		log.Fatalf("mcp demo failed: %v", err)
 	}
-	if err := demoSWPRPCStream(conn); err != nil {
+	if err := demoSWPRPCStream(ctx, c); err != nil {
 		log.Fatalf("swp-rpc stream demo failed: %v", err)
 	}
 
 	log.Println("demo complete")
 }
 
-func demoMCP(conn net.Conn) error {
-	msgID, err := newMsgID(16)
-	if err != nil {
-		return err
-	}
+func demoMCP(ctx context.Context, c *swpclient.Client) error {
 	payload := map[string]any{
 		"jsonrpc": "2.0",
 		"id":      "req-tools-list",
@@ -51,19 +71,11 @@ func demoMCP(conn net.Conn) error {
 	}
 	p, _ := json.Marshal(payload)
 
-	req := core.Envelope{
-		Version:   core.CoreVersion,
+	resp, err := c.Call(ctx, swpclient.Envelope{
 		ProfileID: profileMCPMap,
 		MsgType:   1,
-		MsgID:     msgID,
-		TsUnixMs:  uint64(time.Now().UnixMilli()),
 		Payload:   p,
-	}
-	if err := writeEnvelope(conn, req); err != nil {
-		return err
-	}
-
-	resp, err := readEnvelope(conn)
+	})
 	if err != nil {
 		return err
 	}
@@ -78,11 +90,7 @@ func demoMCP(conn net.Conn) error {
 	return nil
 }
 
-func demoSWPRPCStream(conn net.Conn) error {
-	msgID, err := newMsgID(16)
-	if err != nil {
-		return err
-	}
+func demoSWPRPCStream(ctx context.Context, c *swpclient.Client) error {
 	params, _ := json.Marshal(map[string]any{"count": 3})
 	p, err := p1rpc.EncodePayloadReq(p1rpc.RpcReq{
 		RPCID:  []byte("rpc-stream-1"),
@@ -93,29 +101,24 @@ func demoSWPRPCStream(conn net.Conn) error {
 		return fmt.Errorf("encode rpc req payload: %w", err)
 	}
 
-	req := core.Envelope{
-		Version:   core.CoreVersion,
+	st, err := c.Stream(ctx, swpclient.Envelope{
 		ProfileID: profileSWPRPC,
 		MsgType:   1,
-		MsgID:     msgID,
-		TsUnixMs:  uint64(time.Now().UnixMilli()),
 		Payload:   p,
-	}
-	if err := writeEnvelope(conn, req); err != nil {
+	})
+	if err != nil {
 		return err
 	}
+	defer st.Close()
 
 	for {
-		resp, err := readEnvelope(conn)
+		resp, err := st.Recv(ctx)
 		if err != nil {
 			return err
 		}
 		if resp.ProfileID != profileSWPRPC {
 			continue
 		}
-		if string(resp.MsgID) != string(msgID) {
-			continue
-		}
 
 		switch resp.MsgType {
 		case 4:
@@ -142,30 +145,3 @@ func demoSWPRPCStream(conn net.Conn) error {
 		}
 	}
 }
-
-func writeEnvelope(conn net.Conn, env core.Envelope) error {
-	body, err := core.EncodeEnvelopeE1(env)
-	if err != nil {
-		return err
-	}
-	return core.WriteFrame(conn, body, core.DefaultLimits().MaxFrameBytes)
-}
-
-func readEnvelope(conn net.Conn) (core.Envelope, error) {
-	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
-		return core.Envelope{}, err
-	}
-	frame, err := core.ReadFrame(conn, core.DefaultLimits().MaxFrameBytes)
-	if err != nil {
-		return core.Envelope{}, err
-	}
-	return core.DecodeEnvelopeE1(frame, core.DefaultLimits())
-}
-
-func newMsgID(n int) ([]byte, error) {
-	b := make([]byte, n)
-	if _, err := rand.Read(b); err != nil {
-		return nil, err
-	}
-	return b, nil
-}
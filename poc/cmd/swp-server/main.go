@@ -2,31 +2,302 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"net"
+	"os"
 	"os/signal"
+	"reflect"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"swp-spec-kit/poc/internal/pipeconn"
 	"swp-spec-kit/poc/internal/server"
 )
 
+// uint32Value is a flag.Value for uint32 config fields.
+type uint32Value uint32
+
+func (v *uint32Value) String() string { return strconv.FormatUint(uint64(*v), 10) }
+
+func (v *uint32Value) Set(s string) error {
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return err
+	}
+	*v = uint32Value(n)
+	return nil
+}
+
+// listValue is a flag.Value for comma-separated string list config fields.
+type listValue []string
+
+func (v *listValue) String() string { return strings.Join(*v, ",") }
+
+func (v *listValue) Set(s string) error {
+	*v = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+	return nil
+}
+
+// bindFlags registers a flag for each command-line Config field on fs,
+// writing into c.
+func bindFlags(fs *flag.FlagSet, c *server.Config) {
+	fs.StringVar(&c.Listen, "listen", c.Listen, "TCP listen address; plaintext is only served on loopback")
+	fs.StringVar(&c.HTTP2Listen, "http2-listen", c.HTTP2Listen, "also serve the HTTP/2 binding on this address (h2c without TLS)")
+	fs.StringVar(&c.WebSocketListen, "ws-listen", c.WebSocketListen, "also serve the WebSocket binding on this address (ws without TLS, wss with it)")
+	fs.StringVar(&c.Unix.Listen, "unix-listen", c.Unix.Listen, "also serve on this Unix socket path; its permissions stand in for TLS")
+	fs.StringVar(&c.Unix.Mode, "unix-mode", c.Unix.Mode, "Unix socket permissions in octal; must not grant other users access")
+	fs.BoolVar(&c.Stdio, "stdio", c.Stdio, "serve one connection on stdin/stdout instead of listening; logs go to stderr")
+	fs.Var((*listValue)(&c.WebSocketOrigins), "ws-origins", "comma-separated browser origins allowed to open WebSocket connections, or * (default same host only)")
+	fs.StringVar(&c.TLS.Cert, "tls-cert", c.TLS.Cert, "server certificate PEM file (enables TLS)")
+	fs.StringVar(&c.TLS.Key, "tls-key", c.TLS.Key, "server private key PEM file")
+	fs.StringVar(&c.TLS.ClientCA, "tls-client-ca", c.TLS.ClientCA, "CA bundle PEM file for verifying client certificates (mTLS)")
+	fs.StringVar(&c.TLS.ClientAuth, "tls-client-auth", c.TLS.ClientAuth, "client certificate policy: none, request, require, verify-if-given, require-and-verify (default require-and-verify with -tls-client-ca, else none)")
+	fs.BoolVar(&c.InsecurePlaintext, "insecure-plaintext", c.InsecurePlaintext, "serve plaintext on non-loopback addresses (only behind an external secure channel)")
+	fs.DurationVar((*time.Duration)(&c.ShutdownTimeout), "shutdown-timeout", time.Duration(c.ShutdownTimeout), "how long SIGINT/SIGTERM waits for in-flight requests before closing connections")
+
+	fs.Var((*uint32Value)(&c.Limits.MaxFrameBytes), "max-frame-bytes", "largest frame accepted or sent")
+	fs.Var((*uint32Value)(&c.Limits.MaxPayloadBytes), "max-payload-bytes", "largest envelope payload accepted")
+	fs.BoolVar(&c.Limits.StrictE1, "strict-e1", c.Limits.StrictE1, "reject non-canonical E1 encodings")
+	fs.BoolVar(&c.HelloRequired, "hello-required", c.HelloRequired, "require a core HELLO as the first envelope")
+	fs.IntVar(&c.MaxConcurrentDispatch, "max-concurrent-dispatch", c.MaxConcurrentDispatch, "envelopes dispatched at once per connection")
+	fs.IntVar(&c.ResponseCompressionMinBytes, "response-compression", c.ResponseCompressionMinBytes, "smallest response payload compressed for peers sharing a codec (0 disables)")
+	fs.IntVar(&c.PushQueue.Size, "push-queue", c.PushQueue.Size, "per-connection server push queue size")
+	fs.Var((*listValue)(&c.Profiles.Enabled), "profiles", "comma-separated profiles to serve, by name or profile_id (default all)")
+	fs.StringVar(&c.PushQueue.SlowConsumer, "slow-consumer", c.PushQueue.SlowConsumer, "full push queue policy: disconnect, drop or block")
+
+	fs.DurationVar((*time.Duration)(&c.Timeouts.Idle), "idle-timeout", time.Duration(c.Timeouts.Idle), "close connections with no frame and no request in flight for this long (0 disables)")
+	fs.DurationVar((*time.Duration)(&c.Timeouts.FrameRead), "frame-read-timeout", time.Duration(c.Timeouts.FrameRead), "time allowed to receive a whole frame once its first byte arrives (0 disables)")
+	fs.DurationVar((*time.Duration)(&c.Timeouts.Write), "write-timeout", time.Duration(c.Timeouts.Write), "time allowed for each response write (0 disables)")
+	fs.DurationVar((*time.Duration)(&c.Timeouts.MaxLifetime), "max-conn-lifetime", time.Duration(c.Timeouts.MaxLifetime), "send GOAWAY and drain connections older than this (0 disables)")
+	fs.DurationVar((*time.Duration)(&c.Timeouts.Handler), "handler-timeout", time.Duration(c.Timeouts.Handler), "deadline for each handler; a handler still running then is answered with ERR_INTERNAL_ERROR (0 disables)")
+	fs.IntVar(&c.MaxConns, "max-conns", c.MaxConns, "maximum concurrent connections (0 = unlimited)")
+	fs.Float64Var(&c.RateLimits.Conn, "conn-rate", c.RateLimits.Conn, "envelopes per second per connection, burst one second (0 disables)")
+	fs.Float64Var(&c.RateLimits.IP, "ip-rate", c.RateLimits.IP, "envelopes per second per remote IP, burst one second (0 disables)")
+	fs.Float64Var(&c.RateLimits.Identity, "identity-rate", c.RateLimits.Identity, "envelopes per second per TLS peer identity, burst one second (0 disables)")
+	fs.Float64Var(&c.RateLimits.Profile, "profile-rate", c.RateLimits.Profile, "envelopes per second per profile across all connections, burst one second (0 disables)")
+
+	fs.DurationVar((*time.Duration)(&c.Replay.Window), "replay-window", time.Duration(c.Replay.Window), "how long a msg_id is remembered to reject duplicates")
+	fs.StringVar(&c.Replay.Scope, "replay-scope", c.Replay.Scope, "duplicate msg_id namespace: conn, server or identity")
+	fs.DurationVar((*time.Duration)(&c.MaxClockSkew), "max-clock-skew", time.Duration(c.MaxClockSkew), "reject envelopes whose timestamp is further than this from the server clock; timestamped envelopes are then remembered for replay as long as they are accepted (0 disables)")
+}
+
+// loadConfig reads path (if any) over the defaults, then applies the flags
+// given on the command line, so flags always win over the file.
+func loadConfig(path string, set map[string]string) (server.Config, error) {
+	c := server.DefaultConfig()
+	if path != "" {
+		var err error
+		if c, err = server.LoadConfig(path); err != nil {
+			return server.Config{}, err
+		}
+	}
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	bindFlags(fs, &c)
+	for name, value := range set {
+		if fs.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return server.Config{}, fmt.Errorf("-%s: %w", name, err)
+		}
+	}
+	return c, c.Validate()
+}
+
+// needsRestart reports whether a and b differ outside the fields Reload
+// applies.
+func needsRestart(a, b server.Config) bool {
+	for _, c := range []*server.Config{&a, &b} {
+		c.Timeouts = server.TimeoutsConfig{}
+		c.MaxConns = 0
+		c.RateLimits = server.RateLimitsConfig{}
+	}
+	return !reflect.DeepEqual(a, b)
+}
+
+func tlsConfigFor(c server.Config) (*tls.Config, error) {
+	if c.TLS.Cert == "" {
+		return nil, nil
+	}
+	policy := c.TLS.ClientAuth
+	if policy == "" {
+		policy = "none"
+		if c.TLS.ClientCA != "" {
+			policy = "require-and-verify"
+		}
+	}
+	clientAuth, err := server.ParseClientAuth(policy)
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+	return server.NewTLSConfig(c.TLS.Cert, c.TLS.Key, c.TLS.ClientCA, clientAuth)
+}
+
+// listenHTTP opens a plain TCP listener for an HTTP binding, which adds TLS
+// itself. Without TLS it is refused on non-loopback addresses unless
+// insecure plaintext is allowed.
+func listenHTTP(c server.Config, addr string, tlsConfig *tls.Config) (net.Listener, error) {
+	if c.InsecurePlaintext || tlsConfig != nil {
+		return net.Listen("tcp", addr)
+	}
+	return server.Listen(addr, nil)
+}
+
+// serveStdio serves a single connection on stdin/stdout, as a subprocess of
+// the client, and returns when the client closes stdin or ctx is done.
+func serveStdio(ctx context.Context, stop context.CancelFunc, cfg server.Config) {
+	s := server.New(log.Default(), cfg.Options()...)
+	go func() {
+		<-ctx.Done()
+		stop()
+		sctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+		defer cancel()
+		if err := s.Shutdown(sctx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}()
+	log.Printf("swp-server serving one connection on stdin/stdout")
+	s.ServeConn(context.Background(), pipeconn.Stdio())
+}
+
 func main() {
-	listen := flag.String("listen", ":7777", "TCP listen address")
+	configPath := flag.String("config", "", "JSON configuration file; flags given on the command line override it")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration as JSON and exit")
+	defaults := server.DefaultConfig()
+	bindFlags(flag.CommandLine, &defaults)
 	flag.Parse()
+	set := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = f.Value.String() })
+
+	cfg, err := loadConfig(*configPath, set)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *printConfig {
+		out, err := json.MarshalIndent(cfg, "", "  ")
+		if err != nil {
+			log.Fatalf("print config: %v", err)
+		}
+		fmt.Println(string(out))
+		return
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	ln, err := net.Listen("tcp", *listen)
+	if cfg.Stdio {
+		serveStdio(ctx, stop, cfg)
+		return
+	}
+
+	tlsConfig, err := tlsConfigFor(cfg)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	var ln net.Listener
+	if cfg.InsecurePlaintext && tlsConfig == nil {
+		log.Printf("WARNING: serving plaintext SWP on %s; S1 must be provided outside this process", cfg.Listen)
+		ln, err = net.Listen("tcp", cfg.Listen)
+	} else {
+		ln, err = server.Listen(cfg.Listen, tlsConfig)
+	}
 	if err != nil {
 		log.Fatalf("listen: %v", err)
 	}
 	defer ln.Close()
 
-	log.Printf("swp-server listening on %s", *listen)
-	s := server.New(log.Default())
-	if err := s.Serve(ctx, ln); err != nil {
+	log.Printf("swp-server listening on %s (tls=%t)", cfg.Listen, tlsConfig != nil)
+	s := server.New(log.Default(), cfg.Options()...)
+
+	if cfg.HTTP2Listen != "" {
+		hln, err := listenHTTP(cfg, cfg.HTTP2Listen, tlsConfig)
+		if err != nil {
+			log.Fatalf("listen http2: %v", err)
+		}
+		defer hln.Close()
+		log.Printf("swp-server serving HTTP/2 on %s (tls=%t)", cfg.HTTP2Listen, tlsConfig != nil)
+		go func() {
+			if err := s.ServeHTTP2(context.Background(), hln, tlsConfig); err != nil {
+				log.Printf("serve http2: %v", err)
+			}
+		}()
+	}
+	if cfg.WebSocketListen != "" {
+		wln, err := listenHTTP(cfg, cfg.WebSocketListen, tlsConfig)
+		if err != nil {
+			log.Fatalf("listen websocket: %v", err)
+		}
+		defer wln.Close()
+		log.Printf("swp-server serving WebSocket on %s (tls=%t)", cfg.WebSocketListen, tlsConfig != nil)
+		go func() {
+			if err := s.ServeWebSocket(context.Background(), wln, tlsConfig); err != nil {
+				log.Printf("serve websocket: %v", err)
+			}
+		}()
+	}
+
+	if cfg.Unix.Listen != "" {
+		mode, _ := server.ParseUnixSocketMode(cfg.Unix.Mode)
+		uln, err := server.ListenUnix(cfg.Unix.Listen, mode)
+		if err != nil {
+			log.Fatalf("listen unix: %v", err)
+		}
+		defer uln.Close()
+		log.Printf("swp-server listening on unix %s (mode %#o)", cfg.Unix.Listen, mode)
+		go func() {
+			if err := s.Serve(context.Background(), uln); err != nil {
+				log.Printf("serve unix: %v", err)
+			}
+		}()
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for range hup {
+			next, err := loadConfig(*configPath, set)
+			if err == nil {
+				err = s.Reload(next)
+			}
+			if err != nil {
+				log.Printf("reload: %v; keeping current configuration", err)
+				continue
+			}
+			if needsRestart(cfg, next) {
+				log.Printf("reload: applied timeouts, max_conns and rate_limits; other changes need a restart")
+			} else {
+				log.Printf("reload: applied timeouts, max_conns and rate_limits")
+			}
+		}
+	}()
+
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		stop()
+		timeout := time.Duration(cfg.ShutdownTimeout)
+		log.Printf("shutting down, draining connections for up to %s", timeout)
+		sctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		shutdown <- s.Shutdown(sctx)
+	}()
+	// Connections must outlive the signal so Shutdown can drain them.
+	if err := s.Serve(context.Background(), ln); err != nil {
 		log.Fatalf("serve: %v", err)
 	}
+	if err := <-shutdown; err != nil {
+		log.Printf("shutdown: %v", err)
+	}
 }
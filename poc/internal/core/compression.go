@@ -0,0 +1,167 @@
+package core
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// FlagPayloadCompressed marks a payload encoded with the codec carried in
+// ExtPayloadCodec.
+const FlagPayloadCompressed uint64 = 1 << 0
+
+type Codec uint64
+
+const (
+	CodecIdentity Codec = 0
+	CodecGzip     Codec = 1
+	CodecDeflate  Codec = 2
+)
+
+func (c Codec) String() string {
+	switch c {
+	case CodecIdentity:
+		return "identity"
+	case CodecGzip:
+		return "gzip"
+	case CodecDeflate:
+		return "deflate"
+	default:
+		return fmt.Sprintf("codec(%d)", uint64(c))
+	}
+}
+
+// SupportedCodecs lists the payload codecs this implementation decodes, in
+// preference order.
+func SupportedCodecs() []Codec {
+	return []Codec{CodecGzip, CodecDeflate}
+}
+
+// NegotiateCodec returns the first codec in offered (the peer's preference
+// order) that is also in supported.
+func NegotiateCodec(offered, supported []Codec) (Codec, bool) {
+	for _, o := range offered {
+		for _, s := range supported {
+			if o == s && o != CodecIdentity {
+				return o, true
+			}
+		}
+	}
+	return CodecIdentity, false
+}
+
+// AcceptedCodecs decodes the ExtAcceptCodecs extension of env. It returns
+// nil if the extension is absent.
+func AcceptedCodecs(env Envelope) ([]Codec, error) {
+	raw, ok := extensionValue(env.Extensions, ExtAcceptCodecs)
+	if !ok {
+		return nil, nil
+	}
+	c := e1Cursor{b: raw}
+	var out []Codec
+	for c.remaining() > 0 {
+		v, err := c.uvarint()
+		if err != nil {
+			return nil, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode accept codecs: %w", err))
+		}
+		out = append(out, Codec(v))
+	}
+	return out, nil
+}
+
+// WithAcceptedCodecs returns env advertising codecs in ExtAcceptCodecs,
+// replacing any previous advertisement.
+func WithAcceptedCodecs(env Envelope, codecs []Codec) Envelope {
+	var raw []byte
+	for _, c := range codecs {
+		raw = binary.AppendUvarint(raw, uint64(c))
+	}
+	env.Extensions = withExtension(env.Extensions, ExtAcceptCodecs, raw)
+	return env
+}
+
+// CompressPayload returns env with its payload encoded using codec. The
+// envelope is returned unchanged when codec is CodecIdentity, the payload is
+// shorter than minBytes, it is already compressed, or compression would not
+// make it smaller.
+func CompressPayload(env Envelope, codec Codec, minBytes int) (Envelope, error) {
+	if codec == CodecIdentity || len(env.Payload) < minBytes || env.Flags&FlagPayloadCompressed != 0 {
+		return env, nil
+	}
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch codec {
+	case CodecGzip:
+		w = gzip.NewWriter(&buf)
+	case CodecDeflate:
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return env, Wrap(CodeInternalError, err)
+		}
+		w = fw
+	default:
+		return env, Wrap(CodeInvalidEnvelope, fmt.Errorf("unsupported payload codec %s", codec))
+	}
+	if _, err := w.Write(env.Payload); err != nil {
+		return env, Wrap(CodeInternalError, fmt.Errorf("compress payload: %w", err))
+	}
+	if err := w.Close(); err != nil {
+		return env, Wrap(CodeInternalError, fmt.Errorf("compress payload: %w", err))
+	}
+	if buf.Len() >= len(env.Payload) {
+		return env, nil
+	}
+
+	env.Payload = buf.Bytes()
+	env.Flags |= FlagPayloadCompressed
+	return SetExtension(env, ExtPayloadCodec, binary.AppendUvarint(nil, uint64(codec))), nil
+}
+
+// DecompressPayload reverses CompressPayload. Envelopes without
+// FlagPayloadCompressed are returned unchanged. Decoded output is capped at
+// maxPayload bytes so a small frame cannot expand without bound.
+func DecompressPayload(env Envelope, maxPayload uint32) (Envelope, error) {
+	if env.Flags&FlagPayloadCompressed == 0 {
+		return env, nil
+	}
+	raw, ok := extensionValue(env.Extensions, ExtPayloadCodec)
+	if !ok {
+		return env, Wrap(CodeInvalidEnvelope, fmt.Errorf("compressed payload without codec extension"))
+	}
+	v, n := binary.Uvarint(raw)
+	if n <= 0 || n != len(raw) {
+		return env, Wrap(CodeInvalidEnvelope, fmt.Errorf("malformed payload codec extension"))
+	}
+	codec := Codec(v)
+
+	var r io.ReadCloser
+	switch codec {
+	case CodecGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(env.Payload))
+		if err != nil {
+			return env, Wrap(CodeInvalidEnvelope, fmt.Errorf("decompress payload: %w", err))
+		}
+		r = gr
+	case CodecDeflate:
+		r = flate.NewReader(bytes.NewReader(env.Payload))
+	default:
+		return env, Wrap(CodeInvalidEnvelope, fmt.Errorf("unsupported payload codec %s", codec))
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, int64(maxPayload)+1))
+	if err != nil {
+		return env, Wrap(CodeInvalidEnvelope, fmt.Errorf("decompress payload: %w", err))
+	}
+	if uint64(len(out)) > uint64(maxPayload) {
+		return env, Wrap(CodeInvalidEnvelope, fmt.Errorf("decompressed payload exceeds max %d", maxPayload))
+	}
+
+	env.Payload = out
+	env.Flags &^= FlagPayloadCompressed
+	return RemoveExtension(env, ExtPayloadCodec), nil
+}
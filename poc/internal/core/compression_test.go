@@ -0,0 +1,94 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressPayloadRoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte(`{"jsonrpc":"2.0","method":"tools/list"}`), 64)
+	for _, codec := range SupportedCodecs() {
+		env := Envelope{Version: CoreVersion, ProfileID: 1, MsgType: 1, MsgID: []byte("abcdef1234567890"), Payload: payload}
+		compressed, err := CompressPayload(env, codec, 1)
+		if err != nil {
+			t.Fatalf("%s: compress failed: %v", codec, err)
+		}
+		if compressed.Flags&FlagPayloadCompressed == 0 || len(compressed.Payload) >= len(payload) {
+			t.Fatalf("%s: expected compressed payload, flags=%d len=%d", codec, compressed.Flags, len(compressed.Payload))
+		}
+		if len(env.Extensions) != 0 {
+			t.Fatalf("%s: original extensions modified", codec)
+		}
+
+		body, err := EncodeEnvelopeE1(compressed)
+		if err != nil {
+			t.Fatalf("%s: encode failed: %v", codec, err)
+		}
+		decoded, err := DecodeEnvelopeE1(body, DefaultLimits())
+		if err != nil {
+			t.Fatalf("%s: decode failed: %v", codec, err)
+		}
+		plain, err := DecompressPayload(decoded, DefaultLimits().MaxPayloadBytes)
+		if err != nil {
+			t.Fatalf("%s: decompress failed: %v", codec, err)
+		}
+		if !bytes.Equal(plain.Payload, payload) || plain.Flags != 0 || len(plain.Extensions) != 0 {
+			t.Fatalf("%s: round trip mismatch: flags=%d ext=%v", codec, plain.Flags, plain.Extensions)
+		}
+	}
+}
+
+func TestCompressPayloadSkipsSmallPayload(t *testing.T) {
+	env := Envelope{Payload: []byte("tiny")}
+	out, err := CompressPayload(env, CodecGzip, 1024)
+	if err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	if out.Flags != 0 || string(out.Payload) != "tiny" {
+		t.Fatalf("expected payload left uncompressed")
+	}
+}
+
+func TestDecompressPayloadEnforcesLimit(t *testing.T) {
+	env := Envelope{Payload: make([]byte, 1<<20)}
+	bomb, err := CompressPayload(env, CodecDeflate, 1)
+	if err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	if _, err := DecompressPayload(bomb, 4096); CodeFromError(err) != CodeInvalidEnvelope {
+		t.Fatalf("expected INVALID_ENVELOPE for oversized output, got %v", err)
+	}
+}
+
+func TestDecompressPayloadRejectsUnknownCodec(t *testing.T) {
+	env := Envelope{
+		Flags:      FlagPayloadCompressed,
+		Extensions: []Extension{{Type: ExtPayloadCodec, Value: []byte{9}}},
+		Payload:    []byte("x"),
+	}
+	if _, err := DecompressPayload(env, 1024); CodeFromError(err) != CodeInvalidEnvelope {
+		t.Fatalf("expected INVALID_ENVELOPE, got %v", err)
+	}
+	env.Extensions = nil
+	if _, err := DecompressPayload(env, 1024); CodeFromError(err) != CodeInvalidEnvelope {
+		t.Fatalf("expected INVALID_ENVELOPE without codec extension, got %v", err)
+	}
+}
+
+func TestNegotiateCodec(t *testing.T) {
+	env := WithAcceptedCodecs(Envelope{}, []Codec{Codec(7), CodecDeflate, CodecGzip})
+	offered, err := AcceptedCodecs(env)
+	if err != nil {
+		t.Fatalf("AcceptedCodecs failed: %v", err)
+	}
+	codec, ok := NegotiateCodec(offered, SupportedCodecs())
+	if !ok || codec != CodecDeflate {
+		t.Fatalf("expected deflate (peer preference), got %s ok=%v", codec, ok)
+	}
+	if _, ok := NegotiateCodec([]Codec{Codec(7)}, SupportedCodecs()); ok {
+		t.Fatalf("expected no shared codec")
+	}
+	if got, _ := AcceptedCodecs(Envelope{}); got != nil {
+		t.Fatalf("expected nil without extension, got %v", got)
+	}
+}
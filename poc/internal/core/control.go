@@ -0,0 +1,133 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ProfileCore is the reserved profile_id 0, used for core-level control
+// envelopes rather than by any profile handler.
+const (
+	ProfileCore uint64 = 0
+
+	CoreMsgTypeError  uint64 = 1
+	CoreMsgTypeHello  uint64 = 2
+	CoreMsgTypeGoaway uint64 = 3
+)
+
+const coreErrorFlagFatal = 1
+
+// ErrorFrame is the payload of a core error envelope. Code carries a
+// canonical ERR_* value and MsgID the offending msg_id, when known.
+type ErrorFrame struct {
+	Code    string
+	MsgID   []byte
+	Message string
+	Fatal   bool
+}
+
+func EncodeErrorPayload(f ErrorFrame) []byte {
+	var out []byte
+	out = appendBytes(out, []byte(f.Code))
+	out = appendBytes(out, f.MsgID)
+	out = appendBytes(out, []byte(f.Message))
+	var flags uint64
+	if f.Fatal {
+		flags |= coreErrorFlagFatal
+	}
+	return binary.AppendUvarint(out, flags)
+}
+
+func DecodeErrorPayload(payload []byte) (ErrorFrame, error) {
+	c := e1Cursor{b: payload}
+	code, err := c.bytes()
+	if err != nil {
+		return ErrorFrame{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode error code: %w", err))
+	}
+	msgID, err := c.bytes()
+	if err != nil {
+		return ErrorFrame{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode error msg_id: %w", err))
+	}
+	msg, err := c.bytes()
+	if err != nil {
+		return ErrorFrame{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode error message: %w", err))
+	}
+	flags, err := c.uvarint()
+	if err != nil {
+		return ErrorFrame{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode error flags: %w", err))
+	}
+	if c.remaining() != 0 {
+		return ErrorFrame{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("trailing bytes: %d", c.remaining()))
+	}
+	if len(code) == 0 {
+		return ErrorFrame{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("error code required"))
+	}
+	return ErrorFrame{
+		Code:    string(code),
+		MsgID:   append([]byte(nil), msgID...),
+		Message: string(msg),
+		Fatal:   flags&coreErrorFlagFatal != 0,
+	}, nil
+}
+
+// NewErrorEnvelope builds a core error envelope. msgID becomes the envelope
+// msg_id so that peers correlating by msg_id receive the error in place of
+// the response they were waiting for.
+func NewErrorEnvelope(msgID []byte, ts uint64, f ErrorFrame) Envelope {
+	return Envelope{
+		Version:   CoreVersion,
+		ProfileID: ProfileCore,
+		MsgType:   CoreMsgTypeError,
+		TsUnixMs:  ts,
+		MsgID:     append([]byte(nil), msgID...),
+		Payload:   EncodeErrorPayload(f),
+	}
+}
+
+func IsErrorEnvelope(env Envelope) bool {
+	return env.ProfileID == ProfileCore && env.MsgType == CoreMsgTypeError
+}
+
+// Goaway is the payload of a core GOAWAY notice: the sender accepts no new
+// requests on the connection, finishes those in flight within DrainMs
+// milliseconds (0 when unbounded), then closes.
+type Goaway struct {
+	Reason  string
+	DrainMs uint64
+}
+
+func EncodeGoawayPayload(g Goaway) []byte {
+	out := appendBytes(nil, []byte(g.Reason))
+	return binary.AppendUvarint(out, g.DrainMs)
+}
+
+func DecodeGoawayPayload(payload []byte) (Goaway, error) {
+	c := e1Cursor{b: payload}
+	reason, err := c.bytes()
+	if err != nil {
+		return Goaway{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode goaway reason: %w", err))
+	}
+	drain, err := c.uvarint()
+	if err != nil {
+		return Goaway{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode goaway drain_ms: %w", err))
+	}
+	if c.remaining() != 0 {
+		return Goaway{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("trailing bytes: %d", c.remaining()))
+	}
+	return Goaway{Reason: string(reason), DrainMs: drain}, nil
+}
+
+func NewGoawayEnvelope(msgID []byte, ts uint64, g Goaway) Envelope {
+	return Envelope{
+		Version:   CoreVersion,
+		ProfileID: ProfileCore,
+		MsgType:   CoreMsgTypeGoaway,
+		TsUnixMs:  ts,
+		MsgID:     append([]byte(nil), msgID...),
+		Payload:   EncodeGoawayPayload(g),
+	}
+}
+
+func IsGoawayEnvelope(env Envelope) bool {
+	return env.ProfileID == ProfileCore && env.MsgType == CoreMsgTypeGoaway
+}
@@ -0,0 +1,57 @@
+package core
+
+import "testing"
+
+func TestErrorEnvelopeRoundTrip(t *testing.T) {
+	in := ErrorFrame{
+		Code:    "ERR_UNKNOWN_PROFILE",
+		MsgID:   []byte("12345678abcdefgh"),
+		Message: "unknown profile_id 99",
+		Fatal:   true,
+	}
+	env := NewErrorEnvelope(in.MsgID, 1, in)
+	if !IsErrorEnvelope(env) {
+		t.Fatalf("expected core error envelope, got profile=%d msg_type=%d", env.ProfileID, env.MsgType)
+	}
+
+	body, err := EncodeEnvelopeE1(env)
+	if err != nil {
+		t.Fatalf("EncodeEnvelopeE1 failed: %v", err)
+	}
+	decoded, err := DecodeEnvelopeE1(body, DefaultLimits())
+	if err != nil {
+		t.Fatalf("DecodeEnvelopeE1 failed: %v", err)
+	}
+	out, err := DecodeErrorPayload(decoded.Payload)
+	if err != nil {
+		t.Fatalf("DecodeErrorPayload failed: %v", err)
+	}
+	if out.Code != in.Code || string(out.MsgID) != string(in.MsgID) || out.Message != in.Message || out.Fatal != in.Fatal {
+		t.Fatalf("error frame mismatch: got %+v want %+v", out, in)
+	}
+}
+
+func TestDecodeErrorPayloadRequiresCode(t *testing.T) {
+	_, err := DecodeErrorPayload(EncodeErrorPayload(ErrorFrame{Message: "no code"}))
+	if CodeFromError(err) != CodeInvalidEnvelope {
+		t.Fatalf("expected INVALID_ENVELOPE, got %v", err)
+	}
+}
+
+func TestGoawayEnvelopeRoundTrip(t *testing.T) {
+	in := Goaway{Reason: "server shutting down", DrainMs: 5000}
+	env := NewGoawayEnvelope([]byte("12345678abcdefgh"), 1, in)
+	if !IsGoawayEnvelope(env) || IsErrorEnvelope(env) {
+		t.Fatalf("expected core goaway envelope, got profile=%d msg_type=%d", env.ProfileID, env.MsgType)
+	}
+	out, err := DecodeGoawayPayload(env.Payload)
+	if err != nil {
+		t.Fatalf("DecodeGoawayPayload failed: %v", err)
+	}
+	if out != in {
+		t.Fatalf("goaway mismatch: got %+v want %+v", out, in)
+	}
+	if _, err := DecodeGoawayPayload(append(env.Payload, 0)); CodeFromError(err) != CodeInvalidEnvelope {
+		t.Fatalf("expected INVALID_ENVELOPE for trailing bytes, got %v", err)
+	}
+}
@@ -1,73 +1,106 @@
 package core
 
 import (
-	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math/bits"
+)
+
+var (
+	errUvarintOverflow     = errors.New("uvarint overflows 64 bits")
+	errUvarintNonCanonical = errors.New("uvarint is not minimally encoded")
 )
 
 func EncodeEnvelopeE1(env Envelope) ([]byte, error) {
-	var out []byte
-	out = binary.AppendUvarint(out, env.Version)
-	out = binary.AppendUvarint(out, env.ProfileID)
-	out = binary.AppendUvarint(out, env.MsgType)
-	out = binary.AppendUvarint(out, env.Flags)
-	out = binary.AppendUvarint(out, env.TsUnixMs)
+	return AppendEnvelopeE1(make([]byte, 0, EncodedLenE1(env)), env)
+}
 
-	out = appendBytes(out, env.MsgID)
+// AppendEnvelopeE1 appends the E1 encoding of env to dst. It does not
+// allocate when dst has EncodedLenE1(env) spare capacity.
+func AppendEnvelopeE1(dst []byte, env Envelope) ([]byte, error) {
+	dst = binary.AppendUvarint(dst, env.Version)
+	dst = binary.AppendUvarint(dst, env.ProfileID)
+	dst = binary.AppendUvarint(dst, env.MsgType)
+	dst = binary.AppendUvarint(dst, env.Flags)
+	dst = binary.AppendUvarint(dst, env.TsUnixMs)
 
-	extBytes, err := encodeExtensions(env.Extensions)
-	if err != nil {
-		return nil, Wrap(CodeInvalidEnvelope, err)
-	}
-	out = appendBytes(out, extBytes)
+	dst = appendBytes(dst, env.MsgID)
 
-	out = appendBytes(out, env.Payload)
-	return out, nil
+	dst = binary.AppendUvarint(dst, uint64(extensionsLen(env.Extensions)))
+	dst = appendExtensions(dst, env.Extensions)
+
+	dst = appendBytes(dst, env.Payload)
+	return dst, nil
 }
 
+// EncodedLenE1 returns the exact length of the E1 encoding of env.
+func EncodedLenE1(env Envelope) int {
+	n := uvarintLen(env.Version) + uvarintLen(env.ProfileID) + uvarintLen(env.MsgType) +
+		uvarintLen(env.Flags) + uvarintLen(env.TsUnixMs)
+	n += bytesLen(len(env.MsgID))
+	n += bytesLen(extensionsLen(env.Extensions))
+	n += bytesLen(len(env.Payload))
+	return n
+}
+
+// DecodeEnvelopeE1 decodes body into an Envelope that owns its byte slices;
+// body may be reused once it returns.
 func DecodeEnvelopeE1(body []byte, limits Limits) (Envelope, error) {
-	r := bytes.NewReader(body)
+	return DecodeEnvelopeE1Aliased(append([]byte(nil), body...), limits)
+}
 
-	version, err := readUvarint(r)
+// DecodeEnvelopeE1Aliased decodes body without copying: MsgID, extension
+// values and Payload alias body, so body must not be modified or reused
+// while the Envelope is in use. Aliased slices are capacity-limited, so
+// appending to them never writes into body.
+func DecodeEnvelopeE1Aliased(body []byte, limits Limits) (Envelope, error) {
+	c := e1Cursor{b: body, strict: limits.StrictE1}
+
+	version, err := c.uvarint()
 	if err != nil {
 		return Envelope{}, Wrap(CodeInvalidFrame, fmt.Errorf("decode version: %w", err))
 	}
-	profileID, err := readUvarint(r)
+	profileID, err := c.uvarint()
 	if err != nil {
 		return Envelope{}, Wrap(CodeInvalidFrame, fmt.Errorf("decode profile_id: %w", err))
 	}
-	msgType, err := readUvarint(r)
+	msgType, err := c.uvarint()
 	if err != nil {
 		return Envelope{}, Wrap(CodeInvalidFrame, fmt.Errorf("decode msg_type: %w", err))
 	}
-	flags, err := readUvarint(r)
+	flags, err := c.uvarint()
 	if err != nil {
 		return Envelope{}, Wrap(CodeInvalidFrame, fmt.Errorf("decode flags: %w", err))
 	}
-	ts, err := readUvarint(r)
+	ts, err := c.uvarint()
 	if err != nil {
 		return Envelope{}, Wrap(CodeInvalidFrame, fmt.Errorf("decode ts_unix_ms: %w", err))
 	}
 
-	msgID, err := readBytes(r)
+	msgID, err := c.bytes()
 	if err != nil {
 		return Envelope{}, Wrap(CodeInvalidFrame, fmt.Errorf("decode msg_id: %w", err))
 	}
-	extRaw, err := readBytes(r)
+	extRaw, err := c.bytes()
 	if err != nil {
 		return Envelope{}, Wrap(CodeInvalidFrame, fmt.Errorf("decode extensions: %w", err))
 	}
 	if len(extRaw) > limits.MaxExtBytes {
 		return Envelope{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("extensions length %d exceeds max %d", len(extRaw), limits.MaxExtBytes))
 	}
-	ext, err := decodeExtensions(extRaw)
+	ext, err := decodeExtensions(extRaw, limits.StrictE1)
 	if err != nil {
 		return Envelope{}, Wrap(CodeInvalidFrame, fmt.Errorf("decode extension TLV: %w", err))
 	}
+	if limits.StrictE1 {
+		if err := checkCanonicalExtensions(ext, limits); err != nil {
+			return Envelope{}, err
+		}
+	}
 
-	payload, err := readBytes(r)
+	payload, err := c.bytes()
 	if err != nil {
 		return Envelope{}, Wrap(CodeInvalidFrame, fmt.Errorf("decode payload: %w", err))
 	}
@@ -75,8 +108,8 @@ func DecodeEnvelopeE1(body []byte, limits Limits) (Envelope, error) {
 		return Envelope{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("payload length %d exceeds max %d", len(payload), limits.MaxPayloadBytes))
 	}
 
-	if r.Len() != 0 {
-		return Envelope{}, Wrap(CodeInvalidFrame, fmt.Errorf("trailing bytes: %d", r.Len()))
+	if c.remaining() != 0 {
+		return Envelope{}, Wrap(CodeInvalidFrame, fmt.Errorf("trailing bytes: %d", c.remaining()))
 	}
 
 	return Envelope{
@@ -96,47 +129,86 @@ func appendBytes(dst, v []byte) []byte {
 	return append(dst, v...)
 }
 
-func readUvarint(r io.ByteReader) (uint64, error) {
-	v, err := binary.ReadUvarint(r)
-	if err != nil {
-		return 0, err
+func uvarintLen(v uint64) int {
+	if v == 0 {
+		return 1
+	}
+	return (bits.Len64(v) + 6) / 7
+}
+
+func bytesLen(n int) int {
+	return uvarintLen(uint64(n)) + n
+}
+
+// e1Cursor reads E1 primitives from a byte slice without copying. A strict
+// cursor rejects uvarints that are not minimally encoded.
+type e1Cursor struct {
+	b      []byte
+	off    int
+	strict bool
+}
+
+func (c *e1Cursor) remaining() int {
+	return len(c.b) - c.off
+}
+
+func (c *e1Cursor) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(c.b[c.off:])
+	if n == 0 {
+		if c.remaining() == 0 {
+			return 0, io.EOF
+		}
+		return 0, io.ErrUnexpectedEOF
 	}
+	if n < 0 {
+		return 0, errUvarintOverflow
+	}
+	if c.strict && n > 1 && c.b[c.off+n-1] == 0 {
+		return 0, errUvarintNonCanonical
+	}
+	c.off += n
 	return v, nil
 }
 
-func readBytes(r *bytes.Reader) ([]byte, error) {
-	n, err := readUvarint(r)
+func (c *e1Cursor) bytes() ([]byte, error) {
+	n, err := c.uvarint()
 	if err != nil {
 		return nil, err
 	}
-	if n > uint64(r.Len()) {
+	if n > uint64(c.remaining()) {
 		return nil, io.ErrUnexpectedEOF
 	}
-	out := make([]byte, int(n))
-	if _, err := io.ReadFull(r, out); err != nil {
-		return nil, err
-	}
+	end := c.off + int(n)
+	out := c.b[c.off:end:end]
+	c.off = end
 	return out, nil
 }
 
-func encodeExtensions(ext []Extension) ([]byte, error) {
-	var out []byte
+func extensionsLen(ext []Extension) int {
+	n := 0
 	for _, e := range ext {
-		out = binary.AppendUvarint(out, e.Type)
-		out = appendBytes(out, e.Value)
+		n += uvarintLen(e.Type) + bytesLen(len(e.Value))
 	}
-	return out, nil
+	return n
 }
 
-func decodeExtensions(raw []byte) ([]Extension, error) {
-	r := bytes.NewReader(raw)
+func appendExtensions(dst []byte, ext []Extension) []byte {
+	for _, e := range ext {
+		dst = binary.AppendUvarint(dst, e.Type)
+		dst = appendBytes(dst, e.Value)
+	}
+	return dst
+}
+
+func decodeExtensions(raw []byte, strict bool) ([]Extension, error) {
+	c := e1Cursor{b: raw, strict: strict}
 	ext := make([]Extension, 0)
-	for r.Len() > 0 {
-		t, err := readUvarint(r)
+	for c.remaining() > 0 {
+		t, err := c.uvarint()
 		if err != nil {
 			return nil, err
 		}
-		v, err := readBytes(r)
+		v, err := c.bytes()
 		if err != nil {
 			return nil, err
 		}
@@ -144,3 +216,24 @@ func decodeExtensions(raw []byte) ([]Extension, error) {
 	}
 	return ext, nil
 }
+
+// checkCanonicalExtensions enforces the strict E1 extension rules: types
+// strictly ascending (hence unique) and each value within
+// MaxExtValueBytes.
+func checkCanonicalExtensions(ext []Extension, limits Limits) error {
+	for i, e := range ext {
+		if i > 0 {
+			prev := ext[i-1].Type
+			if e.Type == prev {
+				return Wrap(CodeInvalidEnvelope, fmt.Errorf("duplicate extension type %d", e.Type))
+			}
+			if e.Type < prev {
+				return Wrap(CodeInvalidEnvelope, fmt.Errorf("extension type %d follows %d", e.Type, prev))
+			}
+		}
+		if limits.MaxExtValueBytes > 0 && len(e.Value) > limits.MaxExtValueBytes {
+			return Wrap(CodeInvalidEnvelope, fmt.Errorf("extension %d length %d exceeds max %d", e.Type, len(e.Value), limits.MaxExtValueBytes))
+		}
+	}
+	return nil
+}
@@ -39,3 +39,166 @@ func TestE1RoundTrip(t *testing.T) {
 		t.Fatalf("extensions mismatch: %+v", out.Extensions)
 	}
 }
+
+func benchEnvelope() Envelope {
+	return Envelope{
+		Version:   CoreVersion,
+		ProfileID: 12,
+		MsgType:   1,
+		TsUnixMs:  1700000000000,
+		MsgID:     []byte("12345678abcdefgh"),
+		Extensions: []Extension{
+			{Type: 16, Value: []byte("trace")},
+		},
+		Payload: make([]byte, 1024),
+	}
+}
+
+func TestEncodedLenE1MatchesEncoding(t *testing.T) {
+	env := benchEnvelope()
+	body, err := EncodeEnvelopeE1(env)
+	if err != nil {
+		t.Fatalf("EncodeEnvelopeE1 failed: %v", err)
+	}
+	if got := EncodedLenE1(env); got != len(body) {
+		t.Fatalf("EncodedLenE1=%d, encoded length=%d", got, len(body))
+	}
+}
+
+func TestAppendEnvelopeE1DoesNotAllocate(t *testing.T) {
+	env := benchEnvelope()
+	buf := make([]byte, 0, EncodedLenE1(env))
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = AppendEnvelopeE1(buf[:0], env)
+	})
+	if allocs != 0 {
+		t.Fatalf("expected 0 allocations, got %v", allocs)
+	}
+}
+
+func TestDecodeEnvelopeE1AliasedSharesBody(t *testing.T) {
+	body, err := EncodeEnvelopeE1(benchEnvelope())
+	if err != nil {
+		t.Fatalf("EncodeEnvelopeE1 failed: %v", err)
+	}
+	env, err := DecodeEnvelopeE1Aliased(body, DefaultLimits())
+	if err != nil {
+		t.Fatalf("DecodeEnvelopeE1Aliased failed: %v", err)
+	}
+	if &env.Payload[0] != &body[len(body)-len(env.Payload)] {
+		t.Fatalf("expected payload to alias frame body")
+	}
+	if cap(env.MsgID) != len(env.MsgID) {
+		t.Fatalf("expected capacity-limited msg_id, cap=%d len=%d", cap(env.MsgID), len(env.MsgID))
+	}
+
+	owned, err := DecodeEnvelopeE1(body, DefaultLimits())
+	if err != nil {
+		t.Fatalf("DecodeEnvelopeE1 failed: %v", err)
+	}
+	body[len(body)-1] ^= 0xff
+	if owned.Payload[len(owned.Payload)-1] == body[len(body)-1] {
+		t.Fatalf("expected DecodeEnvelopeE1 to copy out of body")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = DecodeEnvelopeE1Aliased(body, DefaultLimits())
+	})
+	if allocs > 1 {
+		t.Fatalf("expected at most 1 allocation (extension slice), got %v", allocs)
+	}
+}
+
+func TestDecodeEnvelopeE1Strict(t *testing.T) {
+	strict := DefaultLimits()
+	strict.StrictE1 = true
+
+	canonical := benchEnvelope()
+	canonical.Extensions = []Extension{{Type: 4, Value: []byte{1}}, {Type: 16, Value: []byte("x")}}
+	body, err := EncodeEnvelopeE1(canonical)
+	if err != nil {
+		t.Fatalf("EncodeEnvelopeE1 failed: %v", err)
+	}
+	if _, err := DecodeEnvelopeE1(body, strict); err != nil {
+		t.Fatalf("canonical envelope rejected: %v", err)
+	}
+
+	// profile_id 12 encoded in two octets
+	padded := append([]byte{0x01, 0x8c, 0x00}, body[2:]...)
+	if _, err := DecodeEnvelopeE1(padded, DefaultLimits()); err != nil {
+		t.Fatalf("lenient decode rejected non-minimal uvarint: %v", err)
+	}
+	if _, err := DecodeEnvelopeE1(padded, strict); CodeFromError(err) != CodeInvalidFrame {
+		t.Fatalf("expected INVALID_FRAME for non-minimal uvarint, got %v", err)
+	}
+
+	cases := map[string][]Extension{
+		"duplicate":     {{Type: 16, Value: []byte("a")}, {Type: 16, Value: []byte("b")}},
+		"non-ascending": {{Type: 16, Value: []byte("a")}, {Type: 4, Value: []byte{1}}},
+		"too large":     {{Type: 4097, Value: make([]byte, strict.MaxExtValueBytes+1)}},
+	}
+	for name, ext := range cases {
+		env := benchEnvelope()
+		env.Extensions = ext
+		body, err := EncodeEnvelopeE1(env)
+		if err != nil {
+			t.Fatalf("%s: EncodeEnvelopeE1 failed: %v", name, err)
+		}
+		if _, err := DecodeEnvelopeE1(body, DefaultLimits()); err != nil {
+			t.Fatalf("%s: lenient decode failed: %v", name, err)
+		}
+		if _, err := DecodeEnvelopeE1(body, strict); CodeFromError(err) != CodeInvalidEnvelope {
+			t.Fatalf("%s: expected INVALID_ENVELOPE, got %v", name, err)
+		}
+	}
+}
+
+func TestSetExtensionKeepsCanonicalOrder(t *testing.T) {
+	env := benchEnvelope()
+	env.Extensions = nil
+	env = SetExtension(env, 16, []byte("x"))
+	env = SetExtension(env, ExtDeadline, []byte{1})
+	env = SetExtension(env, ExtPayloadCodec, []byte{1})
+
+	v := DefaultValidator()
+	v.EnforceKnownProfile = false
+	v.Limits.StrictE1 = true
+	if err := v.ValidateEnvelope(env); err != nil {
+		t.Fatalf("ValidateEnvelope failed: %v (%+v)", err, env.Extensions)
+	}
+}
+
+func BenchmarkEncodeEnvelopeE1(b *testing.B) {
+	env := benchEnvelope()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = EncodeEnvelopeE1(env)
+	}
+}
+
+func BenchmarkAppendEnvelopeE1(b *testing.B) {
+	env := benchEnvelope()
+	buf := make([]byte, 0, EncodedLenE1(env))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ = AppendEnvelopeE1(buf[:0], env)
+	}
+}
+
+func BenchmarkDecodeEnvelopeE1(b *testing.B) {
+	body, _ := EncodeEnvelopeE1(benchEnvelope())
+	limits := DefaultLimits()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = DecodeEnvelopeE1(body, limits)
+	}
+}
+
+func BenchmarkDecodeEnvelopeE1Aliased(b *testing.B) {
+	body, _ := EncodeEnvelopeE1(benchEnvelope())
+	limits := DefaultLimits()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = DecodeEnvelopeE1Aliased(body, limits)
+	}
+}
@@ -10,6 +10,9 @@ const (
 	CodeUnsupportedVersion Code = "UNSUPPORTED_VERSION"
 	CodeUnknownProfile     Code = "UNKNOWN_PROFILE"
 	CodeInvalidEnvelope    Code = "INVALID_ENVELOPE"
+	CodeUnsupportedMsgType Code = "UNSUPPORTED_MSG_TYPE"
+	CodeDuplicateMsgID     Code = "DUPLICATE_MSG_ID"
+	CodeRateLimitExceeded  Code = "RATE_LIMIT_EXCEEDED"
 	CodeInternalError      Code = "INTERNAL_ERROR"
 )
 
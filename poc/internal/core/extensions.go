@@ -0,0 +1,386 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Core extension types (0-15 are reserved for core and bindings).
+const (
+	// ExtCritical lists, as uvarints, the extension types a receiver must
+	// understand to process the envelope.
+	ExtCritical uint64 = 0
+	// ExtPayloadCodec carries the uvarint Codec of a compressed payload.
+	ExtPayloadCodec uint64 = 1
+	// ExtAcceptCodecs carries the sender's decodable codecs as a sequence of
+	// uvarints in preference order.
+	ExtAcceptCodecs uint64 = 2
+	// ExtFragment carries uvarint fragment index then uvarint fragment total.
+	ExtFragment uint64 = 3
+	// ExtDeadline carries the sender's deadline as uvarint Unix milliseconds.
+	ExtDeadline uint64 = 4
+	// ExtTenant carries a UTF-8 tenant identifier.
+	ExtTenant uint64 = 5
+	// ExtTraceContext carries bytes traceparent then bytes tracestate.
+	ExtTraceContext uint64 = 6
+	// ExtAuthTag carries an opaque authentication tag.
+	ExtAuthTag uint64 = 7
+)
+
+// ExtensionSpec declares how an extension type is encoded and enforced.
+// Critical extensions are listed in ExtCritical when set, so receivers that
+// do not know them reject the envelope instead of ignoring them. MaxBytes of
+// 0 leaves only the envelope-wide MaxExtBytes limit.
+type ExtensionSpec struct {
+	Type     uint64
+	Name     string
+	Critical bool
+	MaxBytes int
+	Validate func(value []byte) error
+}
+
+type ExtensionRegistry struct {
+	specs map[uint64]ExtensionSpec
+}
+
+func NewExtensionRegistry() *ExtensionRegistry {
+	return &ExtensionRegistry{specs: make(map[uint64]ExtensionSpec)}
+}
+
+// DefaultExtensionRegistry returns a registry holding the core extension
+// types a receiver can act on. TenantExtension and AuthTagExtension are left
+// out, so envelopes marking them critical are rejected until a deployment
+// that scopes by tenant or verifies tags registers them. Callers may
+// register profile extensions on the result.
+func DefaultExtensionRegistry() *ExtensionRegistry {
+	r := NewExtensionRegistry()
+	for _, spec := range coreExtensionSpecs {
+		r.specs[spec.Type] = spec
+	}
+	return r
+}
+
+var coreExtensionSpecs = []ExtensionSpec{
+	{Type: ExtCritical, Name: "critical", MaxBytes: 64, Validate: validateUvarintList},
+	{Type: ExtPayloadCodec, Name: "payload_codec", Critical: true, MaxBytes: binary.MaxVarintLen64, Validate: validateUvarint},
+	{Type: ExtAcceptCodecs, Name: "accept_codecs", MaxBytes: 64, Validate: validateUvarintList},
+	{Type: ExtFragment, Name: "fragment", Critical: true, MaxBytes: 2 * binary.MaxVarintLen64, Validate: validateFragment},
+	{Type: ExtDeadline, Name: "deadline", MaxBytes: binary.MaxVarintLen64, Validate: validateUvarint},
+	{Type: ExtTraceContext, Name: "trace_context", MaxBytes: 1024, Validate: validateTraceContext},
+}
+
+// Core extensions that carry no meaning until the receiver enforces them.
+var (
+	TenantExtension  = ExtensionSpec{Type: ExtTenant, Name: "tenant", Critical: true, MaxBytes: 256, Validate: validateNonEmpty}
+	AuthTagExtension = ExtensionSpec{Type: ExtAuthTag, Name: "auth_tag", Critical: true, MaxBytes: 512, Validate: validateNonEmpty}
+)
+
+func (r *ExtensionRegistry) Register(spec ExtensionSpec) error {
+	if _, ok := r.specs[spec.Type]; ok {
+		return fmt.Errorf("extension type %d already registered", spec.Type)
+	}
+	r.specs[spec.Type] = spec
+	return nil
+}
+
+func (r *ExtensionRegistry) Lookup(typ uint64) (ExtensionSpec, bool) {
+	spec, ok := r.specs[typ]
+	return spec, ok
+}
+
+// Specs lists registered extensions ordered by type.
+func (r *ExtensionRegistry) Specs() []ExtensionSpec {
+	out := make([]ExtensionSpec, 0, len(r.specs))
+	for _, spec := range r.specs {
+		out = append(out, spec)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+	return out
+}
+
+// Validate enforces per-type size limits and codecs on known extensions and
+// rejects extensions marked critical that the registry does not know.
+// Unknown extensions that are not marked critical are ignored.
+func (r *ExtensionRegistry) Validate(ext []Extension) error {
+	for _, e := range ext {
+		spec, ok := r.specs[e.Type]
+		if !ok {
+			continue
+		}
+		if spec.MaxBytes > 0 && len(e.Value) > spec.MaxBytes {
+			return Wrap(CodeInvalidEnvelope, fmt.Errorf("extension %s length %d exceeds max %d", spec.Name, len(e.Value), spec.MaxBytes))
+		}
+		if spec.Validate != nil {
+			if err := spec.Validate(e.Value); err != nil {
+				return Wrap(CodeInvalidEnvelope, fmt.Errorf("extension %s: %w", spec.Name, err))
+			}
+		}
+	}
+	critical, err := criticalTypes(ext)
+	if err != nil {
+		return err
+	}
+	for _, typ := range critical {
+		if _, ok := r.specs[typ]; !ok {
+			return Wrap(CodeInvalidEnvelope, fmt.Errorf("unknown critical extension %d", typ))
+		}
+	}
+	return nil
+}
+
+// Set returns env with typ set to value, listing typ in ExtCritical when the
+// registry declares it critical.
+func (r *ExtensionRegistry) Set(env Envelope, typ uint64, value []byte) Envelope {
+	env.Extensions = withExtension(env.Extensions, typ, value)
+	if spec, ok := r.specs[typ]; ok && spec.Critical {
+		env.Extensions = markCritical(env.Extensions, typ)
+	}
+	return env
+}
+
+// coreExtensions knows every core type, so SetExtension marks tenant and
+// auth_tag critical even though DefaultExtensionRegistry does not accept them.
+var coreExtensions = func() *ExtensionRegistry {
+	r := DefaultExtensionRegistry()
+	_ = r.Register(TenantExtension)
+	_ = r.Register(AuthTagExtension)
+	return r
+}()
+
+// GetExtension returns the value of the first extension of type typ.
+func GetExtension(env Envelope, typ uint64) ([]byte, bool) {
+	return extensionValue(env.Extensions, typ)
+}
+
+// SetExtension returns env with typ set to value. Core critical types are
+// listed in ExtCritical; use ExtensionRegistry.Set for profile types.
+func SetExtension(env Envelope, typ uint64, value []byte) Envelope {
+	return coreExtensions.Set(env, typ, value)
+}
+
+// RemoveExtension returns env without typ, also dropping it from
+// ExtCritical.
+func RemoveExtension(env Envelope, typ uint64) Envelope {
+	env.Extensions = unmarkCritical(withoutExtension(env.Extensions, typ), typ)
+	return env
+}
+
+// CriticalExtensions returns the extension types env marks critical.
+func CriticalExtensions(env Envelope) ([]uint64, error) {
+	return criticalTypes(env.Extensions)
+}
+
+// Deadline returns the ExtDeadline of env.
+func Deadline(env Envelope) (time.Time, bool, error) {
+	raw, ok := extensionValue(env.Extensions, ExtDeadline)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	ms, err := decodeUvarint(raw)
+	if err != nil {
+		return time.Time{}, true, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode deadline: %w", err))
+	}
+	return time.UnixMilli(int64(ms)), true, nil
+}
+
+func WithDeadline(env Envelope, t time.Time) Envelope {
+	return SetExtension(env, ExtDeadline, binary.AppendUvarint(nil, uint64(t.UnixMilli())))
+}
+
+func Tenant(env Envelope) (string, bool) {
+	raw, ok := extensionValue(env.Extensions, ExtTenant)
+	return string(raw), ok
+}
+
+func WithTenant(env Envelope, tenant string) Envelope {
+	return SetExtension(env, ExtTenant, []byte(tenant))
+}
+
+type TraceContext struct {
+	Traceparent string
+	Tracestate  string
+}
+
+// TraceContextOf returns the W3C trace context carried in ExtTraceContext.
+func TraceContextOf(env Envelope) (TraceContext, bool, error) {
+	raw, ok := extensionValue(env.Extensions, ExtTraceContext)
+	if !ok {
+		return TraceContext{}, false, nil
+	}
+	tc, err := decodeTraceContext(raw)
+	if err != nil {
+		return TraceContext{}, true, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode trace context: %w", err))
+	}
+	return tc, true, nil
+}
+
+func WithTraceContext(env Envelope, tc TraceContext) Envelope {
+	raw := appendBytes(nil, []byte(tc.Traceparent))
+	raw = appendBytes(raw, []byte(tc.Tracestate))
+	return SetExtension(env, ExtTraceContext, raw)
+}
+
+func AuthTag(env Envelope) ([]byte, bool) {
+	return extensionValue(env.Extensions, ExtAuthTag)
+}
+
+func WithAuthTag(env Envelope, tag []byte) Envelope {
+	return SetExtension(env, ExtAuthTag, tag)
+}
+
+func extensionValue(ext []Extension, typ uint64) ([]byte, bool) {
+	for _, e := range ext {
+		if e.Type == typ {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// withExtension returns a copy of ext with typ set to value, ordered by type
+// so encoded envelopes stay canonical under StrictE1; ext itself is never
+// modified.
+func withExtension(ext []Extension, typ uint64, value []byte) []Extension {
+	rest := withoutExtension(ext, typ)
+	i := sort.Search(len(rest), func(i int) bool { return rest[i].Type > typ })
+	out := make([]Extension, 0, len(rest)+1)
+	out = append(out, rest[:i]...)
+	out = append(out, Extension{Type: typ, Value: value})
+	return append(out, rest[i:]...)
+}
+
+func withoutExtension(ext []Extension, typ uint64) []Extension {
+	out := make([]Extension, 0, len(ext))
+	for _, e := range ext {
+		if e.Type != typ {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func criticalTypes(ext []Extension) ([]uint64, error) {
+	raw, ok := extensionValue(ext, ExtCritical)
+	if !ok {
+		return nil, nil
+	}
+	types, err := decodeUvarintList(raw)
+	if err != nil {
+		return nil, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode critical extensions: %w", err))
+	}
+	return types, nil
+}
+
+func markCritical(ext []Extension, typ uint64) []Extension {
+	types, _ := criticalTypes(ext)
+	for _, t := range types {
+		if t == typ {
+			return ext
+		}
+	}
+	return withExtension(ext, ExtCritical, appendUvarintList(types, typ))
+}
+
+func unmarkCritical(ext []Extension, typ uint64) []Extension {
+	types, err := criticalTypes(ext)
+	if err != nil || types == nil {
+		return ext
+	}
+	kept := types[:0]
+	for _, t := range types {
+		if t != typ {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) == 0 {
+		return withoutExtension(ext, ExtCritical)
+	}
+	return withExtension(ext, ExtCritical, appendUvarintList(kept))
+}
+
+func appendUvarintList(vs []uint64, more ...uint64) []byte {
+	var raw []byte
+	for _, v := range append(vs, more...) {
+		raw = binary.AppendUvarint(raw, v)
+	}
+	return raw
+}
+
+func decodeUvarint(raw []byte) (uint64, error) {
+	c := e1Cursor{b: raw}
+	v, err := c.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if c.remaining() != 0 {
+		return 0, fmt.Errorf("trailing bytes: %d", c.remaining())
+	}
+	return v, nil
+}
+
+func decodeUvarintList(raw []byte) ([]uint64, error) {
+	c := e1Cursor{b: raw}
+	var out []uint64
+	for c.remaining() > 0 {
+		v, err := c.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func decodeTraceContext(raw []byte) (TraceContext, error) {
+	c := e1Cursor{b: raw}
+	parent, err := c.bytes()
+	if err != nil {
+		return TraceContext{}, err
+	}
+	state, err := c.bytes()
+	if err != nil {
+		return TraceContext{}, err
+	}
+	if c.remaining() != 0 {
+		return TraceContext{}, fmt.Errorf("trailing bytes: %d", c.remaining())
+	}
+	return TraceContext{Traceparent: string(parent), Tracestate: string(state)}, nil
+}
+
+func validateUvarint(raw []byte) error {
+	_, err := decodeUvarint(raw)
+	return err
+}
+
+func validateUvarintList(raw []byte) error {
+	_, err := decodeUvarintList(raw)
+	return err
+}
+
+func validateFragment(raw []byte) error {
+	c := e1Cursor{b: raw}
+	if _, err := c.uvarint(); err != nil {
+		return err
+	}
+	if _, err := c.uvarint(); err != nil {
+		return err
+	}
+	if c.remaining() != 0 {
+		return fmt.Errorf("trailing bytes: %d", c.remaining())
+	}
+	return nil
+}
+
+func validateTraceContext(raw []byte) error {
+	_, err := decodeTraceContext(raw)
+	return err
+}
+
+func validateNonEmpty(raw []byte) error {
+	if len(raw) == 0 {
+		return fmt.Errorf("empty value")
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func extensionTestEnvelope() Envelope {
+	return Envelope{
+		Version:   CoreVersion,
+		ProfileID: 1,
+		MsgType:   1,
+		MsgID:     []byte("abcdef1234567890"),
+	}
+}
+
+func TestWellKnownExtensionsRoundTrip(t *testing.T) {
+	deadline := time.UnixMilli(1700000000123)
+	env := extensionTestEnvelope()
+	env = WithDeadline(env, deadline)
+	env = WithTenant(env, "acme")
+	env = WithTraceContext(env, TraceContext{Traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", Tracestate: "vendor=1"})
+	env = WithAuthTag(env, []byte{0xde, 0xad})
+
+	body, err := EncodeEnvelopeE1(env)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	got, err := DecodeEnvelopeE1(body, DefaultLimits())
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	v := DefaultValidator()
+	v.EnforceKnownProfile = false
+	_ = v.Extensions.Register(TenantExtension)
+	_ = v.Extensions.Register(AuthTagExtension)
+	if err := v.ValidateEnvelope(got); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+
+	if d, ok, err := Deadline(got); err != nil || !ok || !d.Equal(deadline) {
+		t.Fatalf("deadline mismatch: %v ok=%v err=%v", d, ok, err)
+	}
+	if tenant, ok := Tenant(got); !ok || tenant != "acme" {
+		t.Fatalf("tenant mismatch: %q", tenant)
+	}
+	if tc, ok, err := TraceContextOf(got); err != nil || !ok || tc.Tracestate != "vendor=1" {
+		t.Fatalf("trace context mismatch: %+v err=%v", tc, err)
+	}
+	if tag, ok := AuthTag(got); !ok || len(tag) != 2 {
+		t.Fatalf("auth tag mismatch: %x", tag)
+	}
+
+	critical, err := CriticalExtensions(got)
+	if err != nil {
+		t.Fatalf("CriticalExtensions failed: %v", err)
+	}
+	if len(critical) != 2 || critical[0] != ExtTenant || critical[1] != ExtAuthTag {
+		t.Fatalf("expected tenant and auth tag critical, got %v", critical)
+	}
+
+	got = RemoveExtension(got, ExtTenant)
+	got = RemoveExtension(got, ExtAuthTag)
+	if _, ok := GetExtension(got, ExtCritical); ok {
+		t.Fatalf("expected critical list removed once empty")
+	}
+}
+
+func TestValidatorExtensionRegistry(t *testing.T) {
+	v := DefaultValidator()
+	v.EnforceKnownProfile = false
+
+	env := extensionTestEnvelope()
+	env.Extensions = []Extension{{Type: 4097, Value: []byte("ignored")}}
+	if err := v.ValidateEnvelope(env); err != nil {
+		t.Fatalf("expected unknown non-critical extension to be ignored, got %v", err)
+	}
+
+	env.Extensions = append(env.Extensions, Extension{Type: ExtCritical, Value: binary.AppendUvarint(nil, 4097)})
+	if err := v.ValidateEnvelope(env); CodeFromError(err) != CodeInvalidEnvelope {
+		t.Fatalf("expected INVALID_ENVELOPE for unknown critical extension, got %v", err)
+	}
+
+	reg := DefaultExtensionRegistry()
+	if err := reg.Register(ExtensionSpec{Type: 4097, Name: "profile.example", Critical: true, MaxBytes: 16}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := reg.Register(ExtensionSpec{Type: 4097}); err == nil {
+		t.Fatalf("expected duplicate registration to fail")
+	}
+	v.Extensions = reg
+	if err := v.ValidateEnvelope(env); err != nil {
+		t.Fatalf("expected registered critical extension to pass, got %v", err)
+	}
+
+	marked := reg.Set(extensionTestEnvelope(), 4097, []byte("v"))
+	if critical, _ := CriticalExtensions(marked); len(critical) != 1 || critical[0] != 4097 {
+		t.Fatalf("expected Set to mark registered critical type, got %v", critical)
+	}
+}
+
+func TestValidatorRejectsMalformedWellKnownExtension(t *testing.T) {
+	v := DefaultValidator()
+	v.EnforceKnownProfile = false
+	_ = v.Extensions.Register(TenantExtension)
+	_ = v.Extensions.Register(AuthTagExtension)
+
+	for name, ext := range map[string]Extension{
+		"deadline trailing bytes": {Type: ExtDeadline, Value: []byte{0x01, 0x02}},
+		"empty tenant":            {Type: ExtTenant},
+		"oversized auth tag":      {Type: ExtAuthTag, Value: make([]byte, 513)},
+		"truncated trace context": {Type: ExtTraceContext, Value: []byte{0x05, 'a'}},
+	} {
+		env := extensionTestEnvelope()
+		env.Extensions = []Extension{ext}
+		if err := v.ValidateEnvelope(env); CodeFromError(err) != CodeInvalidEnvelope {
+			t.Fatalf("%s: expected INVALID_ENVELOPE, got %v", name, err)
+		}
+	}
+}
+
+func TestDefaultValidatorRejectsUnenforcedCriticalExtensions(t *testing.T) {
+	v := DefaultValidator()
+	v.EnforceKnownProfile = false
+	for name, env := range map[string]Envelope{
+		"tenant":   WithTenant(extensionTestEnvelope(), "acme"),
+		"auth_tag": WithAuthTag(extensionTestEnvelope(), []byte{0x01}),
+	} {
+		if err := v.ValidateEnvelope(env); CodeFromError(err) != CodeInvalidEnvelope {
+			t.Fatalf("%s: expected INVALID_ENVELOPE for unenforced critical extension, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// FlagFragment marks an envelope carrying one fragment of a larger logical
+// envelope; ExtFragment gives its position.
+const FlagFragment uint64 = 1 << 1
+
+const (
+	DefaultMaxMessageBytes    = 32 * 1024 * 1024
+	DefaultMaxPendingMessages = 16
+	DefaultReassemblyTimeout  = 30 * time.Second
+	// fragment TLV plus its entry in the critical extension list
+	fragmentExtensionMaxBytes   = 1 + 1 + 2*binary.MaxVarintLen64 + 4
+	fragmentPayloadPrefixMaxLen = binary.MaxVarintLen32
+)
+
+type FragmentInfo struct {
+	Index uint64
+	Total uint64
+}
+
+// FragmentOf reports whether env is a fragment and, if so, its position.
+func FragmentOf(env Envelope) (FragmentInfo, bool, error) {
+	if env.Flags&FlagFragment == 0 {
+		return FragmentInfo{}, false, nil
+	}
+	raw, ok := extensionValue(env.Extensions, ExtFragment)
+	if !ok {
+		return FragmentInfo{}, true, Wrap(CodeInvalidEnvelope, fmt.Errorf("fragment without fragment extension"))
+	}
+	c := e1Cursor{b: raw}
+	index, err := c.uvarint()
+	if err != nil {
+		return FragmentInfo{}, true, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode fragment index: %w", err))
+	}
+	total, err := c.uvarint()
+	if err != nil {
+		return FragmentInfo{}, true, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode fragment total: %w", err))
+	}
+	if c.remaining() != 0 || total < 2 || index >= total {
+		return FragmentInfo{}, true, Wrap(CodeInvalidEnvelope, fmt.Errorf("invalid fragment %d/%d", index, total))
+	}
+	return FragmentInfo{Index: index, Total: total}, true, nil
+}
+
+// Fragment splits env into envelopes whose E1 encoding fits in maxFrame.
+// Envelopes that already fit are returned as the only element. Every
+// fragment repeats the header and extensions of env.
+func Fragment(env Envelope, maxFrame uint32) ([]Envelope, error) {
+	if uint64(EncodedLenE1(env)) <= uint64(maxFrame) {
+		return []Envelope{env}, nil
+	}
+	if env.Flags&FlagFragment != 0 {
+		return nil, Wrap(CodeInvalidFrame, fmt.Errorf("cannot fragment a fragment"))
+	}
+
+	header := env
+	header.Payload = nil
+	overhead := EncodedLenE1(header) + fragmentExtensionMaxBytes + fragmentPayloadPrefixMaxLen
+	chunk := int(maxFrame) - overhead
+	if chunk < 1 {
+		return nil, Wrap(CodeInvalidFrame, fmt.Errorf("max frame %d too small for envelope header", maxFrame))
+	}
+
+	total := (len(env.Payload) + chunk - 1) / chunk
+	out := make([]Envelope, 0, total)
+	for i := 0; i < total; i++ {
+		end := (i + 1) * chunk
+		if end > len(env.Payload) {
+			end = len(env.Payload)
+		}
+		var info []byte
+		info = binary.AppendUvarint(info, uint64(i))
+		info = binary.AppendUvarint(info, uint64(total))
+
+		frag := header
+		frag.Flags |= FlagFragment
+		frag = SetExtension(frag, ExtFragment, info)
+		frag.Payload = env.Payload[i*chunk : end]
+		out = append(out, frag)
+	}
+	return out, nil
+}
+
+type ReassemblyLimits struct {
+	// MaxMessageBytes bounds one reassembled payload.
+	MaxMessageBytes uint32
+	// MaxBufferedBytes bounds payload bytes held across all partial
+	// messages.
+	MaxBufferedBytes int
+	// MaxPending bounds concurrently partial msg_ids.
+	MaxPending int
+	// Timeout bounds the time from first to last fragment of a msg_id.
+	Timeout time.Duration
+}
+
+func DefaultReassemblyLimits() ReassemblyLimits {
+	return ReassemblyLimits{
+		MaxMessageBytes:  DefaultMaxMessageBytes,
+		MaxBufferedBytes: DefaultMaxMessageBytes,
+		MaxPending:       DefaultMaxPendingMessages,
+		Timeout:          DefaultReassemblyTimeout,
+	}
+}
+
+type partialMessage struct {
+	first    Envelope
+	total    uint64
+	next     uint64
+	payload  []byte
+	deadline time.Time
+}
+
+// Reassembler rebuilds envelopes split by Fragment. Fragments of one msg_id
+// must arrive in index order; fragments of different msg_ids may
+// interleave. It is not safe for concurrent use.
+type Reassembler struct {
+	limits   ReassemblyLimits
+	pending  map[string]*partialMessage
+	buffered int
+}
+
+func NewReassembler(limits ReassemblyLimits) *Reassembler {
+	return &Reassembler{limits: limits, pending: make(map[string]*partialMessage)}
+}
+
+// Add consumes one fragment. It returns the reassembled envelope and true
+// once the last fragment arrives. On error the partial message for that
+// msg_id is discarded.
+func (r *Reassembler) Add(env Envelope, now time.Time) (Envelope, bool, error) {
+	info, ok, err := FragmentOf(env)
+	if err != nil {
+		r.drop(string(env.MsgID))
+		return Envelope{}, false, err
+	}
+	if !ok {
+		return env, true, nil
+	}
+
+	key := string(env.MsgID)
+	p := r.pending[key]
+	if p == nil {
+		if info.Index != 0 {
+			return Envelope{}, false, Wrap(CodeInvalidEnvelope, fmt.Errorf("fragment %d/%d without preceding fragments", info.Index, info.Total))
+		}
+		if len(r.pending) >= r.limits.MaxPending {
+			return Envelope{}, false, Wrap(CodeInvalidEnvelope, fmt.Errorf("too many partial messages (max %d)", r.limits.MaxPending))
+		}
+		p = &partialMessage{first: detachEnvelope(env), total: info.Total, deadline: now.Add(r.limits.Timeout)}
+		r.pending[key] = p
+	} else if info.Index != p.next || info.Total != p.total ||
+		env.ProfileID != p.first.ProfileID || env.MsgType != p.first.MsgType {
+		r.drop(key)
+		return Envelope{}, false, Wrap(CodeInvalidEnvelope, fmt.Errorf("unexpected fragment %d/%d, want %d/%d", info.Index, info.Total, p.next, p.total))
+	}
+
+	if uint64(len(p.payload))+uint64(len(env.Payload)) > uint64(r.limits.MaxMessageBytes) {
+		r.drop(key)
+		return Envelope{}, false, Wrap(CodeInvalidEnvelope, fmt.Errorf("reassembled payload exceeds max %d", r.limits.MaxMessageBytes))
+	}
+	if r.buffered+len(env.Payload) > r.limits.MaxBufferedBytes {
+		r.drop(key)
+		return Envelope{}, false, Wrap(CodeInvalidEnvelope, fmt.Errorf("reassembly buffer exceeds max %d", r.limits.MaxBufferedBytes))
+	}
+	p.payload = append(p.payload, env.Payload...)
+	r.buffered += len(env.Payload)
+	p.next++
+	if p.next < p.total {
+		return Envelope{}, false, nil
+	}
+
+	r.drop(key)
+	out := RemoveExtension(p.first, ExtFragment)
+	out.Flags &^= FlagFragment
+	out.Payload = p.payload
+	return out, true, nil
+}
+
+// detachEnvelope copies the header fields of env that may alias a frame
+// buffer, dropping the payload, so a partial message outlives its first
+// fragment's frame.
+func detachEnvelope(env Envelope) Envelope {
+	env.MsgID = append([]byte(nil), env.MsgID...)
+	ext := make([]Extension, len(env.Extensions))
+	for i, e := range env.Extensions {
+		ext[i] = Extension{Type: e.Type, Value: append([]byte(nil), e.Value...)}
+	}
+	env.Extensions = ext
+	env.Payload = nil
+	return env
+}
+
+// Expire discards partial messages whose timeout has passed and returns
+// their msg_ids.
+func (r *Reassembler) Expire(now time.Time) [][]byte {
+	var expired [][]byte
+	for key, p := range r.pending {
+		if now.After(p.deadline) {
+			expired = append(expired, []byte(key))
+			r.drop(key)
+		}
+	}
+	return expired
+}
+
+// Pending returns the number of partial messages.
+func (r *Reassembler) Pending() int {
+	return len(r.pending)
+}
+
+func (r *Reassembler) drop(key string) {
+	if p, ok := r.pending[key]; ok {
+		r.buffered -= len(p.payload)
+		delete(r.pending, key)
+	}
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func fragmentTestEnvelope(msgID string, n int) Envelope {
+	payload := make([]byte, n)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	return Envelope{
+		Version:    CoreVersion,
+		ProfileID:  14,
+		MsgType:    1,
+		MsgID:      []byte(msgID),
+		Extensions: []Extension{{Type: 16, Value: []byte("profile-ext")}},
+		Payload:    payload,
+	}
+}
+
+func TestFragmentReassembleRoundTrip(t *testing.T) {
+	const maxFrame = 256
+	a := fragmentTestEnvelope("msg-a-0000000001", 5000)
+	b := fragmentTestEnvelope("msg-b-0000000001", 700)
+
+	fa, err := Fragment(a, maxFrame)
+	if err != nil {
+		t.Fatalf("Fragment failed: %v", err)
+	}
+	fb, err := Fragment(b, maxFrame)
+	if err != nil {
+		t.Fatalf("Fragment failed: %v", err)
+	}
+	if len(fa) < 2 || len(fb) < 2 {
+		t.Fatalf("expected multiple fragments, got %d and %d", len(fa), len(fb))
+	}
+	for _, f := range append(append([]Envelope{}, fa...), fb...) {
+		if n := EncodedLenE1(f); n > maxFrame {
+			t.Fatalf("fragment encodes to %d bytes, max %d", n, maxFrame)
+		}
+	}
+
+	// Interleave fragments of both messages through an encode/decode cycle.
+	var wire []Envelope
+	for i := 0; i < len(fa) || i < len(fb); i++ {
+		if i < len(fa) {
+			wire = append(wire, fa[i])
+		}
+		if i < len(fb) {
+			wire = append(wire, fb[i])
+		}
+	}
+	r := NewReassembler(DefaultReassemblyLimits())
+	now := time.Now()
+	var got []Envelope
+	for _, f := range wire {
+		body, err := EncodeEnvelopeE1(f)
+		if err != nil {
+			t.Fatalf("encode fragment: %v", err)
+		}
+		dec, err := DecodeEnvelopeE1Aliased(body, DefaultLimits())
+		if err != nil {
+			t.Fatalf("decode fragment: %v", err)
+		}
+		env, complete, err := r.Add(dec, now)
+		if err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+		// Servers release the fragment's frame buffer right after Add.
+		for i := range body {
+			body[i] = 0xff
+		}
+		if complete {
+			got = append(got, env)
+		}
+	}
+	if len(got) != 2 || r.Pending() != 0 {
+		t.Fatalf("expected 2 reassembled envelopes and none pending, got %d pending=%d", len(got), r.Pending())
+	}
+	for _, env := range got {
+		want := a
+		if string(env.MsgID) == string(b.MsgID) {
+			want = b
+		}
+		if !bytes.Equal(env.Payload, want.Payload) {
+			t.Fatalf("%s: payload mismatch", env.MsgID)
+		}
+		if env.Flags != 0 || len(env.Extensions) != 1 || env.Extensions[0].Type != 16 {
+			t.Fatalf("%s: unexpected flags=%d ext=%v", env.MsgID, env.Flags, env.Extensions)
+		}
+	}
+}
+
+func TestFragmentLeavesSmallEnvelope(t *testing.T) {
+	env := fragmentTestEnvelope("msg-small-000001", 10)
+	out, err := Fragment(env, DefaultMaxFrameBytes)
+	if err != nil || len(out) != 1 || out[0].Flags != 0 {
+		t.Fatalf("expected envelope unchanged, got %d fragments err=%v", len(out), err)
+	}
+}
+
+func TestReassemblerRejectsOutOfOrderFragment(t *testing.T) {
+	frags, err := Fragment(fragmentTestEnvelope("msg-order-000001", 2000), 256)
+	if err != nil {
+		t.Fatalf("Fragment failed: %v", err)
+	}
+	r := NewReassembler(DefaultReassemblyLimits())
+	if _, _, err := r.Add(frags[1], time.Now()); CodeFromError(err) != CodeInvalidEnvelope {
+		t.Fatalf("expected INVALID_ENVELOPE for missing first fragment, got %v", err)
+	}
+	if _, _, err := r.Add(frags[0], time.Now()); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if _, _, err := r.Add(frags[2], time.Now()); CodeFromError(err) != CodeInvalidEnvelope {
+		t.Fatalf("expected INVALID_ENVELOPE for skipped fragment, got %v", err)
+	}
+	if r.Pending() != 0 {
+		t.Fatalf("expected partial message to be discarded")
+	}
+}
+
+func TestReassemblerLimits(t *testing.T) {
+	frags, err := Fragment(fragmentTestEnvelope("msg-limit-000001", 2000), 256)
+	if err != nil {
+		t.Fatalf("Fragment failed: %v", err)
+	}
+
+	limits := DefaultReassemblyLimits()
+	limits.MaxMessageBytes = 1000
+	r := NewReassembler(limits)
+	var lastErr error
+	for _, f := range frags {
+		if _, _, lastErr = r.Add(f, time.Now()); lastErr != nil {
+			break
+		}
+	}
+	if CodeFromError(lastErr) != CodeInvalidEnvelope || r.Pending() != 0 {
+		t.Fatalf("expected message size rejection, got %v pending=%d", lastErr, r.Pending())
+	}
+
+	limits = DefaultReassemblyLimits()
+	limits.MaxPending = 1
+	r = NewReassembler(limits)
+	other, _ := Fragment(fragmentTestEnvelope("msg-other-000001", 2000), 256)
+	if _, _, err := r.Add(frags[0], time.Now()); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if _, _, err := r.Add(other[0], time.Now()); CodeFromError(err) != CodeInvalidEnvelope {
+		t.Fatalf("expected pending-limit rejection, got %v", err)
+	}
+}
+
+func TestReassemblerExpire(t *testing.T) {
+	frags, err := Fragment(fragmentTestEnvelope("msg-late-0000001", 2000), 256)
+	if err != nil {
+		t.Fatalf("Fragment failed: %v", err)
+	}
+	limits := DefaultReassemblyLimits()
+	limits.Timeout = time.Second
+	r := NewReassembler(limits)
+	start := time.Now()
+	if _, _, err := r.Add(frags[0], start); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if got := r.Expire(start.Add(500 * time.Millisecond)); len(got) != 0 {
+		t.Fatalf("expected nothing expired yet, got %d", len(got))
+	}
+	got := r.Expire(start.Add(2 * time.Second))
+	if len(got) != 1 || string(got[0]) != "msg-late-0000001" || r.Pending() != 0 {
+		t.Fatalf("expected msg-late-0000001 expired, got %q pending=%d", got, r.Pending())
+	}
+}
@@ -1,48 +1,227 @@
 package core
 
 import (
+	"bufio"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"net"
+	"sync"
 )
 
 func ReadFrame(r io.Reader, maxFrame uint32) ([]byte, error) {
 	var prefix [4]byte
-	if _, err := io.ReadFull(r, prefix[:]); err != nil {
-		return nil, Wrap(CodeInvalidFrame, fmt.Errorf("read prefix: %w", err))
+	n, err := readPrefix(r, &prefix, maxFrame)
+	if err != nil {
+		return nil, err
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, Wrap(CodeInvalidFrame, fmt.Errorf("read frame body: %w", err))
 	}
+	return body, nil
+}
 
+func readPrefix(r io.Reader, prefix *[4]byte, maxFrame uint32) (uint32, error) {
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return 0, Wrap(CodeInvalidFrame, fmt.Errorf("read prefix: %w", err))
+	}
 	n := binary.BigEndian.Uint32(prefix[:])
 	if n == 0 {
-		return nil, Wrap(CodeInvalidFrame, fmt.Errorf("zero-length frame"))
+		return 0, Wrap(CodeInvalidFrame, fmt.Errorf("zero-length frame"))
+	}
+	if n > maxFrame {
+		return 0, Wrap(CodeInvalidFrame, fmt.Errorf("frame length %d exceeds max %d", n, maxFrame))
+	}
+	return n, nil
+}
+
+func WriteFrame(w io.Writer, body []byte, maxFrame uint32) error {
+	n := uint32(len(body))
+	if n == 0 {
+		return Wrap(CodeInvalidFrame, fmt.Errorf("zero-length frame"))
 	}
 	if n > maxFrame {
-		return nil, Wrap(CodeInvalidFrame, fmt.Errorf("frame length %d exceeds max %d", n, maxFrame))
+		return Wrap(CodeInvalidFrame, fmt.Errorf("frame length %d exceeds max %d", n, maxFrame))
+	}
+
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], n)
+	// net.Buffers uses writev on connections that support it, so prefix and
+	// body leave in one syscall.
+	bufs := net.Buffers{prefix[:], body}
+	if _, err := bufs.WriteTo(w); err != nil {
+		return Wrap(CodeInternalError, fmt.Errorf("write frame: %w", err))
+	}
+	return nil
+}
+
+const (
+	frameWriterBufferBytes  = 32 * 1024
+	frameReaderBufferBytes  = 32 * 1024
+	frameWriterScratchBytes = 64 * 1024
+	framePoolInitialBytes   = 4 * 1024
+	framePoolMaxBytes       = 64 * 1024
+)
+
+var framePool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, framePoolInitialBytes)
+		return &b
+	},
+}
+
+// Frame is a frame body read by FrameReader.ReadFrame. Body may live in a
+// pooled buffer; call Release once Body, and any envelope decoded from it
+// with DecodeEnvelopeE1Aliased, is no longer used.
+type Frame struct {
+	Body []byte
+	buf  *[]byte
+}
+
+// Release returns the frame's buffer to the pool. It is safe to call more
+// than once, but not on copies of the same Frame.
+func (f *Frame) Release() {
+	if f.buf != nil {
+		*f.buf = (*f.buf)[:0]
+		framePool.Put(f.buf)
 	}
+	f.buf = nil
+	f.Body = nil
+}
+
+// FrameReader reads length-prefixed frames through a buffered reader.
+// ReadFrame draws bodies of up to framePoolMaxBytes from a shared pool;
+// larger frames are allocated directly and never pooled.
+type FrameReader struct {
+	r        *bufio.Reader
+	maxFrame uint32
+	onStart  func()
+	prefix   [4]byte
+}
 
+func NewFrameReader(r io.Reader, maxFrame uint32) *FrameReader {
+	return &FrameReader{r: bufio.NewReaderSize(r, frameReaderBufferBytes), maxFrame: maxFrame}
+}
+
+// OnFrameStart registers fn to run once the first byte of each frame is
+// available, before the rest of the frame is read. Servers use it to switch
+// from an idle deadline to a per-frame read deadline.
+func (fr *FrameReader) OnFrameStart(fn func()) {
+	fr.onStart = fn
+}
+
+func (fr *FrameReader) ReadFrame() (Frame, error) {
+	n, err := fr.readPrefix()
+	if err != nil {
+		return Frame{}, err
+	}
+	var f Frame
+	if n <= framePoolMaxBytes {
+		f.buf = framePool.Get().(*[]byte)
+		if uint32(cap(*f.buf)) < n {
+			*f.buf = make([]byte, n)
+		}
+		f.Body = (*f.buf)[:n]
+	} else {
+		f.Body = make([]byte, n)
+	}
+	if _, err := io.ReadFull(fr.r, f.Body); err != nil {
+		f.Release()
+		return Frame{}, Wrap(CodeInvalidFrame, fmt.Errorf("read frame body: %w", err))
+	}
+	return f, nil
+}
+
+// ReadOwnedFrame reads the next frame into a fresh buffer the caller keeps,
+// for readers that hand decoded envelopes on with no bounded lifetime.
+func (fr *FrameReader) ReadOwnedFrame() ([]byte, error) {
+	n, err := fr.readPrefix()
+	if err != nil {
+		return nil, err
+	}
 	body := make([]byte, n)
-	if _, err := io.ReadFull(r, body); err != nil {
+	if _, err := io.ReadFull(fr.r, body); err != nil {
 		return nil, Wrap(CodeInvalidFrame, fmt.Errorf("read frame body: %w", err))
 	}
 	return body, nil
 }
 
-func WriteFrame(w io.Writer, body []byte, maxFrame uint32) error {
+func (fr *FrameReader) readPrefix() (uint32, error) {
+	if fr.onStart != nil {
+		if _, err := fr.r.Peek(1); err != nil {
+			return 0, Wrap(CodeInvalidFrame, fmt.Errorf("read prefix: %w", err))
+		}
+		fr.onStart()
+	}
+	return readPrefix(fr.r, &fr.prefix, fr.maxFrame)
+}
+
+// FrameWriter buffers length-prefixed frames so a batch of envelopes reaches
+// the underlying writer in as few writes as possible. Nothing is sent until
+// Flush, or until the buffer fills. It is not safe for concurrent use.
+type FrameWriter struct {
+	w        *bufio.Writer
+	maxFrame uint32
+	scratch  []byte
+}
+
+func NewFrameWriter(w io.Writer, maxFrame uint32) *FrameWriter {
+	return &FrameWriter{w: bufio.NewWriterSize(w, frameWriterBufferBytes), maxFrame: maxFrame}
+}
+
+func (fw *FrameWriter) WriteFrame(body []byte) error {
 	n := uint32(len(body))
 	if n == 0 {
 		return Wrap(CodeInvalidFrame, fmt.Errorf("zero-length frame"))
 	}
-	if n > maxFrame {
-		return Wrap(CodeInvalidFrame, fmt.Errorf("frame length %d exceeds max %d", n, maxFrame))
+	if n > fw.maxFrame {
+		return Wrap(CodeInvalidFrame, fmt.Errorf("frame length %d exceeds max %d", n, fw.maxFrame))
 	}
 
 	var prefix [4]byte
 	binary.BigEndian.PutUint32(prefix[:], n)
-	if _, err := w.Write(prefix[:]); err != nil {
+	if _, err := fw.w.Write(prefix[:]); err != nil {
 		return Wrap(CodeInternalError, fmt.Errorf("write prefix: %w", err))
 	}
-	if _, err := w.Write(body); err != nil {
+	if _, err := fw.w.Write(body); err != nil {
 		return Wrap(CodeInternalError, fmt.Errorf("write body: %w", err))
 	}
 	return nil
 }
+
+// WriteEnvelope encodes env directly behind its length prefix, reusing an
+// internal scratch buffer across calls.
+func (fw *FrameWriter) WriteEnvelope(env Envelope) error {
+	n := EncodedLenE1(env)
+	if uint64(n) > uint64(fw.maxFrame) {
+		return Wrap(CodeInvalidFrame, fmt.Errorf("frame length %d exceeds max %d", n, fw.maxFrame))
+	}
+	if cap(fw.scratch) < 4+n {
+		fw.scratch = make([]byte, 0, 4+n)
+	}
+	buf := binary.BigEndian.AppendUint32(fw.scratch[:0], uint32(n))
+	buf, err := AppendEnvelopeE1(buf, env)
+	if err != nil {
+		return err
+	}
+	if cap(buf) <= frameWriterScratchBytes {
+		fw.scratch = buf[:0]
+	}
+	if _, err := fw.w.Write(buf); err != nil {
+		return Wrap(CodeInternalError, fmt.Errorf("write frame: %w", err))
+	}
+	return nil
+}
+
+// Buffered returns the number of bytes waiting for Flush.
+func (fw *FrameWriter) Buffered() int {
+	return fw.w.Buffered()
+}
+
+func (fw *FrameWriter) Flush() error {
+	if err := fw.w.Flush(); err != nil {
+		return Wrap(CodeInternalError, fmt.Errorf("flush frames: %w", err))
+	}
+	return nil
+}
@@ -30,3 +30,253 @@ func TestReadFrameZeroLengthInvalid(t *testing.T) {
 		t.Fatalf("unexpected code: %s", CodeFromError(err))
 	}
 }
+
+func TestFrameReaderReadsConsecutiveFrames(t *testing.T) {
+	var buf bytes.Buffer
+	for _, body := range []string{"first", "second", string(make([]byte, 70000))} {
+		if err := WriteFrame(&buf, []byte(body), DefaultLimits().MaxFrameBytes); err != nil {
+			t.Fatalf("WriteFrame failed: %v", err)
+		}
+	}
+
+	fr := NewFrameReader(&buf, DefaultLimits().MaxFrameBytes)
+	for _, want := range []int{5, 6, 70000} {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatalf("ReadFrame failed: %v", err)
+		}
+		if len(f.Body) != want {
+			t.Fatalf("frame length mismatch: got %d want %d", len(f.Body), want)
+		}
+		if pooled := f.buf != nil; pooled != (want <= framePoolMaxBytes) {
+			t.Fatalf("frame of %d bytes: pooled=%v", want, pooled)
+		}
+		f.Release()
+		f.Release()
+		if f.Body != nil || f.buf != nil {
+			t.Fatalf("expected Release to clear the frame")
+		}
+	}
+	if _, err := fr.ReadFrame(); CodeFromError(err) != CodeInvalidFrame {
+		t.Fatalf("expected INVALID_FRAME at end of stream, got %v", err)
+	}
+}
+
+func TestFrameReaderReadOwnedFrame(t *testing.T) {
+	var buf bytes.Buffer
+	for _, body := range []string{"first", "second"} {
+		if err := WriteFrame(&buf, []byte(body), DefaultLimits().MaxFrameBytes); err != nil {
+			t.Fatalf("WriteFrame failed: %v", err)
+		}
+	}
+
+	fr := NewFrameReader(&buf, DefaultLimits().MaxFrameBytes)
+	first, err := fr.ReadOwnedFrame()
+	if err != nil {
+		t.Fatalf("ReadOwnedFrame failed: %v", err)
+	}
+	f, err := fr.ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame failed: %v", err)
+	}
+	f.Release()
+	if string(first) != "first" {
+		t.Fatalf("owned frame changed: %q", first)
+	}
+}
+
+func TestFrameReaderOnFrameStart(t *testing.T) {
+	var buf bytes.Buffer
+	for _, body := range []string{"first", "second"} {
+		if err := WriteFrame(&buf, []byte(body), DefaultLimits().MaxFrameBytes); err != nil {
+			t.Fatalf("WriteFrame failed: %v", err)
+		}
+	}
+
+	fr := NewFrameReader(&buf, DefaultLimits().MaxFrameBytes)
+	starts := 0
+	fr.OnFrameStart(func() { starts++ })
+	for i := 1; i <= 2; i++ {
+		if _, err := fr.ReadFrame(); err != nil {
+			t.Fatalf("ReadFrame failed: %v", err)
+		}
+		if starts != i {
+			t.Fatalf("expected %d frame starts, got %d", i, starts)
+		}
+	}
+	if _, err := fr.ReadFrame(); CodeFromError(err) != CodeInvalidFrame {
+		t.Fatalf("expected INVALID_FRAME at end of stream, got %v", err)
+	}
+	if starts != 2 {
+		t.Fatalf("expected no frame start at end of stream, got %d", starts)
+	}
+}
+
+func benchFrames(b *testing.B, n int) []byte {
+	b.Helper()
+	var buf bytes.Buffer
+	body := make([]byte, 1024)
+	for i := 0; i < n; i++ {
+		if err := WriteFrame(&buf, body, DefaultLimits().MaxFrameBytes); err != nil {
+			b.Fatalf("WriteFrame failed: %v", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkReadFrame(b *testing.B) {
+	raw := benchFrames(b, 1)
+	r := bytes.NewReader(raw)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(raw)
+		if _, err := ReadFrame(r, DefaultLimits().MaxFrameBytes); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFrameReader(b *testing.B) {
+	raw := benchFrames(b, 1)
+	r := bytes.NewReader(raw)
+	fr := NewFrameReader(r, DefaultLimits().MaxFrameBytes)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(raw)
+		fr.r.Reset(r)
+		f, err := fr.ReadFrame()
+		if err != nil {
+			b.Fatal(err)
+		}
+		f.Release()
+	}
+}
+
+// BenchmarkReadDecode compares the receive path before FrameReader (a
+// fresh body per frame, then a copying decode) with the server's pooled
+// path and the client's owned one.
+func BenchmarkReadDecode(b *testing.B) {
+	body, err := EncodeEnvelopeE1(benchEnvelope())
+	if err != nil {
+		b.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, body, DefaultLimits().MaxFrameBytes); err != nil {
+		b.Fatal(err)
+	}
+	raw := buf.Bytes()
+	limits := DefaultLimits()
+
+	b.Run("ReadFrame+DecodeEnvelopeE1", func(b *testing.B) {
+		r := bytes.NewReader(raw)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			r.Reset(raw)
+			f, err := ReadFrame(r, limits.MaxFrameBytes)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := DecodeEnvelopeE1(f, limits); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("FrameReader+DecodeEnvelopeE1Aliased+Release", func(b *testing.B) {
+		r := bytes.NewReader(raw)
+		fr := NewFrameReader(r, limits.MaxFrameBytes)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			r.Reset(raw)
+			fr.r.Reset(r)
+			f, err := fr.ReadFrame()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := DecodeEnvelopeE1Aliased(f.Body, limits); err != nil {
+				b.Fatal(err)
+			}
+			f.Release()
+		}
+	})
+	b.Run("ReadOwnedFrame+DecodeEnvelopeE1Aliased", func(b *testing.B) {
+		r := bytes.NewReader(raw)
+		fr := NewFrameReader(r, limits.MaxFrameBytes)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			r.Reset(raw)
+			fr.r.Reset(r)
+			f, err := fr.ReadOwnedFrame()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := DecodeEnvelopeE1Aliased(f, limits); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestFrameWriterBuffersUntilFlush(t *testing.T) {
+	var w countingWriter
+	fw := NewFrameWriter(&w, DefaultLimits().MaxFrameBytes)
+	env := Envelope{Version: CoreVersion, ProfileID: 12, MsgType: 4, MsgID: []byte("abcdef1234567890"), Payload: []byte("item")}
+	for i := 0; i < 50; i++ {
+		if err := fw.WriteEnvelope(env); err != nil {
+			t.Fatalf("WriteEnvelope failed: %v", err)
+		}
+	}
+	if err := fw.WriteFrame([]byte("raw")); err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+	if w.writes != 0 {
+		t.Fatalf("expected no writes before Flush, got %d", w.writes)
+	}
+	if err := fw.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if w.writes != 1 {
+		t.Fatalf("expected one write after Flush, got %d", w.writes)
+	}
+
+	fr := NewFrameReader(&w.Buffer, DefaultLimits().MaxFrameBytes)
+	for i := 0; i < 50; i++ {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatalf("ReadFrame %d failed: %v", i, err)
+		}
+		got, err := DecodeEnvelopeE1Aliased(f.Body, DefaultLimits())
+		if err != nil {
+			t.Fatalf("decode %d failed: %v", i, err)
+		}
+		if string(got.Payload) != "item" {
+			t.Fatalf("payload mismatch at %d: %q", i, got.Payload)
+		}
+		f.Release()
+	}
+	f, err := fr.ReadFrame()
+	if err != nil || string(f.Body) != "raw" {
+		t.Fatalf("expected raw frame, got %q err=%v", f.Body, err)
+	}
+}
+
+func TestFrameWriterRejectsOversizedEnvelope(t *testing.T) {
+	var w countingWriter
+	fw := NewFrameWriter(&w, 16)
+	err := fw.WriteEnvelope(Envelope{Version: CoreVersion, ProfileID: 12, MsgType: 1, MsgID: []byte("abcdef1234567890"), Payload: []byte("x")})
+	if CodeFromError(err) != CodeInvalidFrame {
+		t.Fatalf("expected INVALID_FRAME, got %v", err)
+	}
+	if fw.Buffered() != 0 {
+		t.Fatalf("expected nothing buffered, got %d bytes", fw.Buffered())
+	}
+}
@@ -0,0 +1,258 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Features advertised in a HELLO. Payload codecs are negotiated per
+// envelope with ExtAcceptCodecs rather than here.
+const (
+	FeatureFragment = "fragment"
+)
+
+type ProfileVersion struct {
+	ProfileID uint64
+	Version   uint64
+}
+
+// Hello is the payload of a core HELLO envelope. Limits are the sender's
+// receive limits.
+type Hello struct {
+	Versions        []uint64
+	Profiles        []ProfileVersion
+	MaxFrameBytes   uint32
+	MaxPayloadBytes uint32
+	Features        []string
+}
+
+// NewHello advertises CoreVersion, the given profiles, limits and every
+// feature this implementation supports.
+func NewHello(limits Limits, profiles ...ProfileVersion) Hello {
+	return Hello{
+		Versions:        []uint64{CoreVersion},
+		Profiles:        profiles,
+		MaxFrameBytes:   limits.MaxFrameBytes,
+		MaxPayloadBytes: limits.MaxPayloadBytes,
+		Features:        []string{FeatureFragment},
+	}
+}
+
+func EncodeHelloPayload(h Hello) []byte {
+	var out []byte
+	out = binary.AppendUvarint(out, uint64(len(h.Versions)))
+	for _, v := range h.Versions {
+		out = binary.AppendUvarint(out, v)
+	}
+	out = binary.AppendUvarint(out, uint64(len(h.Profiles)))
+	for _, p := range h.Profiles {
+		out = binary.AppendUvarint(out, p.ProfileID)
+		out = binary.AppendUvarint(out, p.Version)
+	}
+	out = binary.AppendUvarint(out, uint64(h.MaxFrameBytes))
+	out = binary.AppendUvarint(out, uint64(h.MaxPayloadBytes))
+	out = binary.AppendUvarint(out, uint64(len(h.Features)))
+	for _, f := range h.Features {
+		out = appendBytes(out, []byte(f))
+	}
+	return out
+}
+
+func DecodeHelloPayload(payload []byte) (Hello, error) {
+	c := e1Cursor{b: payload}
+	var h Hello
+
+	n, err := c.count()
+	if err != nil {
+		return Hello{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode hello versions: %w", err))
+	}
+	for i := uint64(0); i < n; i++ {
+		v, err := c.uvarint()
+		if err != nil {
+			return Hello{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode hello version: %w", err))
+		}
+		h.Versions = append(h.Versions, v)
+	}
+
+	n, err = c.count()
+	if err != nil {
+		return Hello{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode hello profiles: %w", err))
+	}
+	for i := uint64(0); i < n; i++ {
+		id, err := c.uvarint()
+		if err != nil {
+			return Hello{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode hello profile_id: %w", err))
+		}
+		v, err := c.uvarint()
+		if err != nil {
+			return Hello{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode hello profile version: %w", err))
+		}
+		h.Profiles = append(h.Profiles, ProfileVersion{ProfileID: id, Version: v})
+	}
+
+	maxFrame, err := c.uvarint()
+	if err != nil {
+		return Hello{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode hello max_frame_bytes: %w", err))
+	}
+	maxPayload, err := c.uvarint()
+	if err != nil {
+		return Hello{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode hello max_payload_bytes: %w", err))
+	}
+	if maxFrame == 0 || maxFrame > 1<<32-1 || maxPayload > 1<<32-1 {
+		return Hello{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("invalid hello limits %d/%d", maxFrame, maxPayload))
+	}
+	h.MaxFrameBytes = uint32(maxFrame)
+	h.MaxPayloadBytes = uint32(maxPayload)
+
+	n, err = c.count()
+	if err != nil {
+		return Hello{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode hello features: %w", err))
+	}
+	for i := uint64(0); i < n; i++ {
+		f, err := c.bytes()
+		if err != nil {
+			return Hello{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("decode hello feature: %w", err))
+		}
+		h.Features = append(h.Features, string(f))
+	}
+
+	if c.remaining() != 0 {
+		return Hello{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("trailing bytes: %d", c.remaining()))
+	}
+	if len(h.Versions) == 0 {
+		return Hello{}, Wrap(CodeInvalidEnvelope, fmt.Errorf("hello advertises no core version"))
+	}
+	return h, nil
+}
+
+// NewHelloEnvelope builds a HELLO envelope. HELLO always uses envelope
+// version 1 so that peers can parse it before agreeing on a version.
+func NewHelloEnvelope(msgID []byte, ts uint64, h Hello) Envelope {
+	return Envelope{
+		Version:   1,
+		ProfileID: ProfileCore,
+		MsgType:   CoreMsgTypeHello,
+		TsUnixMs:  ts,
+		MsgID:     append([]byte(nil), msgID...),
+		Payload:   EncodeHelloPayload(h),
+	}
+}
+
+func IsHelloEnvelope(env Envelope) bool {
+	return env.ProfileID == ProfileCore && env.MsgType == CoreMsgTypeHello
+}
+
+// Negotiated is the outcome of a HELLO exchange as seen by one side. Peer
+// limits bound what this side may send.
+type Negotiated struct {
+	Version             uint64
+	Profiles            map[uint64]uint64
+	PeerMaxFrameBytes   uint32
+	PeerMaxPayloadBytes uint32
+	Features            map[string]struct{}
+}
+
+// Negotiate selects the highest shared core version, the shared profiles at
+// the lower of both versions, and the shared features.
+func Negotiate(local, remote Hello) (Negotiated, error) {
+	n := Negotiated{
+		Profiles:            make(map[uint64]uint64),
+		PeerMaxFrameBytes:   remote.MaxFrameBytes,
+		PeerMaxPayloadBytes: remote.MaxPayloadBytes,
+		Features:            make(map[string]struct{}),
+	}
+	for _, lv := range local.Versions {
+		for _, rv := range remote.Versions {
+			if lv == rv && lv > n.Version {
+				n.Version = lv
+			}
+		}
+	}
+	if n.Version == 0 {
+		return Negotiated{}, Wrap(CodeUnsupportedVersion, fmt.Errorf("no shared core version: local %v, remote %v", local.Versions, remote.Versions))
+	}
+
+	remoteProfiles := make(map[uint64]uint64, len(remote.Profiles))
+	for _, p := range remote.Profiles {
+		remoteProfiles[p.ProfileID] = p.Version
+	}
+	for _, p := range local.Profiles {
+		rv, ok := remoteProfiles[p.ProfileID]
+		if !ok {
+			continue
+		}
+		v := p.Version
+		if rv < v {
+			v = rv
+		}
+		n.Profiles[p.ProfileID] = v
+	}
+
+	remoteFeatures := make(map[string]struct{}, len(remote.Features))
+	for _, f := range remote.Features {
+		remoteFeatures[f] = struct{}{}
+	}
+	for _, f := range local.Features {
+		if _, ok := remoteFeatures[f]; ok {
+			n.Features[f] = struct{}{}
+		}
+	}
+	return n, nil
+}
+
+// CheckPeerPayload rejects env if its payload is larger than the peer's
+// advertised max_payload_bytes, which the peer would refuse.
+func CheckPeerPayload(env Envelope, peerMax uint32) error {
+	if uint64(len(env.Payload)) > uint64(peerMax) {
+		return Wrap(CodeInvalidEnvelope, fmt.Errorf("payload length %d exceeds peer max %d", len(env.Payload), peerMax))
+	}
+	return nil
+}
+
+func (n Negotiated) HasProfile(profileID uint64) bool {
+	_, ok := n.Profiles[profileID]
+	return ok
+}
+
+func (n Negotiated) HasFeature(f string) bool {
+	_, ok := n.Features[f]
+	return ok
+}
+
+// ProfileIDs lists the negotiated profiles in ascending order.
+func (n Negotiated) ProfileIDs() []uint64 {
+	out := make([]uint64, 0, len(n.Profiles))
+	for id := range n.Profiles {
+		out = append(out, id)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// Restrict narrows v to the negotiated version and profiles.
+func (n Negotiated) Restrict(v Validator) Validator {
+	v.Versions = map[uint64]struct{}{n.Version: {}}
+	known := make(map[uint64]struct{}, len(n.Profiles))
+	for id := range n.Profiles {
+		if _, ok := v.KnownProfiles[id]; ok || v.KnownProfiles == nil {
+			known[id] = struct{}{}
+		}
+	}
+	v.KnownProfiles = known
+	v.EnforceKnownProfile = true
+	return v
+}
+
+// count reads a uvarint element count, rejecting counts that cannot fit in
+// the remaining input.
+func (c *e1Cursor) count() (uint64, error) {
+	n, err := c.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(c.remaining()) {
+		return 0, fmt.Errorf("count %d exceeds remaining %d bytes", n, c.remaining())
+	}
+	return n, nil
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestHelloPayloadRoundTrip(t *testing.T) {
+	h := NewHello(DefaultLimits(), ProfileVersion{ProfileID: 1, Version: 1}, ProfileVersion{ProfileID: 12, Version: 2})
+	h.Versions = []uint64{1, 2}
+	got, err := DecodeHelloPayload(EncodeHelloPayload(h))
+	if err != nil {
+		t.Fatalf("DecodeHelloPayload failed: %v", err)
+	}
+	if len(got.Versions) != 2 || len(got.Profiles) != 2 || got.Profiles[1] != h.Profiles[1] {
+		t.Fatalf("round trip mismatch: %+v", got)
+	}
+	if got.MaxFrameBytes != DefaultMaxFrameBytes || len(got.Features) != len(h.Features) {
+		t.Fatalf("limits/features mismatch: %+v", got)
+	}
+}
+
+func TestDecodeHelloPayloadRejectsOversizedCount(t *testing.T) {
+	payload := binary.AppendUvarint(nil, 1<<40)
+	if _, err := DecodeHelloPayload(payload); CodeFromError(err) != CodeInvalidEnvelope {
+		t.Fatalf("expected INVALID_ENVELOPE, got %v", err)
+	}
+	if _, err := DecodeHelloPayload(EncodeHelloPayload(Hello{MaxFrameBytes: 1})); CodeFromError(err) != CodeInvalidEnvelope {
+		t.Fatalf("expected INVALID_ENVELOPE without versions, got %v", err)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	local := Hello{
+		Versions:      []uint64{1, 2},
+		Profiles:      []ProfileVersion{{1, 1}, {12, 3}, {13, 1}},
+		MaxFrameBytes: DefaultMaxFrameBytes,
+		Features:      []string{FeatureFragment, "x.feature"},
+	}
+	remote := Hello{
+		Versions:        []uint64{1, 2, 3},
+		Profiles:        []ProfileVersion{{12, 2}, {13, 1}, {99, 1}},
+		MaxFrameBytes:   4096,
+		MaxPayloadBytes: 2048,
+		Features:        []string{"x.feature"},
+	}
+	n, err := Negotiate(local, remote)
+	if err != nil {
+		t.Fatalf("Negotiate failed: %v", err)
+	}
+	if n.Version != 2 {
+		t.Fatalf("expected version 2, got %d", n.Version)
+	}
+	if ids := n.ProfileIDs(); len(ids) != 2 || ids[0] != 12 || ids[1] != 13 || n.Profiles[12] != 2 {
+		t.Fatalf("unexpected profiles: %v", n.Profiles)
+	}
+	if n.PeerMaxFrameBytes != 4096 || n.PeerMaxPayloadBytes != 2048 {
+		t.Fatalf("unexpected peer limits: %+v", n)
+	}
+	if !n.HasFeature("x.feature") || n.HasFeature(FeatureFragment) {
+		t.Fatalf("unexpected features: %v", n.Features)
+	}
+
+	remote.Versions = []uint64{3}
+	if _, err := Negotiate(local, remote); CodeFromError(err) != CodeUnsupportedVersion {
+		t.Fatalf("expected UNSUPPORTED_VERSION, got %v", err)
+	}
+}
+
+func TestNegotiatedRestrictValidator(t *testing.T) {
+	n := Negotiated{Version: 1, Profiles: map[uint64]uint64{12: 1}}
+	v := DefaultValidator()
+	v.KnownProfiles = map[uint64]struct{}{1: {}, 12: {}}
+	v = n.Restrict(v)
+
+	env := Envelope{Version: 1, ProfileID: 12, MsgType: 1, MsgID: []byte("abcdef1234567890")}
+	if err := v.ValidateEnvelope(env); err != nil {
+		t.Fatalf("expected negotiated profile to validate, got %v", err)
+	}
+	env.ProfileID = 1
+	if err := v.ValidateEnvelope(env); CodeFromError(err) != CodeUnknownProfile {
+		t.Fatalf("expected UNKNOWN_PROFILE for non-negotiated profile, got %v", err)
+	}
+}
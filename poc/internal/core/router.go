@@ -3,26 +3,164 @@ package core
 import (
 	"context"
 	"fmt"
+	"sort"
 )
 
 type Handler func(context.Context, Envelope) ([]Envelope, error)
 
+// Middleware wraps a Handler with cross-cutting behavior. Global middleware
+// runs outside per-profile middleware; within a scope, the first registered
+// middleware is outermost.
+type Middleware func(next Handler) Handler
+
+// Route describes one registered (profile_id, msg_type) pair. MsgType 0
+// denotes a profile-wide handler. Inbound is false for msg_types the profile
+// only emits; the router rejects them on dispatch.
+type Route struct {
+	ProfileID uint64
+	MsgType   uint64
+	Inbound   bool
+}
+
+type profileRoutes struct {
+	handler  Handler
+	msgTypes map[uint64]Handler
+
+	// chained holds each msg_type's handler wrapped in middleware, and
+	// fallback the wrapped profile-wide (or unsupported) handler. Both are
+	// rebuilt on registration so Dispatch does no wrapping.
+	chained  map[uint64]Handler
+	fallback Handler
+}
+
 type Router struct {
-	handlers map[uint64]Handler
+	handlers          map[uint64]*profileRoutes
+	middleware        []Middleware
+	profileMiddleware map[uint64][]Middleware
 }
 
 func NewRouter() *Router {
-	return &Router{handlers: make(map[uint64]Handler)}
+	return &Router{
+		handlers:          make(map[uint64]*profileRoutes),
+		profileMiddleware: make(map[uint64][]Middleware),
+	}
 }
 
+// Register installs a profile-wide handler that receives every msg_type not
+// claimed by RegisterMsgType or RegisterOutbound.
 func (r *Router) Register(profileID uint64, h Handler) {
-	r.handlers[profileID] = h
+	r.profile(profileID).handler = h
+	r.rebuild(profileID)
+}
+
+func (r *Router) RegisterMsgType(profileID, msgType uint64, h Handler) {
+	r.profile(profileID).msgTypes[msgType] = h
+	r.rebuild(profileID)
+}
+
+// RegisterOutbound declares msg_types the profile defines but only emits.
+func (r *Router) RegisterOutbound(profileID uint64, msgTypes ...uint64) {
+	p := r.profile(profileID)
+	for _, mt := range msgTypes {
+		p.msgTypes[mt] = nil
+	}
+	r.rebuild(profileID)
+}
+
+func (r *Router) profile(profileID uint64) *profileRoutes {
+	p, ok := r.handlers[profileID]
+	if !ok {
+		p = &profileRoutes{msgTypes: make(map[uint64]Handler)}
+		r.handlers[profileID] = p
+	}
+	return p
+}
+
+// Use adds middleware applied to every profile.
+func (r *Router) Use(mw ...Middleware) {
+	r.middleware = append(r.middleware, mw...)
+	for pid := range r.handlers {
+		r.rebuild(pid)
+	}
+}
+
+// UseProfile adds middleware applied only to profileID.
+func (r *Router) UseProfile(profileID uint64, mw ...Middleware) {
+	r.profileMiddleware[profileID] = append(r.profileMiddleware[profileID], mw...)
+	if _, ok := r.handlers[profileID]; ok {
+		r.rebuild(profileID)
+	}
 }
 
 func (r *Router) Dispatch(ctx context.Context, env Envelope) ([]Envelope, error) {
-	h, ok := r.handlers[env.ProfileID]
+	p, ok := r.handlers[env.ProfileID]
 	if !ok {
 		return nil, Wrap(CodeUnknownProfile, fmt.Errorf("unknown profile_id %d", env.ProfileID))
 	}
+	h, ok := p.chained[env.MsgType]
+	if !ok {
+		h = p.fallback
+	}
 	return h(ctx, env)
 }
+
+func unsupportedMsgType(_ context.Context, env Envelope) ([]Envelope, error) {
+	return nil, Wrap(CodeUnsupportedMsgType, fmt.Errorf("unsupported msg_type %d for profile_id %d", env.MsgType, env.ProfileID))
+}
+
+func (r *Router) rebuild(profileID uint64) {
+	p := r.handlers[profileID]
+	p.chained = make(map[uint64]Handler, len(p.msgTypes))
+	for mt, h := range p.msgTypes {
+		if h == nil {
+			h = unsupportedMsgType
+		}
+		p.chained[mt] = r.chain(profileID, h)
+	}
+	h := p.handler
+	if h == nil {
+		h = unsupportedMsgType
+	}
+	p.fallback = r.chain(profileID, h)
+}
+
+func (r *Router) chain(profileID uint64, h Handler) Handler {
+	scoped := r.profileMiddleware[profileID]
+	for i := len(scoped) - 1; i >= 0; i-- {
+		h = scoped[i](h)
+	}
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		h = r.middleware[i](h)
+	}
+	return h
+}
+
+// Routes lists every registration ordered by profile_id then msg_type.
+func (r *Router) Routes() []Route {
+	var out []Route
+	for pid, p := range r.handlers {
+		if p.handler != nil {
+			out = append(out, Route{ProfileID: pid, Inbound: true})
+		}
+		for mt, h := range p.msgTypes {
+			out = append(out, Route{ProfileID: pid, MsgType: mt, Inbound: h != nil})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ProfileID != out[j].ProfileID {
+			return out[i].ProfileID < out[j].ProfileID
+		}
+		return out[i].MsgType < out[j].MsgType
+	})
+	return out
+}
+
+// Profiles returns the registered profile_id set, suitable for
+// Validator.KnownProfiles.
+func (r *Router) Profiles() map[uint64]struct{} {
+	out := make(map[uint64]struct{}, len(r.handlers))
+	for pid := range r.handlers {
+		out[pid] = struct{}{}
+	}
+	return out
+}
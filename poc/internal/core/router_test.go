@@ -0,0 +1,139 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRouterMiddlewareOrder(t *testing.T) {
+	var trace []string
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, env Envelope) ([]Envelope, error) {
+				trace = append(trace, name)
+				return next(ctx, env)
+			}
+		}
+	}
+
+	r := NewRouter()
+	r.Register(1, func(context.Context, Envelope) ([]Envelope, error) {
+		trace = append(trace, "handler")
+		return nil, nil
+	})
+	r.Register(2, func(context.Context, Envelope) ([]Envelope, error) {
+		trace = append(trace, "handler")
+		return nil, nil
+	})
+	r.UseProfile(1, mark("profile-a"), mark("profile-b"))
+	r.Use(mark("global-a"), mark("global-b"))
+
+	if _, err := r.Dispatch(context.Background(), Envelope{ProfileID: 1}); err != nil {
+		t.Fatalf("dispatch profile 1: %v", err)
+	}
+	if got := strings.Join(trace, ","); got != "global-a,global-b,profile-a,profile-b,handler" {
+		t.Fatalf("unexpected profile 1 order: %s", got)
+	}
+
+	trace = nil
+	if _, err := r.Dispatch(context.Background(), Envelope{ProfileID: 2}); err != nil {
+		t.Fatalf("dispatch profile 2: %v", err)
+	}
+	if got := strings.Join(trace, ","); got != "global-a,global-b,handler" {
+		t.Fatalf("unexpected profile 2 order: %s", got)
+	}
+}
+
+func TestRouterUnknownProfile(t *testing.T) {
+	r := NewRouter()
+	_, err := r.Dispatch(context.Background(), Envelope{ProfileID: 7})
+	if CodeFromError(err) != CodeUnknownProfile {
+		t.Fatalf("expected UNKNOWN_PROFILE, got %v", err)
+	}
+}
+
+func TestRouterMsgTypeRouting(t *testing.T) {
+	r := NewRouter()
+	r.RegisterMsgType(1, 1, func(context.Context, Envelope) ([]Envelope, error) {
+		return []Envelope{{MsgType: 2}}, nil
+	})
+	r.RegisterOutbound(1, 2)
+
+	out, err := r.Dispatch(context.Background(), Envelope{ProfileID: 1, MsgType: 1})
+	if err != nil || len(out) != 1 {
+		t.Fatalf("expected routed response, got %v %v", out, err)
+	}
+	for _, mt := range []uint64{2, 3} {
+		_, err := r.Dispatch(context.Background(), Envelope{ProfileID: 1, MsgType: mt})
+		if CodeFromError(err) != CodeUnsupportedMsgType {
+			t.Fatalf("msg_type %d: expected UNSUPPORTED_MSG_TYPE, got %v", mt, err)
+		}
+	}
+
+	r.Register(1, func(context.Context, Envelope) ([]Envelope, error) { return nil, nil })
+	if _, err := r.Dispatch(context.Background(), Envelope{ProfileID: 1, MsgType: 3}); err != nil {
+		t.Fatalf("expected profile-wide fallback for msg_type 3, got %v", err)
+	}
+	if _, err := r.Dispatch(context.Background(), Envelope{ProfileID: 1, MsgType: 2}); CodeFromError(err) != CodeUnsupportedMsgType {
+		t.Fatalf("expected outbound msg_type to stay rejected, got %v", err)
+	}
+}
+
+func TestRouterRoutesIntrospection(t *testing.T) {
+	r := NewRouter()
+	noop := func(context.Context, Envelope) ([]Envelope, error) { return nil, nil }
+	r.RegisterMsgType(2, 1, noop)
+	r.RegisterOutbound(2, 2)
+	r.Register(1, noop)
+
+	want := []Route{
+		{ProfileID: 1, MsgType: 0, Inbound: true},
+		{ProfileID: 2, MsgType: 1, Inbound: true},
+		{ProfileID: 2, MsgType: 2, Inbound: false},
+	}
+	got := r.Routes()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d routes, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("route %d: got %+v want %+v", i, got[i], want[i])
+		}
+	}
+	if p := r.Profiles(); len(p) != 2 {
+		t.Fatalf("expected 2 profiles, got %v", p)
+	}
+}
+
+func TestRouterChainsOnRegistration(t *testing.T) {
+	var wraps int
+	mw := func(next Handler) Handler {
+		wraps++
+		return next
+	}
+
+	r := NewRouter()
+	r.Use(mw)
+	r.RegisterMsgType(1, 1, func(context.Context, Envelope) ([]Envelope, error) { return nil, nil })
+	built := wraps
+	for i := 0; i < 3; i++ {
+		if _, err := r.Dispatch(context.Background(), Envelope{ProfileID: 1, MsgType: 1}); err != nil {
+			t.Fatalf("dispatch: %v", err)
+		}
+	}
+	if wraps != built {
+		t.Fatalf("dispatch rebuilt the chain: %d wraps after registration, %d after dispatch", built, wraps)
+	}
+
+	var late bool
+	r.UseProfile(1, func(next Handler) Handler {
+		return func(ctx context.Context, env Envelope) ([]Envelope, error) {
+			late = true
+			return next(ctx, env)
+		}
+	})
+	if _, err := r.Dispatch(context.Background(), Envelope{ProfileID: 1, MsgType: 1}); err != nil || !late {
+		t.Fatalf("middleware added after registration did not run: %v", err)
+	}
+}
@@ -23,23 +23,33 @@ type Limits struct {
 	MinMsgIDBytes   int
 	MaxMsgIDBytes   int
 	MaxExtBytes     int
+	// MaxExtValueBytes bounds a single extension value under StrictE1;
+	// 0 leaves only MaxExtBytes.
+	MaxExtValueBytes int
+
+	// StrictE1 rejects non-minimal uvarints, duplicate or non-ascending
+	// extension types and extension values over MaxExtValueBytes, so that
+	// each envelope has exactly one accepted encoding.
+	StrictE1 bool
 }
 
 const (
-	CoreVersion           = 1
-	DefaultMaxFrameBytes  = 8 * 1024 * 1024
-	DefaultMinMsgIDBytes  = 8
-	DefaultMaxMsgIDBytes  = 64
-	DefaultMaxExtBytes    = 4096
-	DefaultMaxClockSkewMs = 300000
+	CoreVersion             = 1
+	DefaultMaxFrameBytes    = 8 * 1024 * 1024
+	DefaultMinMsgIDBytes    = 8
+	DefaultMaxMsgIDBytes    = 64
+	DefaultMaxExtBytes      = 4096
+	DefaultMaxExtValueBytes = 1024
+	DefaultMaxClockSkewMs   = 300000
 )
 
 func DefaultLimits() Limits {
 	return Limits{
-		MaxFrameBytes:   DefaultMaxFrameBytes,
-		MaxPayloadBytes: DefaultMaxFrameBytes,
-		MinMsgIDBytes:   DefaultMinMsgIDBytes,
-		MaxMsgIDBytes:   DefaultMaxMsgIDBytes,
-		MaxExtBytes:     DefaultMaxExtBytes,
+		MaxFrameBytes:    DefaultMaxFrameBytes,
+		MaxPayloadBytes:  DefaultMaxFrameBytes,
+		MinMsgIDBytes:    DefaultMinMsgIDBytes,
+		MaxMsgIDBytes:    DefaultMaxMsgIDBytes,
+		MaxExtBytes:      DefaultMaxExtBytes,
+		MaxExtValueBytes: DefaultMaxExtValueBytes,
 	}
 }
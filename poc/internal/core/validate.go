@@ -8,9 +8,16 @@ import (
 type Validator struct {
 	Limits Limits
 
+	// Versions lists accepted core versions; nil accepts only CoreVersion.
+	Versions map[uint64]struct{}
+
 	KnownProfiles       map[uint64]struct{}
 	EnforceKnownProfile bool
 
+	// Extensions, when set, enforces per-type extension limits and rejects
+	// unknown critical extensions.
+	Extensions *ExtensionRegistry
+
 	EnforceTimestamp bool
 	AllowZeroTS      bool
 	MaxClockSkew     time.Duration
@@ -21,6 +28,7 @@ func DefaultValidator() Validator {
 	return Validator{
 		Limits:              DefaultLimits(),
 		EnforceKnownProfile: true,
+		Extensions:          DefaultExtensionRegistry(),
 		EnforceTimestamp:    false,
 		AllowZeroTS:         true,
 		MaxClockSkew:        5 * time.Minute,
@@ -29,7 +37,7 @@ func DefaultValidator() Validator {
 }
 
 func (v Validator) ValidateEnvelope(env Envelope) error {
-	if env.Version != CoreVersion {
+	if !v.versionSupported(env.Version) {
 		return Wrap(CodeUnsupportedVersion, fmt.Errorf("unsupported version %d", env.Version))
 	}
 
@@ -51,6 +59,18 @@ func (v Validator) ValidateEnvelope(env Envelope) error {
 		return Wrap(CodeInvalidEnvelope, fmt.Errorf("payload length %d exceeds max %d", len(env.Payload), v.Limits.MaxPayloadBytes))
 	}
 
+	if v.Limits.StrictE1 {
+		if err := checkCanonicalExtensions(env.Extensions, v.Limits); err != nil {
+			return err
+		}
+	}
+
+	if v.Extensions != nil {
+		if err := v.Extensions.Validate(env.Extensions); err != nil {
+			return err
+		}
+	}
+
 	if v.EnforceTimestamp {
 		if env.TsUnixMs == 0 {
 			if !v.AllowZeroTS {
@@ -71,3 +91,11 @@ func (v Validator) ValidateEnvelope(env Envelope) error {
 
 	return nil
 }
+
+func (v Validator) versionSupported(version uint64) bool {
+	if v.Versions == nil {
+		return version == CoreVersion
+	}
+	_, ok := v.Versions[version]
+	return ok
+}
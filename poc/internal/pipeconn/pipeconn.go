@@ -0,0 +1,105 @@
+// Package pipeconn presents byte streams that are not network connections,
+// such as stdin/stdout or a subprocess's pipes, as net.Conn so they can carry
+// SWP frames through the same readers, writers and deadlines as sockets.
+package pipeconn
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// Addr is the address of a pipe; it names the stream, not a peer.
+type Addr string
+
+func (a Addr) Network() string { return "pipe" }
+func (a Addr) String() string  { return string(a) }
+
+type readDeadliner interface {
+	SetReadDeadline(time.Time) error
+}
+
+type writeDeadliner interface {
+	SetWriteDeadline(time.Time) error
+}
+
+// conn adapts an io.ReadWriteCloser. Deadlines are passed on when the
+// stream supports them, as *os.File does for pipes, and otherwise fail with
+// os.ErrNoDeadline.
+type conn struct {
+	io.ReadWriteCloser
+	r    io.Reader
+	w    io.Writer
+	addr Addr
+}
+
+// New returns rwc itself if it is a net.Conn, otherwise an adapter whose
+// local and remote addresses are both name.
+func New(rwc io.ReadWriteCloser, name string) net.Conn {
+	if c, ok := rwc.(net.Conn); ok {
+		return c
+	}
+	c := &conn{ReadWriteCloser: rwc, r: rwc, w: rwc, addr: Addr(name)}
+	if s, ok := rwc.(*joined); ok {
+		c.r, c.w = s.in, s.out
+	}
+	return c
+}
+
+func (c *conn) LocalAddr() net.Addr  { return c.addr }
+func (c *conn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *conn) SetDeadline(t time.Time) error {
+	return errors.Join(c.SetReadDeadline(t), c.SetWriteDeadline(t))
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	if d, ok := c.r.(readDeadliner); ok {
+		return d.SetReadDeadline(t)
+	}
+	return os.ErrNoDeadline
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	if d, ok := c.w.(writeDeadliner); ok {
+		return d.SetWriteDeadline(t)
+	}
+	return os.ErrNoDeadline
+}
+
+// joined joins a reader and a writer into one stream.
+type joined struct {
+	in  io.ReadCloser
+	out io.WriteCloser
+}
+
+// Join returns a stream reading from in and writing to out. Closing it
+// closes out, so the peer sees end of stream, then in.
+func Join(in io.ReadCloser, out io.WriteCloser) io.ReadWriteCloser {
+	return &joined{in: in, out: out}
+}
+
+// Stdio returns the process's stdin and stdout as one stream. Stdin is
+// usually a blocking descriptor that supports no deadlines and whose reads
+// Close cannot interrupt, so it is relayed through a pipe that does.
+func Stdio() io.ReadWriteCloser {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return Join(os.Stdin, os.Stdout)
+	}
+	stdin := os.Stdin
+	go func() {
+		_, _ = io.Copy(pw, stdin)
+		_ = pw.Close()
+	}()
+	return Join(pr, os.Stdout)
+}
+
+func (s *joined) Read(p []byte) (int, error)  { return s.in.Read(p) }
+func (s *joined) Write(p []byte) (int, error) { return s.out.Write(p) }
+
+func (s *joined) Close() error {
+	return errors.Join(s.out.Close(), s.in.Close())
+}
@@ -0,0 +1,54 @@
+package pipeconn
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStdioDeadlineAndClose(t *testing.T) {
+	stdin, stdinW, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	defer stdinW.Close()
+	stdoutR, stdout, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	defer stdoutR.Close()
+	// Fd puts the pipe in blocking mode, like a stdin inherited from a
+	// parent process.
+	stdin.Fd()
+	oldIn, oldOut := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdin, stdout
+	c := New(Stdio(), "stdio")
+	os.Stdin, os.Stdout = oldIn, oldOut
+
+	if err := c.SetReadDeadline(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatalf("set read deadline: %v", err)
+	}
+	if _, err := c.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	_ = c.SetReadDeadline(time.Time{})
+	read := make(chan error, 1)
+	go func() {
+		_, err := c.Read(make([]byte, 1))
+		read <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := c.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	select {
+	case err := <-read:
+		if err == nil {
+			t.Fatalf("expected read error after close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("close did not interrupt a blocked read")
+	}
+}
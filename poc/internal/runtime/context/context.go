@@ -17,8 +17,19 @@ type Correlation struct {
 	RPCID       []byte
 }
 
+// PeerIdentity is the authenticated channel identity of the connection
+// (S1). ID is the canonical value used for authorization; the remaining
+// fields are audit context.
+type PeerIdentity struct {
+	ID          string
+	Subject     string
+	Issuer      string
+	Fingerprint string
+}
+
 type messageMetaKey struct{}
 type correlationKey struct{}
+type peerIdentityKey struct{}
 
 func WithMessageMeta(ctx context.Context, m MessageMeta) context.Context {
 	return context.WithValue(ctx, messageMetaKey{}, MessageMeta{
@@ -58,3 +69,12 @@ func CorrelationFromContext(ctx context.Context) (Correlation, bool) {
 	c.RPCID = append([]byte(nil), c.RPCID...)
 	return c, true
 }
+
+func WithPeerIdentity(ctx context.Context, id PeerIdentity) context.Context {
+	return context.WithValue(ctx, peerIdentityKey{}, id)
+}
+
+func PeerIdentityFromContext(ctx context.Context) (PeerIdentity, bool) {
+	id, ok := ctx.Value(peerIdentityKey{}).(PeerIdentity)
+	return id, ok
+}
@@ -0,0 +1,144 @@
+package context
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"swp-spec-kit/poc/internal/core"
+)
+
+// ErrPushUnsupported is returned by Send on a session whose transport has no
+// outbound queue.
+var ErrPushUnsupported = errors.New("session does not support server push")
+
+// Credential records a credential presented and accepted on a session.
+type Credential struct {
+	Type    string
+	ChainID []byte
+}
+
+// PolicyHint records a constraint a peer set on a session.
+type PolicyHint struct {
+	Key      string
+	Value    string
+	Mode     string
+	ScopeRef string
+}
+
+// Session describes one connection. The server creates it when the
+// connection is accepted and every request on that connection shares it.
+// ID, RemoteAddr and Peer are fixed; the remaining state is learned from the
+// peer's messages and is safe for concurrent use.
+type Session struct {
+	ID         string
+	RemoteAddr string
+	// Peer is the authenticated channel identity; its ID is empty when the
+	// channel did not authenticate the peer.
+	Peer PeerIdentity
+
+	push func(context.Context, core.Envelope) error
+
+	mu           sync.RWMutex
+	capabilities core.Negotiated
+	negotiated   bool
+	credentials  []Credential
+	agentID      string
+	policyHints  map[string]PolicyHint
+}
+
+func NewSession(id, remoteAddr string, peer PeerIdentity) *Session {
+	return &Session{ID: id, RemoteAddr: remoteAddr, Peer: peer, policyHints: make(map[string]PolicyHint)}
+}
+
+// SetSender installs the function Send queues envelopes with. The server
+// calls it once, before the session is shared.
+func (s *Session) SetSender(push func(context.Context, core.Envelope) error) {
+	s.push = push
+}
+
+// Send queues env for delivery to the peer outside any request/response
+// exchange. It may be called from any goroutine, including after the
+// request that obtained the session has returned. Missing version, msg_id
+// and timestamp are filled in. Whether a full queue drops, blocks (until
+// ctx is done) or disconnects is the server's slow-consumer policy.
+func (s *Session) Send(ctx context.Context, env core.Envelope) error {
+	if s.push == nil {
+		return ErrPushUnsupported
+	}
+	return s.push(ctx, env)
+}
+
+// SetCapabilities records the result of the core HELLO exchange.
+func (s *Session) SetCapabilities(n core.Negotiated) {
+	s.mu.Lock()
+	s.capabilities = n
+	s.negotiated = true
+	s.mu.Unlock()
+}
+
+// Capabilities returns the negotiated HELLO result, if a HELLO was
+// exchanged.
+func (s *Session) Capabilities() (core.Negotiated, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.capabilities, s.negotiated
+}
+
+func (s *Session) AddCredential(c Credential) {
+	c.ChainID = append([]byte(nil), c.ChainID...)
+	s.mu.Lock()
+	s.credentials = append(s.credentials, c)
+	s.mu.Unlock()
+}
+
+func (s *Session) Credentials() []Credential {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Credential, len(s.credentials))
+	for i, c := range s.credentials {
+		out[i] = Credential{Type: c.Type, ChainID: append([]byte(nil), c.ChainID...)}
+	}
+	return out
+}
+
+// SetAgentID records the agent_id announced by an A2A handshake.
+func (s *Session) SetAgentID(agentID string) {
+	s.mu.Lock()
+	s.agentID = agentID
+	s.mu.Unlock()
+}
+
+func (s *Session) AgentID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.agentID
+}
+
+// SetPolicyHint records h, replacing any hint with the same key.
+func (s *Session) SetPolicyHint(h PolicyHint) {
+	s.mu.Lock()
+	s.policyHints[h.Key] = h
+	s.mu.Unlock()
+}
+
+func (s *Session) PolicyHints() map[string]PolicyHint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]PolicyHint, len(s.policyHints))
+	for k, h := range s.policyHints {
+		out[k] = h
+	}
+	return out
+}
+
+type sessionKey struct{}
+
+func WithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(sessionKey{}).(*Session)
+	return s, ok && s != nil
+}
@@ -20,13 +20,13 @@ func TestHandleA2ALifecycleSuccess(t *testing.T) {
 	if err != nil {
 		t.Fatalf("encode handshake payload: %v", err)
 	}
-	_, err = handleA2A(context.Background(), core.Envelope{
+	_, err = route(context.Background(), core.Envelope{
 		Version:   core.CoreVersion,
 		ProfileID: ProfileA2A,
 		MsgType:   a2aMsgTypeHandshake,
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   hsPayload,
-	})
+	}, a2aHandlers(defaultBackends.a2a))
 	if err != nil {
 		t.Fatalf("handshake failed: %v", err)
 	}
@@ -35,13 +35,13 @@ func TestHandleA2ALifecycleSuccess(t *testing.T) {
 	if err != nil {
 		t.Fatalf("encode task payload: %v", err)
 	}
-	out, err := handleA2A(context.Background(), core.Envelope{
+	out, err := route(context.Background(), core.Envelope{
 		Version:   core.CoreVersion,
 		ProfileID: ProfileA2A,
 		MsgType:   a2aMsgTypeTask,
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   taskPayload,
-	})
+	}, a2aHandlers(defaultBackends.a2a))
 	if err != nil {
 		t.Fatalf("task failed: %v", err)
 	}
@@ -53,13 +53,13 @@ func TestHandleA2ALifecycleSuccess(t *testing.T) {
 	if err != nil {
 		t.Fatalf("encode event payload: %v", err)
 	}
-	_, err = handleA2A(context.Background(), core.Envelope{
+	_, err = route(context.Background(), core.Envelope{
 		Version:   core.CoreVersion,
 		ProfileID: ProfileA2A,
 		MsgType:   a2aMsgTypeEvent,
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   eventPayload,
-	})
+	}, a2aHandlers(defaultBackends.a2a))
 	if err != nil {
 		t.Fatalf("event failed: %v", err)
 	}
@@ -68,13 +68,13 @@ func TestHandleA2ALifecycleSuccess(t *testing.T) {
 	if err != nil {
 		t.Fatalf("encode result payload: %v", err)
 	}
-	_, err = handleA2A(context.Background(), core.Envelope{
+	_, err = route(context.Background(), core.Envelope{
 		Version:   core.CoreVersion,
 		ProfileID: ProfileA2A,
 		MsgType:   a2aMsgTypeResult,
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   resultPayload,
-	})
+	}, a2aHandlers(defaultBackends.a2a))
 	if err != nil {
 		t.Fatalf("result failed: %v", err)
 	}
@@ -84,13 +84,13 @@ func TestHandleA2AEventBeforeTaskRejected(t *testing.T) {
 	resetA2ATasks(t)
 
 	eventPayload, _ := p1a2a.EncodePayloadEvent(p1a2a.Event{TaskID: []byte("missing-task"), Message: "running"})
-	_, err := handleA2A(context.Background(), core.Envelope{
+	_, err := route(context.Background(), core.Envelope{
 		Version:   core.CoreVersion,
 		ProfileID: ProfileA2A,
 		MsgType:   a2aMsgTypeEvent,
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   eventPayload,
-	})
+	}, a2aHandlers(defaultBackends.a2a))
 	if err == nil {
 		t.Fatalf("expected event-before-task rejection")
 	}
@@ -105,24 +105,24 @@ func TestHandleA2ADuplicateTaskConflictRejected(t *testing.T) {
 	payload1, _ := p1a2a.EncodePayloadTask(p1a2a.Task{TaskID: []byte("task-1"), Kind: "demo.run", Input: []byte("a")})
 	payload2, _ := p1a2a.EncodePayloadTask(p1a2a.Task{TaskID: []byte("task-1"), Kind: "demo.run", Input: []byte("b")})
 
-	_, err := handleA2A(context.Background(), core.Envelope{
+	_, err := route(context.Background(), core.Envelope{
 		Version:   core.CoreVersion,
 		ProfileID: ProfileA2A,
 		MsgType:   a2aMsgTypeTask,
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   payload1,
-	})
+	}, a2aHandlers(defaultBackends.a2a))
 	if err != nil {
 		t.Fatalf("first task failed: %v", err)
 	}
 
-	_, err = handleA2A(context.Background(), core.Envelope{
+	_, err = route(context.Background(), core.Envelope{
 		Version:   core.CoreVersion,
 		ProfileID: ProfileA2A,
 		MsgType:   a2aMsgTypeTask,
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   payload2,
-	})
+	}, a2aHandlers(defaultBackends.a2a))
 	if err == nil {
 		t.Fatalf("expected conflicting duplicate task rejection")
 	}
@@ -135,10 +135,10 @@ func TestHandleA2APostTerminalEventRejected(t *testing.T) {
 	resultPayload, _ := p1a2a.EncodePayloadResult(p1a2a.Result{TaskID: []byte("task-1"), OK: true, Output: []byte("ok")})
 	eventPayload, _ := p1a2a.EncodePayloadEvent(p1a2a.Event{TaskID: []byte("task-1"), Message: "late"})
 
-	_, _ = handleA2A(context.Background(), core.Envelope{Version: core.CoreVersion, ProfileID: ProfileA2A, MsgType: a2aMsgTypeTask, MsgID: []byte("12345678abcdefgh"), Payload: taskPayload})
-	_, _ = handleA2A(context.Background(), core.Envelope{Version: core.CoreVersion, ProfileID: ProfileA2A, MsgType: a2aMsgTypeResult, MsgID: []byte("12345678abcdefgh"), Payload: resultPayload})
+	_, _ = route(context.Background(), core.Envelope{Version: core.CoreVersion, ProfileID: ProfileA2A, MsgType: a2aMsgTypeTask, MsgID: []byte("12345678abcdefgh"), Payload: taskPayload}, a2aHandlers(defaultBackends.a2a))
+	_, _ = route(context.Background(), core.Envelope{Version: core.CoreVersion, ProfileID: ProfileA2A, MsgType: a2aMsgTypeResult, MsgID: []byte("12345678abcdefgh"), Payload: resultPayload}, a2aHandlers(defaultBackends.a2a))
 
-	_, err := handleA2A(context.Background(), core.Envelope{Version: core.CoreVersion, ProfileID: ProfileA2A, MsgType: a2aMsgTypeEvent, MsgID: []byte("12345678abcdefgh"), Payload: eventPayload})
+	_, err := route(context.Background(), core.Envelope{Version: core.CoreVersion, ProfileID: ProfileA2A, MsgType: a2aMsgTypeEvent, MsgID: []byte("12345678abcdefgh"), Payload: eventPayload}, a2aHandlers(defaultBackends.a2a))
 	if err == nil {
 		t.Fatalf("expected post-terminal event rejection")
 	}
@@ -148,13 +148,13 @@ func TestHandleA2AUnsupportedCapabilityReturnsResultFailure(t *testing.T) {
 	resetA2ATasks(t)
 
 	taskPayload, _ := p1a2a.EncodePayloadTask(p1a2a.Task{TaskID: []byte("task-unsupported"), Kind: "unsupported.capability", Input: []byte("a")})
-	out, err := handleA2A(context.Background(), core.Envelope{
+	out, err := route(context.Background(), core.Envelope{
 		Version:   core.CoreVersion,
 		ProfileID: ProfileA2A,
 		MsgType:   a2aMsgTypeTask,
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   taskPayload,
-	})
+	}, a2aHandlers(defaultBackends.a2a))
 	if err != nil {
 		t.Fatalf("task failed unexpectedly: %v", err)
 	}
@@ -16,21 +16,15 @@ const (
 	agdiscMsgTypeErr         = 4
 )
 
-func handleSWPAGDISC(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
-	return handleSWPAGDISCWithBackend(ctx, env, defaultBackends.agdisc)
-}
-
-func (s *Server) handleSWPAGDISC(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
-	return handleSWPAGDISCWithBackend(ctx, env, s.runtime.agdisc)
+func agdiscHandlers(b AGDISCBackend) map[uint64]core.Handler {
+	return map[uint64]core.Handler{
+		agdiscMsgTypeGet: withBackend(b, handleAGDISCGet),
+	}
 }
 
-func handleSWPAGDISCWithBackend(_ context.Context, env core.Envelope, backend AGDISCBackend) ([]core.Envelope, error) {
+func handleAGDISCGet(_ context.Context, env core.Envelope, backend AGDISCBackend) ([]core.Envelope, error) {
 	now := uint64(time.Now().UnixMilli())
 
-	if env.MsgType != agdiscMsgTypeGet {
-		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid AGDISC msg_type %d", env.MsgType))
-	}
-
 	req, err := p1agdisc.DecodePayloadGet(env.Payload)
 	if err != nil {
 		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid AGDISC get payload: %w", err))
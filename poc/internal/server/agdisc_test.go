@@ -23,9 +23,9 @@ func TestHandleSWPAGDISCGetDoc(t *testing.T) {
 		Payload:   payload,
 	}
 
-	out, err := handleSWPAGDISC(context.Background(), env)
+	out, err := route(context.Background(), env, agdiscHandlers(defaultBackends.agdisc))
 	if err != nil {
-		t.Fatalf("handleSWPAGDISC failed: %v", err)
+		t.Fatalf("AGDISC get failed: %v", err)
 	}
 	if len(out) != 1 {
 		t.Fatalf("expected 1 response, got %d", len(out))
@@ -62,9 +62,9 @@ func TestHandleSWPAGDISCNotModified(t *testing.T) {
 		Payload:   payload,
 	}
 
-	out, err := handleSWPAGDISC(context.Background(), env)
+	out, err := route(context.Background(), env, agdiscHandlers(defaultBackends.agdisc))
 	if err != nil {
-		t.Fatalf("handleSWPAGDISC failed: %v", err)
+		t.Fatalf("AGDISC get failed: %v", err)
 	}
 	if len(out) != 1 {
 		t.Fatalf("expected 1 response, got %d", len(out))
@@ -89,9 +89,9 @@ func TestHandleSWPAGDISCNotFound(t *testing.T) {
 		Payload:   payload,
 	}
 
-	out, err := handleSWPAGDISC(context.Background(), env)
+	out, err := route(context.Background(), env, agdiscHandlers(defaultBackends.agdisc))
 	if err != nil {
-		t.Fatalf("handleSWPAGDISC failed: %v", err)
+		t.Fatalf("AGDISC get failed: %v", err)
 	}
 	if len(out) != 1 {
 		t.Fatalf("expected 1 response, got %d", len(out))
@@ -48,7 +48,7 @@ func TestHandleSWPArtifactOfferChunkGet(t *testing.T) {
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   offerPayload,
 	}
-	out, err := handleSWPArtifact(context.Background(), offerEnv)
+	out, err := route(context.Background(), offerEnv, artifactHandlers(defaultBackends.artifact))
 	if err != nil {
 		t.Fatalf("offer failed: %v", err)
 	}
@@ -73,7 +73,7 @@ func TestHandleSWPArtifactOfferChunkGet(t *testing.T) {
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   chunkPayload,
 	}
-	out, err = handleSWPArtifact(context.Background(), chunkEnv)
+	out, err = route(context.Background(), chunkEnv, artifactHandlers(defaultBackends.artifact))
 	if err != nil {
 		t.Fatalf("chunk failed: %v", err)
 	}
@@ -92,7 +92,7 @@ func TestHandleSWPArtifactOfferChunkGet(t *testing.T) {
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   getPayload,
 	}
-	out, err = handleSWPArtifact(context.Background(), getEnv)
+	out, err = route(context.Background(), getEnv, artifactHandlers(defaultBackends.artifact))
 	if err != nil {
 		t.Fatalf("get failed: %v", err)
 	}
@@ -111,22 +111,22 @@ func TestHandleSWPArtifactOfferChunkGet(t *testing.T) {
 func TestHandleSWPArtifactChunkOrderingError(t *testing.T) {
 	resetArtifactState(t)
 	offerPayload, _ := p1artifact.EncodePayloadOffer(p1artifact.ArtOffer{ArtifactID: "artifact-2", TotalSize: 1})
-	_, _ = handleSWPArtifact(context.Background(), core.Envelope{
+	_, _ = route(context.Background(), core.Envelope{
 		Version:   core.CoreVersion,
 		ProfileID: ProfileSWPArtifact,
 		MsgType:   artifactMsgTypeOffer,
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   offerPayload,
-	})
+	}, artifactHandlers(defaultBackends.artifact))
 
 	chunkPayload, _ := p1artifact.EncodePayloadChunk(p1artifact.ArtChunk{ArtifactID: "artifact-2", ChunkIndex: 1, Data: []byte("x")})
-	out, err := handleSWPArtifact(context.Background(), core.Envelope{
+	out, err := route(context.Background(), core.Envelope{
 		Version:   core.CoreVersion,
 		ProfileID: ProfileSWPArtifact,
 		MsgType:   artifactMsgTypeChunk,
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   chunkPayload,
-	})
+	}, artifactHandlers(defaultBackends.artifact))
 	if err != nil {
 		t.Fatalf("chunk ordering failed unexpectedly: %v", err)
 	}
@@ -158,7 +158,7 @@ func TestHandleSWPStatePutAndGet(t *testing.T) {
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   putPayload,
 	}
-	out, err := handleSWPState(context.Background(), putEnv)
+	out, err := route(context.Background(), putEnv, stateHandlers(defaultBackends.state))
 	if err != nil {
 		t.Fatalf("state put failed: %v", err)
 	}
@@ -177,7 +177,7 @@ func TestHandleSWPStatePutAndGet(t *testing.T) {
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   getPayload,
 	}
-	out, err = handleSWPState(context.Background(), getEnv)
+	out, err = route(context.Background(), getEnv, stateHandlers(defaultBackends.state))
 	if err != nil {
 		t.Fatalf("state get failed: %v", err)
 	}
@@ -197,13 +197,13 @@ func TestHandleSWPStateHashMismatchRejected(t *testing.T) {
 	resetStateStore(t)
 
 	putPayload, _ := p1state.EncodePayloadPut(p1state.StatePut{StateID: []byte("bad"), Blob: []byte("state")})
-	_, err := handleSWPState(context.Background(), core.Envelope{
+	_, err := route(context.Background(), core.Envelope{
 		Version:   core.CoreVersion,
 		ProfileID: ProfileSWPState,
 		MsgType:   stateMsgTypePut,
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   putPayload,
-	})
+	}, stateHandlers(defaultBackends.state))
 	if err == nil {
 		t.Fatalf("expected hash mismatch error")
 	}
@@ -230,7 +230,7 @@ func TestHandleSWPCredLifecycle(t *testing.T) {
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   presentPayload,
 	}
-	out, err := handleSWPCred(context.Background(), presentEnv)
+	out, err := route(context.Background(), presentEnv, credHandlers(defaultBackends.cred))
 	if err != nil {
 		t.Fatalf("present failed: %v", err)
 	}
@@ -253,7 +253,7 @@ func TestHandleSWPCredLifecycle(t *testing.T) {
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   delegatePayload,
 	}
-	out, err = handleSWPCred(context.Background(), delegateEnv)
+	out, err = route(context.Background(), delegateEnv, credHandlers(defaultBackends.cred))
 	if err != nil {
 		t.Fatalf("delegate failed: %v", err)
 	}
@@ -265,18 +265,18 @@ func TestHandleSWPCredLifecycle(t *testing.T) {
 	if err != nil {
 		t.Fatalf("encode revoke payload: %v", err)
 	}
-	_, err = handleSWPCred(context.Background(), core.Envelope{
+	_, err = route(context.Background(), core.Envelope{
 		Version:   core.CoreVersion,
 		ProfileID: ProfileSWPCred,
 		MsgType:   credMsgTypeRevoke,
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   revokePayload,
-	})
+	}, credHandlers(defaultBackends.cred))
 	if err != nil {
 		t.Fatalf("revoke failed: %v", err)
 	}
 
-	out, err = handleSWPCred(context.Background(), presentEnv)
+	out, err = route(context.Background(), presentEnv, credHandlers(defaultBackends.cred))
 	if err != nil {
 		t.Fatalf("present after revoke failed unexpectedly: %v", err)
 	}
@@ -293,17 +293,17 @@ func TestHandleSWPCredLifecycle(t *testing.T) {
 }
 
 func TestHandleSWPCredUnsupportedMsgType(t *testing.T) {
-	_, err := handleSWPCred(context.Background(), core.Envelope{
+	_, err := route(context.Background(), core.Envelope{
 		Version:   core.CoreVersion,
 		ProfileID: ProfileSWPCred,
 		MsgType:   99,
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   []byte{0x0a, 0x00},
-	})
+	}, credHandlers(defaultBackends.cred))
 	if err == nil {
 		t.Fatalf("expected unsupported msg_type error")
 	}
-	if core.CodeFromError(err) != core.CodeInvalidEnvelope {
-		t.Fatalf("expected INVALID_ENVELOPE, got %s", core.CodeFromError(err))
+	if core.CodeFromError(err) != core.CodeUnsupportedMsgType {
+		t.Fatalf("expected UNSUPPORTED_MSG_TYPE, got %s", core.CodeFromError(err))
 	}
 }
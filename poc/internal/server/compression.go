@@ -0,0 +1,29 @@
+package server
+
+import "swp-spec-kit/poc/internal/core"
+
+// negotiateResponses applies payload-codec negotiation to the responses for
+// req. Peers that advertise ExtAcceptCodecs learn the server's codecs on
+// every response, and response payloads of at least the configured size are
+// compressed with the first codec both sides support. Peers that advertise
+// nothing receive responses unchanged.
+func (s *Server) negotiateResponses(req core.Envelope, responses []core.Envelope) []core.Envelope {
+	offered, err := core.AcceptedCodecs(req)
+	if err != nil || offered == nil {
+		return responses
+	}
+	codec, ok := core.NegotiateCodec(offered, core.SupportedCodecs())
+	for i, resp := range responses {
+		resp = core.WithAcceptedCodecs(resp, core.SupportedCodecs())
+		if ok && s.compressMinBytes > 0 {
+			compressed, err := core.CompressPayload(resp, codec, s.compressMinBytes)
+			if err != nil {
+				s.logger.Printf("compress response error: %v", err)
+			} else {
+				resp = compressed
+			}
+		}
+		responses[i] = resp
+	}
+	return responses
+}
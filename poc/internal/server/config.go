@@ -0,0 +1,432 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+)
+
+const defaultShutdownTimeout = 10 * time.Second
+
+// Duration is a time.Duration written in JSON as a Go duration string, for
+// example "30s" or "5m".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\", got %s", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Config is the swp-server configuration file. Fields left out of the file
+// keep their DefaultConfig values. Timeouts, MaxConns and RateLimits can be
+// changed on a running server with Reload; the rest apply at startup.
+type Config struct {
+	Listen string `json:"listen"`
+	// HTTP2Listen, if set, also serves the HTTP/2 binding on this address.
+	HTTP2Listen string `json:"http2_listen"`
+	// WebSocketListen, if set, also serves the WebSocket binding on this
+	// address; WebSocketOrigins lists the browser origins it accepts.
+	WebSocketListen  string     `json:"websocket_listen"`
+	WebSocketOrigins []string   `json:"websocket_origins"`
+	Unix             UnixConfig `json:"unix"`
+	// Stdio serves one connection on stdin/stdout instead of listening.
+	Stdio             bool      `json:"stdio"`
+	InsecurePlaintext bool      `json:"insecure_plaintext"`
+	TLS               TLSConfig `json:"tls"`
+	ShutdownTimeout   Duration  `json:"shutdown_timeout"`
+
+	Limits                LimitsConfig     `json:"limits"`
+	Reassembly            ReassemblyConfig `json:"reassembly"`
+	HelloRequired         bool             `json:"hello_required"`
+	MaxConcurrentDispatch int              `json:"max_concurrent_dispatch"`
+	// ResponseCompressionMinBytes below 1 disables response compression.
+	ResponseCompressionMinBytes int             `json:"response_compression_min_bytes"`
+	PushQueue                   PushQueueConfig `json:"push_queue"`
+	// MaxClockSkew enables timestamp enforcement when non-zero.
+	MaxClockSkew Duration       `json:"max_clock_skew"`
+	Replay       ReplayConfig   `json:"replay"`
+	Profiles     ProfilesConfig `json:"profiles"`
+
+	Timeouts   TimeoutsConfig   `json:"timeouts"`
+	MaxConns   int              `json:"max_conns"`
+	RateLimits RateLimitsConfig `json:"rate_limits"`
+}
+
+type TLSConfig struct {
+	Cert       string `json:"cert"`
+	Key        string `json:"key"`
+	ClientCA   string `json:"client_ca"`
+	ClientAuth string `json:"client_auth"`
+}
+
+// UnixConfig serves SWP on a Unix domain socket. Mode is an octal
+// permission string such as "0660".
+type UnixConfig struct {
+	Listen string `json:"listen"`
+	Mode   string `json:"mode"`
+}
+
+type LimitsConfig struct {
+	MaxFrameBytes    uint32 `json:"max_frame_bytes"`
+	MaxPayloadBytes  uint32 `json:"max_payload_bytes"`
+	MinMsgIDBytes    int    `json:"min_msg_id_bytes"`
+	MaxMsgIDBytes    int    `json:"max_msg_id_bytes"`
+	MaxExtBytes      int    `json:"max_ext_bytes"`
+	MaxExtValueBytes int    `json:"max_ext_value_bytes"`
+	StrictE1         bool   `json:"strict_e1"`
+}
+
+type ReassemblyConfig struct {
+	MaxMessageBytes  uint32   `json:"max_message_bytes"`
+	MaxBufferedBytes int      `json:"max_buffered_bytes"`
+	MaxPending       int      `json:"max_pending"`
+	Timeout          Duration `json:"timeout"`
+}
+
+type PushQueueConfig struct {
+	Size         int    `json:"size"`
+	SlowConsumer string `json:"slow_consumer"`
+}
+
+type ReplayConfig struct {
+	Window Duration `json:"window"`
+	Scope  string   `json:"scope"`
+}
+
+// ProfilesConfig selects the profiles served and their limits, keyed by
+// profile name or decimal profile_id.
+type ProfilesConfig struct {
+	Enabled []string                       `json:"enabled"`
+	Limits  map[string]ProfileLimitsConfig `json:"limits"`
+}
+
+// ProfileLimitsConfig mirrors ProfileLimits. Rate is envelopes per second
+// per connection with a burst of one second; zero fields are unset.
+type ProfileLimitsConfig struct {
+	MaxPayloadBytes uint32   `json:"max_payload_bytes"`
+	Rate            float64  `json:"rate"`
+	HandlerTimeout  Duration `json:"handler_timeout"`
+}
+
+// TimeoutsConfig mirrors Timeouts; zero disables a timeout.
+type TimeoutsConfig struct {
+	Idle        Duration `json:"idle"`
+	FrameRead   Duration `json:"frame_read"`
+	Write       Duration `json:"write"`
+	MaxLifetime Duration `json:"max_lifetime"`
+	Handler     Duration `json:"handler"`
+}
+
+// RateLimitsConfig sets token buckets in envelopes per second, each with a
+// burst of one second; zero disables a scope.
+type RateLimitsConfig struct {
+	Conn     float64 `json:"conn"`
+	IP       float64 `json:"ip"`
+	Identity float64 `json:"identity"`
+	Profile  float64 `json:"profile"`
+}
+
+// DefaultConfig returns the configuration equivalent to New with no options,
+// listening on 127.0.0.1:7777.
+func DefaultConfig() Config {
+	limits := core.DefaultLimits()
+	reassembly := core.DefaultReassemblyLimits()
+	timeouts := DefaultTimeouts()
+	return Config{
+		Listen:          "127.0.0.1:7777",
+		Unix:            UnixConfig{Mode: "0600"},
+		ShutdownTimeout: Duration(defaultShutdownTimeout),
+		Limits: LimitsConfig{
+			MaxFrameBytes:    limits.MaxFrameBytes,
+			MaxPayloadBytes:  limits.MaxPayloadBytes,
+			MinMsgIDBytes:    limits.MinMsgIDBytes,
+			MaxMsgIDBytes:    limits.MaxMsgIDBytes,
+			MaxExtBytes:      limits.MaxExtBytes,
+			MaxExtValueBytes: limits.MaxExtValueBytes,
+			StrictE1:         limits.StrictE1,
+		},
+		Reassembly: ReassemblyConfig{
+			MaxMessageBytes:  reassembly.MaxMessageBytes,
+			MaxBufferedBytes: reassembly.MaxBufferedBytes,
+			MaxPending:       reassembly.MaxPending,
+			Timeout:          Duration(reassembly.Timeout),
+		},
+		MaxConcurrentDispatch:       defaultMaxConcurrentDispatch,
+		ResponseCompressionMinBytes: defaultCompressMinBytes,
+		PushQueue:                   PushQueueConfig{Size: defaultPushQueue, SlowConsumer: SlowConsumerDisconnect.String()},
+		Replay:                      ReplayConfig{Window: Duration(defaultReplayWindow), Scope: ReplayScopeConn.String()},
+		Profiles:                    ProfilesConfig{Enabled: allProfileNames(), Limits: map[string]ProfileLimitsConfig{}},
+		Timeouts: TimeoutsConfig{
+			Idle:        Duration(timeouts.Idle),
+			FrameRead:   Duration(timeouts.FrameRead),
+			Write:       Duration(timeouts.Write),
+			MaxLifetime: Duration(timeouts.MaxLifetime),
+			Handler:     Duration(timeouts.Handler),
+		},
+		RateLimits: RateLimitsConfig{Conn: defaultConnFramesPerSecond},
+	}
+}
+
+// allProfileNames lists every implemented profile in profile_id order.
+func allProfileNames() []string {
+	ids := make([]uint64, 0, len(profileNames))
+	for id := range profileNames {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = profileNames[id]
+	}
+	return names
+}
+
+// LoadConfig reads a JSON configuration file over DefaultConfig and
+// validates it. Unknown fields are rejected.
+func LoadConfig(path string) (Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("config: %w", err)
+	}
+	c := DefaultConfig()
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return Config{}, fmt.Errorf("config: %s: %w", path, err)
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, fmt.Errorf("config: %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Validate reports every invalid field, each prefixed with its JSON path.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, field, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{field}, args...)...))
+		}
+	}
+	nonNegative := func(field string, d Duration) {
+		check(d >= 0, field, "must not be negative")
+	}
+
+	check(c.Listen != "", "listen", "is required")
+	check((c.TLS.Cert == "") == (c.TLS.Key == ""), "tls", "cert and key must be set together")
+	check(c.TLS.Cert != "" || (c.TLS.ClientCA == "" && c.TLS.ClientAuth == ""), "tls", "client_ca and client_auth require cert and key")
+	if c.TLS.ClientAuth != "" {
+		_, err := ParseClientAuth(c.TLS.ClientAuth)
+		check(err == nil, "tls.client_auth", "%v", err)
+	}
+	nonNegative("shutdown_timeout", c.ShutdownTimeout)
+	for i, origin := range c.WebSocketOrigins {
+		u, err := url.Parse(origin)
+		check(origin == "*" || (err == nil && u.Scheme != "" && u.Host != ""), fmt.Sprintf("websocket_origins[%d]", i), "must be \"*\" or scheme://host, got %q", origin)
+	}
+	if _, err := ParseUnixSocketMode(c.Unix.Mode); err != nil {
+		check(false, "unix.mode", "%v", err)
+	}
+	check(!c.Stdio || (c.HTTP2Listen == "" && c.WebSocketListen == "" && c.Unix.Listen == ""), "stdio", "cannot be combined with http2_listen, websocket_listen or unix.listen")
+
+	check(c.Limits.MaxFrameBytes > 0, "limits.max_frame_bytes", "must be positive")
+	check(c.Limits.MaxPayloadBytes > 0, "limits.max_payload_bytes", "must be positive")
+	check(c.Limits.MinMsgIDBytes > 0, "limits.min_msg_id_bytes", "must be positive")
+	check(c.Limits.MaxMsgIDBytes >= c.Limits.MinMsgIDBytes, "limits.max_msg_id_bytes", "must be at least min_msg_id_bytes (%d)", c.Limits.MinMsgIDBytes)
+	check(c.Limits.MaxExtBytes >= 0, "limits.max_ext_bytes", "must not be negative")
+	check(c.Limits.MaxExtValueBytes >= 0, "limits.max_ext_value_bytes", "must not be negative")
+
+	check(c.Reassembly.MaxMessageBytes > 0, "reassembly.max_message_bytes", "must be positive")
+	check(c.Reassembly.MaxBufferedBytes > 0, "reassembly.max_buffered_bytes", "must be positive")
+	check(c.Reassembly.MaxPending > 0, "reassembly.max_pending", "must be positive")
+	check(c.Reassembly.Timeout > 0, "reassembly.timeout", "must be positive")
+
+	check(c.MaxConcurrentDispatch > 0, "max_concurrent_dispatch", "must be positive")
+	check(c.PushQueue.Size > 0, "push_queue.size", "must be positive")
+	if _, err := ParseSlowConsumerPolicy(c.PushQueue.SlowConsumer); err != nil {
+		check(false, "push_queue.slow_consumer", "%v", err)
+	}
+	nonNegative("max_clock_skew", c.MaxClockSkew)
+	check(c.Replay.Window > 0, "replay.window", "must be positive")
+	if _, err := ParseReplayScope(c.Replay.Scope); err != nil {
+		check(false, "replay.scope", "%v", err)
+	}
+	check(len(c.Profiles.Enabled) > 0, "profiles.enabled", "must list at least one profile")
+	for _, name := range c.Profiles.Enabled {
+		if _, err := ParseProfile(name); err != nil {
+			check(false, "profiles.enabled", "%v", err)
+		}
+	}
+	names := make([]string, 0, len(c.Profiles.Limits))
+	for name := range c.Profiles.Limits {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		pl := c.Profiles.Limits[name]
+		field := "profiles.limits." + name
+		if _, err := ParseProfile(name); err != nil {
+			check(false, field, "%v", err)
+		}
+		check(pl.Rate >= 0, field+".rate", "must not be negative")
+		nonNegative(field+".handler_timeout", pl.HandlerTimeout)
+	}
+
+	nonNegative("timeouts.idle", c.Timeouts.Idle)
+	nonNegative("timeouts.frame_read", c.Timeouts.FrameRead)
+	nonNegative("timeouts.write", c.Timeouts.Write)
+	nonNegative("timeouts.max_lifetime", c.Timeouts.MaxLifetime)
+	nonNegative("timeouts.handler", c.Timeouts.Handler)
+	check(c.MaxConns >= 0, "max_conns", "must not be negative")
+	for _, r := range []struct {
+		field string
+		rate  float64
+	}{
+		{"rate_limits.conn", c.RateLimits.Conn},
+		{"rate_limits.ip", c.RateLimits.IP},
+		{"rate_limits.identity", c.RateLimits.Identity},
+		{"rate_limits.profile", c.RateLimits.Profile},
+	} {
+		check(r.rate >= 0, r.field, "must not be negative")
+	}
+	return errors.Join(errs...)
+}
+
+// Options maps the configuration onto server Options. Listen, HTTP2Listen,
+// WebSocketListen, Unix, Stdio, TLS and ShutdownTimeout are for the process
+// that owns the listeners. c must be valid.
+func (c Config) Options() []Option {
+	slowConsumer, _ := ParseSlowConsumerPolicy(c.PushQueue.SlowConsumer)
+	replayScope, _ := ParseReplayScope(c.Replay.Scope)
+	live := c.live(nil)
+	opts := []Option{
+		WithLimits(core.Limits{
+			MaxFrameBytes:    c.Limits.MaxFrameBytes,
+			MaxPayloadBytes:  c.Limits.MaxPayloadBytes,
+			MinMsgIDBytes:    c.Limits.MinMsgIDBytes,
+			MaxMsgIDBytes:    c.Limits.MaxMsgIDBytes,
+			MaxExtBytes:      c.Limits.MaxExtBytes,
+			MaxExtValueBytes: c.Limits.MaxExtValueBytes,
+			StrictE1:         c.Limits.StrictE1,
+		}),
+		WithReassemblyLimits(core.ReassemblyLimits{
+			MaxMessageBytes:  c.Reassembly.MaxMessageBytes,
+			MaxBufferedBytes: c.Reassembly.MaxBufferedBytes,
+			MaxPending:       c.Reassembly.MaxPending,
+			Timeout:          time.Duration(c.Reassembly.Timeout),
+		}),
+		WithMaxConcurrentDispatch(c.MaxConcurrentDispatch),
+		WithResponseCompression(c.ResponseCompressionMinBytes),
+		WithPushQueue(c.PushQueue.Size, slowConsumer),
+		WithTimestampSkew(time.Duration(c.MaxClockSkew)),
+		WithReplayProtection(time.Duration(c.Replay.Window), replayScope),
+		WithTimeouts(live.timeouts),
+		WithMaxConnections(live.maxConns),
+	}
+	var enabled []uint64
+	for _, name := range c.Profiles.Enabled {
+		id, _ := ParseProfile(name)
+		enabled = append(enabled, id)
+	}
+	opts = append(opts, WithProfiles(enabled...))
+	for name, pl := range c.Profiles.Limits {
+		id, _ := ParseProfile(name)
+		l := ProfileLimits{MaxPayloadBytes: pl.MaxPayloadBytes, HandlerTimeout: time.Duration(pl.HandlerTimeout)}
+		if pl.Rate > 0 {
+			l.RateLimit = NewTokenBucket(pl.Rate, burstFor(pl.Rate))
+		}
+		opts = append(opts, WithProfileLimits(id, l))
+	}
+	for sc, l := range live.rateLimits {
+		opts = append(opts, WithRateLimit(RateScope(sc), l))
+	}
+	if c.HelloRequired {
+		opts = append(opts, WithHelloRequired())
+	}
+	if c.InsecurePlaintext {
+		opts = append(opts, WithInsecurePlaintext())
+	}
+	if len(c.WebSocketOrigins) > 0 {
+		opts = append(opts, WithWebSocketOrigins(c.WebSocketOrigins...))
+	}
+	return opts
+}
+
+// liveConfig holds the settings Reload may replace while connections are
+// being served.
+type liveConfig struct {
+	timeouts   Timeouts
+	rateLimits [rateScopeCount]Limiter
+	maxConns   int
+}
+
+// live builds the reloadable settings of c. Token buckets in prev
+// whose rate is unchanged are kept, so reloading does not refill them.
+func (c Config) live(prev *liveConfig) *liveConfig {
+	live := &liveConfig{
+		timeouts: Timeouts{
+			Idle:        time.Duration(c.Timeouts.Idle),
+			FrameRead:   time.Duration(c.Timeouts.FrameRead),
+			Write:       time.Duration(c.Timeouts.Write),
+			MaxLifetime: time.Duration(c.Timeouts.MaxLifetime),
+			Handler:     time.Duration(c.Timeouts.Handler),
+		},
+		maxConns: c.MaxConns,
+	}
+	rates := [rateScopeCount]float64{
+		RateScopeConn:     c.RateLimits.Conn,
+		RateScopeIP:       c.RateLimits.IP,
+		RateScopeIdentity: c.RateLimits.Identity,
+		RateScopeProfile:  c.RateLimits.Profile,
+	}
+	for sc, rate := range rates {
+		if rate <= 0 {
+			continue
+		}
+		burst := burstFor(rate)
+		if prev != nil {
+			if tb, ok := prev.rateLimits[sc].(*TokenBucket); ok && tb.rate == rate && tb.burst == float64(burst) {
+				live.rateLimits[sc] = tb
+				continue
+			}
+		}
+		live.rateLimits[sc] = NewTokenBucket(rate, burst)
+	}
+	return live
+}
+
+// burstFor is one second of traffic at rate, at least 1.
+func burstFor(rate float64) int {
+	return max(1, int(math.Ceil(rate)))
+}
+
+// Reload validates c and applies its Timeouts, MaxConns and RateLimits.
+// New timeouts apply from each connection's next read or write, except
+// MaxLifetime, which applies to new connections. Other fields are ignored.
+func (s *Server) Reload(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	s.live.Store(c.live(s.live.Load()))
+	return nil
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "swp-server.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigKeepsDefaults(t *testing.T) {
+	c, err := LoadConfig(writeTestConfig(t, `{"max_conns": 10, "timeouts": {"idle": "1m"}, "replay": {"scope": "server"}}`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	want := DefaultConfig()
+	want.MaxConns = 10
+	want.Timeouts.Idle = Duration(time.Minute)
+	want.Replay.Scope = "server"
+	if !reflect.DeepEqual(c, want) {
+		t.Fatalf("config mismatch:\n got %+v\nwant %+v", c, want)
+	}
+}
+
+func TestLoadConfigRejectsUnknownField(t *testing.T) {
+	_, err := LoadConfig(writeTestConfig(t, `{"max_connections": 10}`))
+	if err == nil || !strings.Contains(err.Error(), "max_connections") {
+		t.Fatalf("expected unknown field error, got %v", err)
+	}
+}
+
+func TestConfigValidateReportsEveryField(t *testing.T) {
+	c := DefaultConfig()
+	c.Replay.Scope = "global"
+	c.Timeouts.Write = Duration(-time.Second)
+	c.RateLimits.IP = -1
+	c.TLS.Cert = "server.pem"
+	c.WebSocketOrigins = []string{"app.example"}
+	c.Unix.Mode = "0606"
+	c.Stdio, c.HTTP2Listen = true, "127.0.0.1:7778"
+	err := c.Validate()
+	if err == nil {
+		t.Fatalf("expected validation error")
+	}
+	for _, want := range []string{`replay.scope: unknown replay scope "global"`, "timeouts.write: must not be negative", "rate_limits.ip: must not be negative", "tls: cert and key must be set together", "websocket_origins[0]: must be", "unix.mode: mode 0606", "stdio: cannot be combined"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %q", want, err)
+		}
+	}
+}
+
+func TestDefaultConfigOptionsMatchNew(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	got := New(logger, DefaultConfig().Options()...)
+	want := New(logger)
+	gl, wl := got.live.Load(), want.live.Load()
+	if gl.timeouts != wl.timeouts || gl.maxConns != wl.maxConns {
+		t.Fatalf("live config mismatch: got %+v want %+v", gl, wl)
+	}
+	// Limiters are distinct instances; compare their settings instead.
+	for sc := range gl.rateLimits {
+		g, _ := gl.rateLimits[sc].(*TokenBucket)
+		w, _ := wl.rateLimits[sc].(*TokenBucket)
+		if (g == nil) != (w == nil) || (g != nil && (g.rate != w.rate || g.burst != w.burst)) {
+			t.Fatalf("rate limit %s mismatch", RateScope(sc))
+		}
+	}
+	if got.replayWindow != want.replayWindow || got.replayScope != want.replayScope || got.validator.EnforceTimestamp != want.validator.EnforceTimestamp {
+		t.Fatalf("replay settings mismatch")
+	}
+}
+
+func TestReloadKeepsUnchangedBuckets(t *testing.T) {
+	c := DefaultConfig()
+	c.RateLimits.IP = 50
+	s := New(log.New(io.Discard, "", 0), c.Options()...)
+	before := s.live.Load()
+
+	c.MaxConns = 3
+	c.Timeouts.Idle = Duration(time.Second)
+	c.RateLimits.IP = 100
+	if err := s.Reload(c); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	after := s.live.Load()
+	if after.maxConns != 3 || after.timeouts.Idle != time.Second {
+		t.Fatalf("reload not applied: %+v", after)
+	}
+	if after.rateLimits[RateScopeConn] != before.rateLimits[RateScopeConn] {
+		t.Fatalf("unchanged conn bucket was replaced")
+	}
+	if after.rateLimits[RateScopeIP] == before.rateLimits[RateScopeIP] {
+		t.Fatalf("changed ip bucket was kept")
+	}
+
+	c.Replay.Scope = "global"
+	if err := s.Reload(c); err == nil {
+		t.Fatalf("expected invalid config to be rejected")
+	}
+	if s.live.Load() != after {
+		t.Fatalf("invalid config was applied")
+	}
+}
+
+func TestConfigProfiles(t *testing.T) {
+	c, err := LoadConfig(writeTestConfig(t, `{"profiles": {"enabled": ["mcp", "12"], "limits": {"rpc": {"max_payload_bytes": 16, "rate": 5, "handler_timeout": "2s"}}}}`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	s := New(log.New(io.Discard, "", 0), c.Options()...)
+	for _, r := range s.Routes() {
+		if r.ProfileID != ProfileMCPMap && r.ProfileID != ProfileSWPRPC {
+			t.Fatalf("disabled profile %d registered", r.ProfileID)
+		}
+	}
+	pl := s.profileLimits[ProfileSWPRPC]
+	tb, _ := pl.RateLimit.(*TokenBucket)
+	if pl.MaxPayloadBytes != 16 || pl.HandlerTimeout != 2*time.Second || tb == nil || tb.rate != 5 {
+		t.Fatalf("unexpected rpc limits %+v", pl)
+	}
+}
@@ -0,0 +1,342 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+	"swp-spec-kit/poc/internal/p1rpc"
+)
+
+var errDispatchPanic = core.Wrap(core.CodeInternalError, errors.New("dispatch failed"))
+
+// connDispatcher runs envelopes from one connection concurrently, bounded by
+// sem, and funnels every response batch through a single writer goroutine.
+// Envelopes sharing an ordering key are handled in arrival order.
+type connDispatcher struct {
+	s    *Server
+	conn net.Conn
+	sem  chan struct{}
+	gate orderGate
+	wg   sync.WaitGroup
+	// inflight counts submitted envelopes not yet handled.
+	inflight atomic.Int64
+
+	out        chan outBatch
+	pushq      chan core.Envelope
+	writerDone chan struct{}
+	failed     chan struct{}
+	failOnce   sync.Once
+
+	// pushStop is closed when the writer stops taking pushes. Senders hold
+	// pushMu for reading while they may enqueue, so the writer can wait for
+	// them before its final drain.
+	pushStop chan struct{}
+	pushMu   sync.RWMutex
+
+	// Outbound limits narrowed by a HELLO exchange.
+	maxFrame   atomic.Uint32
+	maxPayload atomic.Uint32
+	noFragment atomic.Bool
+}
+
+func newConnDispatcher(s *Server, conn net.Conn, limit int) *connDispatcher {
+	if limit < 1 {
+		limit = 1
+	}
+	d := &connDispatcher{
+		s:          s,
+		conn:       conn,
+		sem:        make(chan struct{}, limit),
+		gate:       orderGate{tails: make(map[string]chan struct{})},
+		out:        make(chan outBatch, limit),
+		pushq:      make(chan core.Envelope, s.pushQueue),
+		writerDone: make(chan struct{}),
+		pushStop:   make(chan struct{}),
+		failed:     make(chan struct{}),
+	}
+	d.maxFrame.Store(s.limits.MaxFrameBytes)
+	d.maxPayload.Store(math.MaxUint32)
+	go d.writeLoop()
+	return d
+}
+
+// setPeer applies the peer's advertised receive limits to outbound frames
+// and payloads.
+func (d *connDispatcher) setPeer(n core.Negotiated) {
+	if n.PeerMaxFrameBytes < d.maxFrame.Load() {
+		d.maxFrame.Store(n.PeerMaxFrameBytes)
+	}
+	d.maxPayload.Store(n.PeerMaxPayloadBytes)
+	d.noFragment.Store(!n.HasFeature(core.FeatureFragment))
+}
+
+// outBatch is a response batch for the writer. release, if set, runs once
+// the batch has been written or dropped.
+type outBatch struct {
+	envs    []core.Envelope
+	release func()
+}
+
+// submit blocks until a dispatch slot is free, then handles env in the
+// background. release frees the frame env was decoded from; it runs once the
+// handler has returned and its responses are written. It returns false once
+// the connection can no longer be served.
+func (d *connDispatcher) submit(ctx context.Context, env core.Envelope, release func()) bool {
+	select {
+	case d.sem <- struct{}{}:
+	case <-d.failed:
+		release()
+		return false
+	case <-ctx.Done():
+		release()
+		return false
+	}
+
+	key, ordered := dispatchOrderKey(env)
+	var wait <-chan struct{}
+	var done chan struct{}
+	if ordered {
+		wait, done = d.gate.enter(key)
+	}
+
+	d.wg.Add(1)
+	d.inflight.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer d.inflight.Add(-1)
+		defer func() { <-d.sem }()
+		if ordered {
+			defer d.gate.leave(key, done)
+			if wait != nil {
+				<-wait
+			}
+		}
+		defer func() {
+			if release != nil {
+				release()
+			}
+		}()
+		defer d.recoverDispatch(env)
+
+		responses, abandoned, err := d.s.dispatch(ctx, env)
+		if abandoned != nil {
+			// The slot, ordering key and wait group entry belong to the
+			// handler until it actually returns.
+			defer func() { <-abandoned }()
+		}
+		if err != nil {
+			d.s.logger.Printf("dispatch error: %v", err)
+			d.sendError(env.MsgID, err, false)
+			return
+		}
+		if len(responses) == 0 {
+			return
+		}
+		responses = d.s.negotiateResponses(env, responses)
+		for _, resp := range responses {
+			if err := core.CheckPeerPayload(resp, d.maxPayload.Load()); err != nil {
+				d.s.logger.Printf("response error: %v", err)
+				d.sendError(env.MsgID, err, false)
+				return
+			}
+		}
+		// Responses may alias env, so the writer releases its frame.
+		d.sendRelease(responses, release)
+		release = nil
+	}()
+	return true
+}
+
+// recoverDispatch answers env with ERR_INTERNAL_ERROR if dispatching it
+// panicked outside a handler, for example in a session-scoped backend
+// lookup.
+func (d *connDispatcher) recoverDispatch(env core.Envelope) {
+	if r := recover(); r != nil {
+		d.s.logger.Printf("panic dispatching %s msg_type %d: %v\n%s", ProfileName(env.ProfileID), env.MsgType, r, debug.Stack())
+		d.sendError(env.MsgID, errDispatchPanic, false)
+	}
+}
+
+func (d *connDispatcher) send(batch []core.Envelope) {
+	d.sendRelease(batch, nil)
+}
+
+func (d *connDispatcher) sendRelease(batch []core.Envelope, release func()) {
+	select {
+	case d.out <- outBatch{envs: batch, release: release}:
+	case <-d.failed:
+		if release != nil {
+			release()
+		}
+	}
+}
+
+func (d *connDispatcher) sendError(msgID []byte, err error, fatal bool) {
+	if env, ok := d.s.coreErrorEnvelope(msgID, err, fatal); ok {
+		d.send([]core.Envelope{env})
+	}
+}
+
+// busy reports whether a submitted envelope is still being handled.
+func (d *connDispatcher) busy() bool {
+	return d.inflight.Load() > 0
+}
+
+// wait blocks until every submitted envelope has been handled.
+func (d *connDispatcher) wait() {
+	d.wg.Wait()
+}
+
+// close waits for in-flight work and flushes the writer.
+func (d *connDispatcher) close() {
+	d.wg.Wait()
+	close(d.out)
+	<-d.writerDone
+}
+
+// writeLoop buffers each batch and flushes once no further batch or push is
+// queued, so a multi-envelope response (or several responses ready at once)
+// goes out in a handful of writes instead of two per envelope. Pushes still
+// queued when the dispatcher closes are written before it returns.
+func (d *connDispatcher) writeLoop() {
+	defer close(d.writerDone)
+	fw := core.NewFrameWriter(d.conn, d.s.limits.MaxFrameBytes)
+	for {
+		var batch outBatch
+		select {
+		case b, ok := <-d.out:
+			if !ok {
+				close(d.pushStop)
+				// Wait out pushes that may still be enqueuing.
+				d.pushMu.Lock()
+				d.pushMu.Unlock()
+				d.drainPushes(fw)
+				return
+			}
+			batch = b
+		case env := <-d.pushq:
+			batch.envs = []core.Envelope{env}
+		}
+		d.write(fw, batch.envs, len(d.out) == 0 && len(d.pushq) == 0)
+		if batch.release != nil {
+			batch.release()
+		}
+	}
+}
+
+func (d *connDispatcher) drainPushes(fw *core.FrameWriter) {
+	for {
+		select {
+		case env := <-d.pushq:
+			d.write(fw, []core.Envelope{env}, len(d.pushq) == 0)
+		default:
+			return
+		}
+	}
+}
+
+func (d *connDispatcher) write(fw *core.FrameWriter, batch []core.Envelope, flush bool) {
+	select {
+	case <-d.failed:
+		return
+	default:
+	}
+	if t := d.s.live.Load().timeouts.Write; t > 0 {
+		_ = d.conn.SetWriteDeadline(time.Now().Add(t))
+	}
+	if err := writeBatch(fw, batch, d.maxFrame.Load(), !d.noFragment.Load(), flush); err != nil {
+		d.s.logger.Printf("write response error: %v", err)
+		d.fail()
+	}
+}
+
+// writeBatch writes batch, fragmenting envelopes that exceed maxFrame when
+// the peer accepts fragments.
+func writeBatch(fw *core.FrameWriter, batch []core.Envelope, maxFrame uint32, fragment, flush bool) error {
+	for _, resp := range batch {
+		frags := []core.Envelope{resp}
+		if fragment {
+			var err error
+			if frags, err = core.Fragment(resp, maxFrame); err != nil {
+				return err
+			}
+		} else if n := core.EncodedLenE1(resp); uint64(n) > uint64(maxFrame) {
+			return core.Wrap(core.CodeInvalidFrame, fmt.Errorf("frame length %d exceeds peer max %d", n, maxFrame))
+		}
+		for _, f := range frags {
+			if err := fw.WriteEnvelope(f); err != nil {
+				return err
+			}
+		}
+	}
+	if !flush {
+		return nil
+	}
+	return fw.Flush()
+}
+
+// fail stops further writes and closes the connection so the reader
+// unblocks.
+func (d *connDispatcher) fail() {
+	d.failOnce.Do(func() {
+		close(d.failed)
+		_ = d.conn.Close()
+	})
+}
+
+// dispatchOrderKey reports whether env must be handled after earlier
+// envelopes with the same key. Discovery lookups and MCP carry no
+// cross-message state and run unordered; SWP-RPC is ordered per rpc_id;
+// every other profile mutates shared state and is serialized per profile.
+// RPC cancels are never queued behind the request they target.
+func dispatchOrderKey(env core.Envelope) (string, bool) {
+	switch env.ProfileID {
+	case ProfileMCPMap, ProfileSWPAGDISC, ProfileSWPToolDisc:
+		return "", false
+	case ProfileSWPRPC:
+		if env.MsgType != rpcMsgTypeReq {
+			return "", false
+		}
+		req, err := p1rpc.DecodePayloadReq(env.Payload)
+		if err != nil || len(req.RPCID) == 0 {
+			return "", false
+		}
+		return "rpc:" + string(req.RPCID), true
+	default:
+		return "profile:" + strconv.FormatUint(env.ProfileID, 10), true
+	}
+}
+
+type orderGate struct {
+	mu    sync.Mutex
+	tails map[string]chan struct{}
+}
+
+// enter must be called in arrival order. It returns the channel to wait on
+// (nil if the key is idle) and the channel to close when done.
+func (g *orderGate) enter(key string) (<-chan struct{}, chan struct{}) {
+	done := make(chan struct{})
+	g.mu.Lock()
+	prev := g.tails[key]
+	g.tails[key] = done
+	g.mu.Unlock()
+	return prev, done
+}
+
+func (g *orderGate) leave(key string, done chan struct{}) {
+	close(done)
+	g.mu.Lock()
+	if g.tails[key] == done {
+		delete(g.tails, key)
+	}
+	g.mu.Unlock()
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+	"swp-spec-kit/poc/internal/p1rpc"
+)
+
+type blockingRPCBackend struct {
+	release chan struct{}
+
+	mu    sync.Mutex
+	order []string
+}
+
+func (b *blockingRPCBackend) HandleCancel() (p1rpc.RpcErr, error) {
+	return p1rpc.RpcErr{ErrorCode: "cancelled"}, nil
+}
+
+func (b *blockingRPCBackend) HandleRequest(req p1rpc.RpcReq) ([]RPCBackendMessage, error) {
+	if req.Method == "slow" {
+		<-b.release
+	}
+	b.mu.Lock()
+	b.order = append(b.order, req.Method)
+	b.mu.Unlock()
+	return []RPCBackendMessage{{
+		MsgType: rpcMsgTypeResp,
+		Resp:    p1rpc.RpcResp{RPCID: req.RPCID, Result: []byte(req.Method)},
+	}}, nil
+}
+
+func startTestConn(t *testing.T, s *Server) net.Conn {
+	t.Helper()
+	client, srv := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.handleConn(ctx, srv)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		_ = client.Close()
+		<-done
+	})
+	return client
+}
+
+func writeTestEnvelope(t *testing.T, conn net.Conn, env core.Envelope) {
+	t.Helper()
+	body, err := core.EncodeEnvelopeE1(env)
+	if err != nil {
+		t.Fatalf("encode envelope: %v", err)
+	}
+	if err := core.WriteFrame(conn, body, core.DefaultMaxFrameBytes); err != nil {
+		t.Fatalf("write frame: %v", err)
+	}
+}
+
+func readTestEnvelope(t *testing.T, conn net.Conn) core.Envelope {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	frame, err := core.ReadFrame(conn, core.DefaultMaxFrameBytes)
+	if err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	env, err := core.DecodeEnvelopeE1(frame, core.DefaultLimits())
+	if err != nil {
+		t.Fatalf("decode envelope: %v", err)
+	}
+	return env
+}
+
+func testRPCReq(t *testing.T, msgID, rpcID, method string) core.Envelope {
+	t.Helper()
+	payload, err := p1rpc.EncodePayloadReq(p1rpc.RpcReq{RPCID: []byte(rpcID), Method: method})
+	if err != nil {
+		t.Fatalf("encode rpc request: %v", err)
+	}
+	return core.Envelope{
+		Version:   core.CoreVersion,
+		ProfileID: ProfileSWPRPC,
+		MsgType:   rpcMsgTypeReq,
+		MsgID:     []byte(msgID),
+		Payload:   payload,
+	}
+}
+
+func TestHandleConnOutOfOrderResponses(t *testing.T) {
+	backend := &blockingRPCBackend{release: make(chan struct{})}
+	s := New(log.New(io.Discard, "", 0), WithRPCBackend(backend))
+	conn := startTestConn(t, s)
+
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-slow-0001", "rpc-a", "slow"))
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-fast-0001", "rpc-b", "fast"))
+
+	first := readTestEnvelope(t, conn)
+	if string(first.MsgID) != "msg-fast-0001" {
+		t.Fatalf("expected fast response first, got msg_id %q", first.MsgID)
+	}
+	close(backend.release)
+	second := readTestEnvelope(t, conn)
+	if string(second.MsgID) != "msg-slow-0001" {
+		t.Fatalf("expected slow response second, got msg_id %q", second.MsgID)
+	}
+}
+
+func TestHandleConnPreservesRPCIDOrder(t *testing.T) {
+	backend := &blockingRPCBackend{release: make(chan struct{})}
+	s := New(log.New(io.Discard, "", 0), WithRPCBackend(backend))
+	conn := startTestConn(t, s)
+
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-slow-0001", "rpc-same", "slow"))
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-fast-0001", "rpc-same", "fast"))
+
+	time.Sleep(50 * time.Millisecond)
+	backend.mu.Lock()
+	n := len(backend.order)
+	backend.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("expected same rpc_id request to wait, %d handled", n)
+	}
+
+	close(backend.release)
+	if got := readTestEnvelope(t, conn); string(got.MsgID) != "msg-slow-0001" {
+		t.Fatalf("expected slow response first, got msg_id %q", got.MsgID)
+	}
+	if got := readTestEnvelope(t, conn); string(got.MsgID) != "msg-fast-0001" {
+		t.Fatalf("expected fast response second, got msg_id %q", got.MsgID)
+	}
+}
+
+type countingConn struct {
+	net.Conn
+	mu     sync.Mutex
+	writes int
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	c.writes++
+	c.mu.Unlock()
+	return c.Conn.Write(p)
+}
+
+func TestHandleConnCoalescesStreamWrites(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0))
+	client, srv := net.Pipe()
+	counted := &countingConn{Conn: srv}
+	done := make(chan struct{})
+	go func() {
+		s.handleConn(context.Background(), counted)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		_ = client.Close()
+		<-done
+	})
+
+	payload, err := p1rpc.EncodePayloadReq(p1rpc.RpcReq{
+		RPCID:  []byte("rpc-count"),
+		Method: "demo.stream.count",
+		Params: []byte(`{"count":100}`),
+	})
+	if err != nil {
+		t.Fatalf("encode rpc request: %v", err)
+	}
+	writeTestEnvelope(t, client, core.Envelope{
+		Version:   core.CoreVersion,
+		ProfileID: ProfileSWPRPC,
+		MsgType:   rpcMsgTypeReq,
+		MsgID:     []byte("msg-count-000001"),
+		Payload:   payload,
+	})
+
+	for i := 0; i < 101; i++ {
+		readTestEnvelope(t, client)
+	}
+	counted.mu.Lock()
+	writes := counted.writes
+	counted.mu.Unlock()
+	if writes > 2 {
+		t.Fatalf("expected 101 envelopes in at most 2 writes, got %d", writes)
+	}
+}
+
+func TestHandleConnNegotiatesResponseCompression(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0))
+	conn := startTestConn(t, s)
+
+	params := []byte(`{"data":"` + strings.Repeat("a", 4096) + `"}`)
+	payload, err := p1rpc.EncodePayloadReq(p1rpc.RpcReq{RPCID: []byte("rpc-gzip"), Method: "demo.echo", Params: params})
+	if err != nil {
+		t.Fatalf("encode rpc request: %v", err)
+	}
+	req := core.Envelope{
+		Version:   core.CoreVersion,
+		ProfileID: ProfileSWPRPC,
+		MsgType:   rpcMsgTypeReq,
+		MsgID:     []byte("msg-plain-000001"),
+		Payload:   payload,
+	}
+
+	writeTestEnvelope(t, conn, req)
+	if got := readTestEnvelope(t, conn); got.Flags&core.FlagPayloadCompressed != 0 || len(got.Extensions) != 0 {
+		t.Fatalf("expected plain response without negotiation, flags=%d ext=%v", got.Flags, got.Extensions)
+	}
+
+	req.MsgID = []byte("msg-gzip-0000001")
+	compressed, err := core.CompressPayload(core.WithAcceptedCodecs(req, []core.Codec{core.CodecGzip}), core.CodecGzip, 1)
+	if err != nil {
+		t.Fatalf("compress request: %v", err)
+	}
+	writeTestEnvelope(t, conn, compressed)
+	got := readTestEnvelope(t, conn)
+	if got.Flags&core.FlagPayloadCompressed == 0 {
+		t.Fatalf("expected compressed response")
+	}
+	if offered, _ := core.AcceptedCodecs(got); len(offered) == 0 {
+		t.Fatalf("expected server to advertise its codecs")
+	}
+	plain, err := core.DecompressPayload(got, core.DefaultLimits().MaxPayloadBytes)
+	if err != nil {
+		t.Fatalf("decompress response: %v", err)
+	}
+	resp, err := p1rpc.DecodePayloadResp(plain.Payload)
+	if err != nil {
+		t.Fatalf("decode rpc response: %v", err)
+	}
+	if string(resp.Result) != string(params) {
+		t.Fatalf("echo result mismatch")
+	}
+}
+
+func TestHandleConnReassemblesAndFragments(t *testing.T) {
+	limits := core.DefaultLimits()
+	limits.MaxFrameBytes = 1024
+	limits.MaxPayloadBytes = 1024
+	s := New(log.New(io.Discard, "", 0), WithLimits(limits))
+	conn := startTestConn(t, s)
+
+	params := []byte(`{"data":"` + strings.Repeat("b", 6000) + `"}`)
+	payload, err := p1rpc.EncodePayloadReq(p1rpc.RpcReq{RPCID: []byte("rpc-big"), Method: "demo.echo", Params: params})
+	if err != nil {
+		t.Fatalf("encode rpc request: %v", err)
+	}
+	frags, err := core.Fragment(core.Envelope{
+		Version:   core.CoreVersion,
+		ProfileID: ProfileSWPRPC,
+		MsgType:   rpcMsgTypeReq,
+		MsgID:     []byte("msg-big-00000001"),
+		Payload:   payload,
+	}, limits.MaxFrameBytes)
+	if err != nil {
+		t.Fatalf("fragment request: %v", err)
+	}
+	for _, f := range frags {
+		writeTestEnvelope(t, conn, f)
+	}
+
+	r := core.NewReassembler(core.DefaultReassemblyLimits())
+	var resp core.Envelope
+	for n := 0; ; n++ {
+		f := readTestEnvelope(t, conn)
+		if f.Flags&core.FlagFragment == 0 {
+			t.Fatalf("expected fragmented response, got plain envelope after %d fragments", n)
+		}
+		env, complete, err := r.Add(f, time.Now())
+		if err != nil {
+			t.Fatalf("reassemble response: %v", err)
+		}
+		if complete {
+			resp = env
+			break
+		}
+	}
+	out, err := p1rpc.DecodePayloadResp(resp.Payload)
+	if err != nil {
+		t.Fatalf("decode rpc response: %v", err)
+	}
+	if string(out.Result) != string(params) {
+		t.Fatalf("echo result mismatch")
+	}
+}
+
+func TestDispatcherReleasesFrameAfterWrite(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0))
+	client, srv := net.Pipe()
+	d := newConnDispatcher(s, srv, 1)
+	t.Cleanup(func() {
+		_ = client.Close()
+		d.close()
+	})
+
+	released := make(chan struct{})
+	env := testRPCReq(t, "msg-release-0001", "rpc-release", "demo.echo")
+	if !d.submit(context.Background(), env, func() { close(released) }) {
+		t.Fatalf("submit refused")
+	}
+	// net.Pipe is unbuffered, so the response is still being written.
+	select {
+	case <-released:
+		t.Fatalf("frame released before its response was written")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if got := readTestEnvelope(t, client); string(got.MsgID) != "msg-release-0001" {
+		t.Fatalf("unexpected response msg_id %q", got.MsgID)
+	}
+	select {
+	case <-released:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("frame not released after its response was written")
+	}
+}
@@ -19,60 +19,58 @@ const (
 	eventsMsgTypeErr         = 5
 )
 
-func handleSWPEvents(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
-	return handleSWPEventsWithBackend(ctx, env, defaultBackends.events, defaultBackends.obs)
+func eventsHandlers(b EventsBackend, obs OBSBackend) map[uint64]core.Handler {
+	return map[uint64]core.Handler{
+		eventsMsgTypePublish: func(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
+			return handleEventsPublish(ctx, env, sessionBackend(ctx, b), sessionBackend(ctx, obs))
+		},
+		eventsMsgTypeSubscribe:   withBackend(b, handleEventsSubscribe),
+		eventsMsgTypeUnsubscribe: withBackend(b, handleEventsUnsubscribe),
+	}
 }
 
-func (s *Server) handleSWPEvents(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
-	return handleSWPEventsWithBackend(ctx, env, s.runtime.events, s.runtime.obs)
+func handleEventsPublish(ctx context.Context, env core.Envelope, backend EventsBackend, obsBackend OBSBackend) ([]core.Envelope, error) {
+	pub, err := p1events.DecodePayloadPublish(env.Payload)
+	if err != nil {
+		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid EVENTS publish payload: %w", err))
+	}
+	pub.Event = enrichEventRecord(ctx, env, pub.Event, obsBackend, runtimeclock.UnixMilli(nil))
+	if err := validateEventRecord(pub.Event); err != nil {
+		return nil, core.Wrap(core.CodeInvalidEnvelope, err)
+	}
+	if err := backend.Publish(pub.Event); err != nil {
+		return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("backend EVENTS publish: %w", err))
+	}
+	return nil, nil
 }
 
-func handleSWPEventsWithBackend(ctx context.Context, env core.Envelope, backend EventsBackend, obsBackend OBSBackend) ([]core.Envelope, error) {
+func handleEventsSubscribe(_ context.Context, env core.Envelope, backend EventsBackend) ([]core.Envelope, error) {
 	now := runtimeclock.UnixMilli(nil)
 
-	switch env.MsgType {
-	case eventsMsgTypePublish:
-		pub, err := p1events.DecodePayloadPublish(env.Payload)
-		if err != nil {
-			return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid EVENTS publish payload: %w", err))
-		}
-		pub.Event = enrichEventRecord(ctx, env, pub.Event, obsBackend, now)
-		if err := validateEventRecord(pub.Event); err != nil {
-			return nil, core.Wrap(core.CodeInvalidEnvelope, err)
-		}
-		if err := backend.Publish(pub.Event); err != nil {
-			return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("backend EVENTS publish: %w", err))
-		}
-		return nil, nil
-
-	case eventsMsgTypeSubscribe:
-		sub, err := p1events.DecodePayloadSubscribe(env.Payload)
-		if err != nil {
-			return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid EVENTS subscribe payload: %w", err))
-		}
-		events, err := backend.Subscribe(sub.Filter)
-		if err != nil {
-			return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("backend EVENTS subscribe: %w", err))
-		}
-		payload, err := p1events.EncodePayloadBatch(p1events.EvtBatch{Events: events})
-		if err != nil {
-			return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode EVENTS batch response: %w", err))
-		}
-		return []core.Envelope{newEventsEnvelope(env.MsgID, eventsMsgTypeBatch, now, payload)}, nil
-
-	case eventsMsgTypeUnsubscribe:
-		unsub, err := p1events.DecodePayloadUnsubscribe(env.Payload)
-		if err != nil {
-			return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid EVENTS unsubscribe payload: %w", err))
-		}
-		if err := backend.Unsubscribe(unsub.SubscriptionID); err != nil {
-			return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("backend EVENTS unsubscribe: %w", err))
-		}
-		return nil, nil
+	sub, err := p1events.DecodePayloadSubscribe(env.Payload)
+	if err != nil {
+		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid EVENTS subscribe payload: %w", err))
+	}
+	events, err := backend.Subscribe(sub.Filter)
+	if err != nil {
+		return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("backend EVENTS subscribe: %w", err))
+	}
+	payload, err := p1events.EncodePayloadBatch(p1events.EvtBatch{Events: events})
+	if err != nil {
+		return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode EVENTS batch response: %w", err))
+	}
+	return []core.Envelope{newEventsEnvelope(env.MsgID, eventsMsgTypeBatch, now, payload)}, nil
+}
 
-	default:
-		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid EVENTS msg_type %d", env.MsgType))
+func handleEventsUnsubscribe(_ context.Context, env core.Envelope, backend EventsBackend) ([]core.Envelope, error) {
+	unsub, err := p1events.DecodePayloadUnsubscribe(env.Payload)
+	if err != nil {
+		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid EVENTS unsubscribe payload: %w", err))
+	}
+	if err := backend.Unsubscribe(unsub.SubscriptionID); err != nil {
+		return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("backend EVENTS unsubscribe: %w", err))
 	}
+	return nil, nil
 }
 
 func enrichEventRecord(
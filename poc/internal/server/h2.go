@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ContentType is the media type of an HTTP/2 stream carrying SWP frames
+// (docs/transport-binding-h2.md).
+const ContentType = "application/swp"
+
+// HTTPHandler serves the HTTP/2 transport binding. Each POST with content
+// type application/swp is one SWP connection: request DATA frames carry
+// frames to the server and response DATA frames carry frames back, through
+// the same validation, limits and dispatch as Serve. Other HTTP versions
+// are refused. Plaintext (h2c) requests are only served on loopback
+// interfaces unless WithInsecurePlaintext is set.
+func (s *Server) HTTPHandler() http.Handler {
+	return http.HandlerFunc(s.serveHTTPStream)
+}
+
+func (s *Server) serveHTTPStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "SWP streams use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.ProtoMajor != 2 {
+		http.Error(w, "SWP streams require HTTP/2", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != ContentType {
+		http.Error(w, "content type must be "+ContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	local, ok := s.checkPlaintextRequest(w, r, "HTTP/2 stream")
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	s.handleConn(r.Context(), &streamConn{
+		ctx:    r.Context(),
+		body:   r.Body,
+		w:      w,
+		rc:     rc,
+		local:  local,
+		remote: streamAddr(r.RemoteAddr),
+		tls:    r.TLS,
+		closed: make(chan struct{}),
+	})
+}
+
+// ServeHTTP2 serves HTTPHandler on ln until ln is closed, ctx is done or
+// Shutdown is called. With tlsConfig the connections use TLS and ALPN h2;
+// without it they are h2c with prior knowledge. Streams already accepted
+// keep running; use Shutdown to drain them.
+func (s *Server) ServeHTTP2(ctx context.Context, ln net.Listener, tlsConfig *tls.Config) error {
+	protocols := new(http.Protocols)
+	if tlsConfig != nil {
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	if err := s.serveHTTP(ctx, ln, tlsConfig, "h2", protocols, s.HTTPHandler()); err != nil {
+		return fmt.Errorf("serve http2: %w", err)
+	}
+	return nil
+}
+
+// serveHTTP serves h on ln with protocols, adding TLS with ALPN nextProto
+// when tlsConfig is set. It returns nil once ln is closed.
+func (s *Server) serveHTTP(ctx context.Context, ln net.Listener, tlsConfig *tls.Config, nextProto string, protocols *http.Protocols, h http.Handler) error {
+	if !s.trackListener(ln) {
+		_ = ln.Close()
+		return nil
+	}
+	defer s.untrackListener(ln)
+	stop := context.AfterFunc(ctx, func() { _ = ln.Close() })
+	defer stop()
+
+	hs := &http.Server{
+		Handler:           h,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+		ReadHeaderTimeout: defaultTLSHandshakeTimeout,
+		ErrorLog:          s.logger,
+		Protocols:         protocols,
+	}
+	if tlsConfig != nil {
+		cfg := tlsConfig.Clone()
+		cfg.NextProtos = []string{nextProto}
+		ln = tls.NewListener(ln, cfg)
+	}
+	err := hs.Serve(ln)
+	// Close HTTP/2 connections once their streams have finished.
+	go func() { _ = hs.Shutdown(context.Background()) }()
+	if errors.Is(err, net.ErrClosed) || errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// checkPlaintextRequest refuses a plaintext request that arrived on a
+// non-loopback interface with 403, unless WithInsecurePlaintext is set. It
+// returns the local address the request arrived on.
+func (s *Server) checkPlaintextRequest(w http.ResponseWriter, r *http.Request, what string) (net.Addr, bool) {
+	local, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if r.TLS == nil && !s.insecurePlaintext && !isLoopbackAddr(local) {
+		s.logger.Printf("security: refusing plaintext %s from %s on non-loopback %s", what, r.RemoteAddr, local)
+		http.Error(w, ErrPlaintextNonLoopback.Error(), http.StatusForbidden)
+		return local, false
+	}
+	return local, true
+}
+
+// streamConn presents one HTTP/2 stream as a net.Conn to handleConn, which
+// finishes every write before the handler returns.
+type streamConn struct {
+	ctx    context.Context
+	body   io.ReadCloser
+	w      io.Writer
+	rc     *http.ResponseController
+	local  net.Addr
+	remote net.Addr
+	tls    *tls.ConnectionState
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Read reports a stream the client reset as io.EOF, like a closed TCP
+// connection.
+func (c *streamConn) Read(p []byte) (int, error) {
+	n, err := c.body.Read(p)
+	if err != nil {
+		select {
+		case <-c.closed:
+			return n, net.ErrClosed
+		case <-c.ctx.Done():
+			return n, io.EOF
+		default:
+		}
+	}
+	return n, err
+}
+
+// Write sends p in DATA frames right away; FrameWriter already batches
+// frames into few writes.
+func (c *streamConn) Write(p []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	n, err := c.w.Write(p)
+	if err == nil {
+		err = c.rc.Flush()
+	}
+	return n, err
+}
+
+// Close unblocks Read and fails later writes. The stream itself ends when
+// the handler returns.
+func (c *streamConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		_ = c.body.Close()
+	})
+	return nil
+}
+
+func (c *streamConn) channelState() *tls.ConnectionState { return c.tls }
+
+func (c *streamConn) LocalAddr() net.Addr  { return c.local }
+func (c *streamConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *streamConn) SetDeadline(t time.Time) error {
+	return errors.Join(c.rc.SetReadDeadline(t), c.rc.SetWriteDeadline(t))
+}
+
+func (c *streamConn) SetReadDeadline(t time.Time) error  { return c.rc.SetReadDeadline(t) }
+func (c *streamConn) SetWriteDeadline(t time.Time) error { return c.rc.SetWriteDeadline(t) }
+
+// streamAddr is the peer address of an HTTP request.
+type streamAddr string
+
+func (a streamAddr) Network() string { return "tcp" }
+func (a streamAddr) String() string  { return string(a) }
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+	runtimecontext "swp-spec-kit/poc/internal/runtime/context"
+	"swp-spec-kit/poc/pkg/swpclient"
+)
+
+func serveTestHTTP2(t *testing.T, s *Server, tlsConfig *tls.Config) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = s.ServeHTTP2(context.Background(), ln, tlsConfig) }()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + ln.Addr().String() + "/swp"
+}
+
+func TestHTTPHandlerRejectsNonSWPRequests(t *testing.T) {
+	h := New(log.New(io.Discard, "", 0)).HTTPHandler()
+	for _, tc := range []struct {
+		method, contentType string
+		protoMajor, want    int
+	}{
+		{http.MethodGet, ContentType, 2, http.StatusMethodNotAllowed},
+		{http.MethodPost, ContentType, 1, http.StatusHTTPVersionNotSupported},
+		{http.MethodPost, "application/json", 2, http.StatusUnsupportedMediaType},
+	} {
+		r := httptest.NewRequest(tc.method, "/swp", strings.NewReader(""))
+		r.Header.Set("Content-Type", tc.contentType)
+		r.ProtoMajor = tc.protoMajor
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Fatalf("%s %s HTTP/%d: got status %d want %d", tc.method, tc.contentType, tc.protoMajor, w.Code, tc.want)
+		}
+	}
+}
+
+func TestServeHTTP2MTLSPeerIdentity(t *testing.T) {
+	pki := newTestPKI(t)
+	s := New(log.New(io.Discard, "", 0))
+	identities := make(chan runtimecontext.PeerIdentity, 1)
+	s.router.Use(func(next core.Handler) core.Handler {
+		return func(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
+			id, _ := runtimecontext.PeerIdentityFromContext(ctx)
+			identities <- id
+			return next(ctx, env)
+		}
+	})
+	url := serveTestHTTP2(t, s, &tls.Config{
+		Certificates: []tls.Certificate{pki.server},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pki.pool,
+		MinVersion:   tls.VersionTLS12,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := swpclient.DialHTTP2(ctx, url, &tls.Config{
+		RootCAs:      pki.pool,
+		Certificates: []tls.Certificate{pki.client},
+	})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+	resp, err := c.Call(ctx, testRPCReq(t, "msg-rpc-00000001", "rpc-1", "demo.echo"))
+	if err != nil || resp.ProfileID != ProfileSWPRPC {
+		t.Fatalf("expected rpc response, got profile %d err=%v", resp.ProfileID, err)
+	}
+	if id := <-identities; id.ID != "spiffe://example.test/agent/a" {
+		t.Fatalf("unexpected peer identity %+v", id)
+	}
+}
+
+func TestShutdownDrainsHTTP2Stream(t *testing.T) {
+	backend := &blockingRPCBackend{release: make(chan struct{})}
+	s := New(log.New(io.Discard, "", 0), WithRPCBackend(backend))
+	url := serveTestHTTP2(t, s, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	goaway := make(chan core.Envelope, 1)
+	c, err := swpclient.DialHTTP2(ctx, url, nil, swpclient.WithUnsolicited(func(env core.Envelope) {
+		if core.IsGoawayEnvelope(env) {
+			goaway <- env
+		}
+	}))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+	st, err := c.Stream(ctx, testRPCReq(t, "msg-slow-0001", "rpc-a", "slow"))
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer st.Close()
+	// The fast request is answered once the slow one is in flight.
+	if _, err := c.Call(ctx, testRPCReq(t, "msg-fast-0001", "rpc-b", "fast")); err != nil {
+		t.Fatalf("fast call: %v", err)
+	}
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(ctx) }()
+	select {
+	case <-goaway:
+	case <-ctx.Done():
+		t.Fatalf("expected GOAWAY on the stream")
+	}
+	close(backend.release)
+	if resp, err := st.Recv(ctx); err != nil || string(resp.MsgID) != "msg-slow-0001" {
+		t.Fatalf("expected in-flight response, got %q err=%v", resp.MsgID, err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+}
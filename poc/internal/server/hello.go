@@ -0,0 +1,48 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+)
+
+// profileVersion is the version every built-in profile advertises in HELLO.
+const profileVersion = 1
+
+var (
+	errHelloNotFirst = core.Wrap(core.CodeInvalidEnvelope, errors.New("hello must be the first envelope on a connection"))
+	errHelloRequired = core.Wrap(core.CodeInvalidEnvelope, errors.New("hello required before other envelopes"))
+)
+
+func (s *Server) localHello() core.Hello {
+	var profiles []core.ProfileVersion
+	for _, r := range s.router.Routes() {
+		if r.ProfileID == core.ProfileCore {
+			continue
+		}
+		if n := len(profiles); n > 0 && profiles[n-1].ProfileID == r.ProfileID {
+			continue
+		}
+		profiles = append(profiles, core.ProfileVersion{ProfileID: r.ProfileID, Version: profileVersion})
+	}
+	return core.NewHello(s.limits, profiles...)
+}
+
+// handshake answers a peer HELLO with the server's own and returns the
+// negotiated connection parameters.
+func (s *Server) handshake(env core.Envelope) (core.Negotiated, core.Envelope, error) {
+	if len(env.MsgID) < s.limits.MinMsgIDBytes || len(env.MsgID) > s.limits.MaxMsgIDBytes {
+		return core.Negotiated{}, core.Envelope{}, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("msg_id length %d not in [%d,%d]", len(env.MsgID), s.limits.MinMsgIDBytes, s.limits.MaxMsgIDBytes))
+	}
+	remote, err := core.DecodeHelloPayload(env.Payload)
+	if err != nil {
+		return core.Negotiated{}, core.Envelope{}, err
+	}
+	n, err := core.Negotiate(s.hello, remote)
+	if err != nil {
+		return core.Negotiated{}, core.Envelope{}, err
+	}
+	return n, core.NewHelloEnvelope(env.MsgID, uint64(time.Now().UnixMilli()), s.hello), nil
+}
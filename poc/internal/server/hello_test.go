@@ -0,0 +1,88 @@
+package server
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"swp-spec-kit/poc/internal/core"
+)
+
+func TestHandleConnHelloRestrictsProfiles(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0))
+	conn := startTestConn(t, s)
+
+	hello := core.NewHello(core.DefaultLimits(), core.ProfileVersion{ProfileID: ProfileSWPRPC, Version: 1}, core.ProfileVersion{ProfileID: 4242, Version: 1})
+	writeTestEnvelope(t, conn, core.NewHelloEnvelope([]byte("msg-hello-000001"), 0, hello))
+	reply := readTestEnvelope(t, conn)
+	if !core.IsHelloEnvelope(reply) || string(reply.MsgID) != "msg-hello-000001" {
+		t.Fatalf("expected hello reply, got profile=%d msg_type=%d", reply.ProfileID, reply.MsgType)
+	}
+	remote, err := core.DecodeHelloPayload(reply.Payload)
+	if err != nil {
+		t.Fatalf("decode hello reply: %v", err)
+	}
+	n, err := core.Negotiate(hello, remote)
+	if err != nil || !n.HasProfile(ProfileSWPRPC) || n.HasProfile(4242) {
+		t.Fatalf("unexpected negotiation: %+v err=%v", n, err)
+	}
+
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-rpc-00000001", "rpc-1", "demo.echo"))
+	if got := readTestEnvelope(t, conn); got.ProfileID != ProfileSWPRPC {
+		t.Fatalf("expected rpc response, got profile %d", got.ProfileID)
+	}
+
+	writeTestEnvelope(t, conn, core.Envelope{Version: core.CoreVersion, ProfileID: ProfileSWPAGDISC, MsgType: agdiscMsgTypeGet, MsgID: []byte("msg-agdisc-00001")})
+	assertCoreError(t, readTestEnvelope(t, conn), "ERR_UNKNOWN_PROFILE", false)
+
+	writeTestEnvelope(t, conn, core.NewHelloEnvelope([]byte("msg-hello-000002"), 0, hello))
+	assertCoreError(t, readTestEnvelope(t, conn), "ERR_INVALID_ENVELOPE", false)
+}
+
+func TestHandleConnHelloPeerPayloadLimit(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0))
+	conn := startTestConn(t, s)
+
+	limits := core.DefaultLimits()
+	limits.MaxPayloadBytes = 8
+	hello := core.NewHello(limits, core.ProfileVersion{ProfileID: ProfileSWPRPC, Version: 1})
+	writeTestEnvelope(t, conn, core.NewHelloEnvelope([]byte("msg-hello-000001"), 0, hello))
+	readTestEnvelope(t, conn)
+
+	// The echo response is larger than the peer accepts, so the request
+	// fails instead of the connection.
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-rpc-00000001", "rpc-1", "demo.echo"))
+	assertCoreError(t, readTestEnvelope(t, conn), "ERR_INVALID_ENVELOPE", false)
+}
+
+func TestHandleConnHelloRequired(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0), WithHelloRequired())
+	conn := startTestConn(t, s)
+
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-rpc-00000001", "rpc-1", "demo.echo"))
+	assertCoreError(t, readTestEnvelope(t, conn), "ERR_INVALID_ENVELOPE", true)
+}
+
+func TestHandleConnHelloNoSharedVersion(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0))
+	conn := startTestConn(t, s)
+
+	hello := core.NewHello(core.DefaultLimits())
+	hello.Versions = []uint64{7}
+	writeTestEnvelope(t, conn, core.NewHelloEnvelope([]byte("msg-hello-000001"), 0, hello))
+	assertCoreError(t, readTestEnvelope(t, conn), "ERR_UNSUPPORTED_VERSION", true)
+}
+
+func assertCoreError(t *testing.T, env core.Envelope, code string, fatal bool) {
+	t.Helper()
+	if !core.IsErrorEnvelope(env) {
+		t.Fatalf("expected core error envelope, got profile=%d msg_type=%d", env.ProfileID, env.MsgType)
+	}
+	f, err := core.DecodeErrorPayload(env.Payload)
+	if err != nil {
+		t.Fatalf("decode core error: %v", err)
+	}
+	if f.Code != code || f.Fatal != fatal {
+		t.Fatalf("expected %s fatal=%v, got %s fatal=%v (%s)", code, fatal, f.Code, f.Fatal, f.Message)
+	}
+}
@@ -29,40 +29,25 @@ type mcpResponse struct {
 	Error   any    `json:"error,omitempty"`
 }
 
-func handleMCP(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
-	return handleMCPWithEmitter(ctx, env, nil)
-}
-
-func (s *Server) handleMCP(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
-	return handleMCPWithEmitter(ctx, env, func(eventType, severity string, body map[string]any) {
-		s.emitProfileEvent(ctx, env, eventType, severity, body, nil, nil)
-	})
-}
-
-func handleMCPWithEmitter(_ context.Context, env core.Envelope, emit func(eventType, severity string, body map[string]any)) ([]core.Envelope, error) {
-	if env.MsgType != mcpMsgTypeRequest && env.MsgType != mcpMsgTypeNotification {
-		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid MCP msg_type %d", env.MsgType))
+func mcpHandlers() map[uint64]core.Handler {
+	return map[uint64]core.Handler{
+		mcpMsgTypeRequest:      handleMCPRequest,
+		mcpMsgTypeNotification: handleMCPNotification,
 	}
+}
 
+func handleMCPNotification(_ context.Context, env core.Envelope) ([]core.Envelope, error) {
 	var req mcpRequest
 	if err := json.Unmarshal(env.Payload, &req); err != nil {
 		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid JSON-RPC payload: %w", err))
 	}
+	return nil, nil
+}
 
-	if emit != nil {
-		emit("swp.mcp.request", "info", map[string]any{
-			"method":   req.Method,
-			"msg_type": env.MsgType,
-		})
-	}
-
-	if env.MsgType == mcpMsgTypeNotification {
-		if emit != nil {
-			emit("swp.mcp.notification", "info", map[string]any{
-				"method": req.Method,
-			})
-		}
-		return nil, nil
+func handleMCPRequest(_ context.Context, env core.Envelope) ([]core.Envelope, error) {
+	var req mcpRequest
+	if err := json.Unmarshal(env.Payload, &req); err != nil {
+		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid JSON-RPC payload: %w", err))
 	}
 
 	resp := mcpResponse{JSONRPC: "2.0", ID: req.ID}
@@ -108,19 +93,6 @@ func handleMCPWithEmitter(_ context.Context, env core.Envelope, emit func(eventT
 		return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("marshal response: %w", err))
 	}
 
-	if emit != nil {
-		if resp.Error != nil {
-			emit("swp.mcp.response", "warn", map[string]any{
-				"method": req.Method,
-				"code":   "INVALID_MCP_PAYLOAD",
-			})
-		} else {
-			emit("swp.mcp.response", "info", map[string]any{
-				"method": req.Method,
-			})
-		}
-	}
-
 	return []core.Envelope{{
 		Version:   core.CoreVersion,
 		ProfileID: ProfileMCPMap,
@@ -130,3 +102,18 @@ func handleMCPWithEmitter(_ context.Context, env core.Envelope, emit func(eventT
 		Payload:   payload,
 	}}, nil
 }
+
+func mcpTelemetry(env core.Envelope, out []core.Envelope) (string, []telemetryEvent) {
+	if env.MsgType == mcpMsgTypeNotification {
+		return "", []telemetryEvent{{eventType: "swp.mcp.notification", severity: "info", body: map[string]any{}}}
+	}
+	for _, resp := range out {
+		var r struct {
+			Error json.RawMessage `json:"error"`
+		}
+		if json.Unmarshal(resp.Payload, &r) == nil && len(r.Error) > 0 {
+			return "INVALID_MCP_PAYLOAD", nil
+		}
+	}
+	return "", nil
+}
@@ -24,7 +24,7 @@ func TestHandleSWPOBSSetAndGet(t *testing.T) {
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   setPayload,
 	}
-	out, err := handleSWPOBS(context.Background(), setEnv)
+	out, err := route(context.Background(), setEnv, obsHandlers(defaultBackends.obs))
 	if err != nil {
 		t.Fatalf("set failed: %v", err)
 	}
@@ -43,7 +43,7 @@ func TestHandleSWPOBSSetAndGet(t *testing.T) {
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   getPayload,
 	}
-	out, err = handleSWPOBS(context.Background(), getEnv)
+	out, err = route(context.Background(), getEnv, obsHandlers(defaultBackends.obs))
 	if err != nil {
 		t.Fatalf("get failed: %v", err)
 	}
@@ -76,7 +76,7 @@ func TestHandleSWPOBSInvalidTraceparent(t *testing.T) {
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   setPayload,
 	}
-	_, err = handleSWPOBS(context.Background(), setEnv)
+	_, err = route(context.Background(), setEnv, obsHandlers(defaultBackends.obs))
 	if err == nil {
 		t.Fatalf("expected invalid traceparent error")
 	}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+)
+
+const (
+	defaultMaxConcurrentDispatch = 16
+	defaultCompressMinBytes      = 1024
+	defaultPushQueue             = 64
+)
+
+type options struct {
+	runtime               runtimeBackends
+	maxConcurrentDispatch int
+	compressMinBytes      int
+	reassembly            core.ReassemblyLimits
+	limits                core.Limits
+	helloRequired         bool
+	insecurePlaintext     bool
+	pushQueue             int
+	slowConsumer          SlowConsumerPolicy
+	timeouts              Timeouts
+	rateLimits            [rateScopeCount]Limiter
+	maxConns              int
+	replayWindow          time.Duration
+	replayScope           ReplayScope
+	maxClockSkew          time.Duration
+	// enabledProfiles is nil when every profile is served.
+	enabledProfiles  map[uint64]bool
+	disabledProfiles map[uint64]bool
+	profileLimits    map[uint64]ProfileLimits
+	wsOrigins        []string
+}
+
+type Option func(*options)
+
+func newOptions(opts ...Option) options {
+	o := options{
+		runtime:               newRuntimeBackends(),
+		maxConcurrentDispatch: defaultMaxConcurrentDispatch,
+		compressMinBytes:      defaultCompressMinBytes,
+		reassembly:            core.DefaultReassemblyLimits(),
+		limits:                core.DefaultLimits(),
+		pushQueue:             defaultPushQueue,
+		slowConsumer:          SlowConsumerDisconnect,
+		timeouts:              DefaultTimeouts(),
+		replayWindow:          defaultReplayWindow,
+	}
+	o.rateLimits[RateScopeConn] = NewTokenBucket(defaultConnFramesPerSecond, defaultConnFramesPerSecond)
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// WithMaxConcurrentDispatch bounds how many envelopes from one connection
+// may be dispatched at the same time. Values below 1 are ignored.
+func WithMaxConcurrentDispatch(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxConcurrentDispatch = n
+		}
+	}
+}
+
+// WithResponseCompression sets the smallest response payload compressed for
+// peers that advertise a shared codec. Values below 1 disable response
+// compression; inbound compressed payloads are always accepted.
+func WithResponseCompression(minBytes int) Option {
+	return func(o *options) {
+		o.compressMinBytes = minBytes
+	}
+}
+
+// WithReassemblyLimits bounds reassembly of fragmented envelopes on each
+// connection.
+func WithReassemblyLimits(l core.ReassemblyLimits) Option {
+	return func(o *options) {
+		o.reassembly = l
+	}
+}
+
+// WithLimits sets the frame and envelope limits used for reading, validation
+// and writing.
+func WithLimits(l core.Limits) Option {
+	return func(o *options) {
+		o.limits = l
+	}
+}
+
+// WithHelloRequired makes a core HELLO mandatory as the first envelope on
+// every connection.
+func WithHelloRequired() Option {
+	return func(o *options) {
+		o.helloRequired = true
+	}
+}
+
+// WithInsecurePlaintext lets Serve accept plaintext connections on
+// non-loopback interfaces, for deployments where S1 is provided outside the
+// process (for example a TLS-terminating proxy or an isolated container
+// network).
+func WithInsecurePlaintext() Option {
+	return func(o *options) {
+		o.insecurePlaintext = true
+	}
+}
+
+// WithPushQueue bounds the per-connection queue of envelopes sent with
+// Session.Send and sets what happens when it is full. Sizes below 1 are
+// ignored. The default is 64 envelopes with SlowConsumerDisconnect.
+func WithPushQueue(size int, policy SlowConsumerPolicy) Option {
+	return func(o *options) {
+		if size > 0 {
+			o.pushQueue = size
+		}
+		o.slowConsumer = policy
+	}
+}
+
+// WithTimeouts sets the connection timeouts. Zero fields disable the
+// corresponding timeout.
+func WithTimeouts(t Timeouts) Option {
+	return func(o *options) {
+		o.timeouts = t
+	}
+}
+
+// WithRateLimit sets the limiter for scope, replacing any earlier one; nil
+// removes it. By default only RateScopeConn is limited, with a token bucket
+// of 128 envelopes per second and a burst of 128.
+func WithRateLimit(scope RateScope, l Limiter) Option {
+	return func(o *options) {
+		if scope >= 0 && scope < rateScopeCount {
+			o.rateLimits[scope] = l
+		}
+	}
+}
+
+// WithMaxConnections caps the number of connections served at once. Further
+// connections receive a fatal ERR_RATE_LIMIT_EXCEEDED and are closed. Values
+// below 1 mean no cap.
+func WithMaxConnections(n int) Option {
+	return func(o *options) {
+		o.maxConns = n
+	}
+}
+
+// WithReplayProtection sets how long a msg_id is remembered to reject
+// duplicates (default 5s) and which envelopes share a namespace (default
+// ReplayScopeConn). Windows below 1 keep the default. With
+// WithTimestampSkew, timestamped envelopes are remembered for as long as
+// their timestamp is accepted instead.
+func WithReplayProtection(window time.Duration, scope ReplayScope) Option {
+	return func(o *options) {
+		if window > 0 {
+			o.replayWindow = window
+		}
+		o.replayScope = scope
+	}
+}
+
+// WithTimestampSkew rejects envelopes whose non-zero ts_unix_ms is further
+// than maxSkew from the server clock. Values below 1 leave timestamps
+// unchecked.
+func WithTimestampSkew(maxSkew time.Duration) Option {
+	return func(o *options) {
+		o.maxClockSkew = maxSkew
+	}
+}
+
+// WithProfiles serves only the listed profiles. Envelopes for any other
+// profile are rejected with ERR_UNKNOWN_PROFILE and the HELLO does not
+// advertise them. IDs this server does not implement are ignored.
+func WithProfiles(profileIDs ...uint64) Option {
+	return func(o *options) {
+		o.enabledProfiles = make(map[uint64]bool, len(profileIDs))
+		for _, id := range profileIDs {
+			o.enabledProfiles[id] = true
+		}
+	}
+}
+
+// WithoutProfiles stops serving the listed profiles, as if they were not
+// implemented.
+func WithoutProfiles(profileIDs ...uint64) Option {
+	return func(o *options) {
+		if o.disabledProfiles == nil {
+			o.disabledProfiles = make(map[uint64]bool, len(profileIDs))
+		}
+		for _, id := range profileIDs {
+			o.disabledProfiles[id] = true
+		}
+	}
+}
+
+// WithProfileLimits sets the limits for one profile, replacing any earlier
+// ones.
+func WithProfileLimits(profileID uint64, l ProfileLimits) Option {
+	return func(o *options) {
+		if o.profileLimits == nil {
+			o.profileLimits = make(map[uint64]ProfileLimits)
+		}
+		o.profileLimits[profileID] = l
+	}
+}
+
+// WithWebSocketOrigins sets the browser origins, such as
+// "https://app.example.com", allowed to open WebSocket connections. "*"
+// allows any origin. By default only requests without an Origin header or
+// from the same host are accepted.
+func WithWebSocketOrigins(origins ...string) Option {
+	return func(o *options) {
+		o.wsOrigins = append([]string(nil), origins...)
+	}
+}
@@ -37,7 +37,7 @@ func TestHandleSWPPolicyHintSetAck(t *testing.T) {
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   payload,
 	}
-	out, err := handleSWPPolicyHint(context.Background(), env)
+	out, err := route(context.Background(), env, policyHintHandlers(defaultBackends.policyHint))
 	if err != nil {
 		t.Fatalf("policyhint set failed: %v", err)
 	}
@@ -71,7 +71,7 @@ func TestHandleSWPPolicyHintUnknownMustViolation(t *testing.T) {
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   payload,
 	}
-	out, err := handleSWPPolicyHint(context.Background(), env)
+	out, err := route(context.Background(), env, policyHintHandlers(defaultBackends.policyHint))
 	if err != nil {
 		t.Fatalf("policyhint set failed: %v", err)
 	}
@@ -105,7 +105,7 @@ func TestHandleSWPRelayPublishDuplicateAndNack(t *testing.T) {
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   publishPayload,
 	}
-	out, err := handleSWPRelay(context.Background(), publishEnv)
+	out, err := route(context.Background(), publishEnv, relayHandlers(defaultBackends.relay))
 	if err != nil {
 		t.Fatalf("relay publish failed: %v", err)
 	}
@@ -113,7 +113,7 @@ func TestHandleSWPRelayPublishDuplicateAndNack(t *testing.T) {
 		t.Fatalf("expected one ack response, got %+v", out)
 	}
 
-	out, err = handleSWPRelay(context.Background(), publishEnv)
+	out, err = route(context.Background(), publishEnv, relayHandlers(defaultBackends.relay))
 	if err != nil {
 		t.Fatalf("relay duplicate publish failed: %v", err)
 	}
@@ -139,7 +139,7 @@ func TestHandleSWPRelayPublishDuplicateAndNack(t *testing.T) {
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   nackPayload,
 	}
-	out, err = handleSWPRelay(context.Background(), nackEnv)
+	out, err = route(context.Background(), nackEnv, relayHandlers(defaultBackends.relay))
 	if err != nil {
 		t.Fatalf("relay nack failed: %v", err)
 	}
@@ -156,17 +156,17 @@ func TestHandleSWPRelayPublishDuplicateAndNack(t *testing.T) {
 }
 
 func TestHandleSWPRelayUnsupportedMsgType(t *testing.T) {
-	_, err := handleSWPRelay(context.Background(), core.Envelope{
+	_, err := route(context.Background(), core.Envelope{
 		Version:   core.CoreVersion,
 		ProfileID: ProfileSWPRelay,
 		MsgType:   99,
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   []byte{0x0a, 0x00},
-	})
+	}, relayHandlers(defaultBackends.relay))
 	if err == nil {
 		t.Fatalf("expected unsupported msg_type error")
 	}
-	if core.CodeFromError(err) != core.CodeInvalidEnvelope {
-		t.Fatalf("expected INVALID_ENVELOPE, got %s", core.CodeFromError(err))
+	if core.CodeFromError(err) != core.CodeUnsupportedMsgType {
+		t.Fatalf("expected UNSUPPORTED_MSG_TYPE, got %s", core.CodeFromError(err))
 	}
 }
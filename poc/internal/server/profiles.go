@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+	runtimecontext "swp-spec-kit/poc/internal/runtime/context"
+)
+
+// ProfileLimits adds limits for one profile on top of the server-wide ones.
+// Zero fields keep the server-wide behaviour.
+type ProfileLimits struct {
+	// MaxPayloadBytes bounds the payload once reassembled and decompressed.
+	// It can only tighten core.Limits.MaxPayloadBytes, which every envelope
+	// is checked against first.
+	MaxPayloadBytes uint32
+	// RateLimit is applied per connection to the profile's envelopes, after
+	// the WithRateLimit limiters.
+	RateLimit Limiter
+	// HandlerTimeout bounds the context passed to the profile's handler.
+	HandlerTimeout time.Duration
+}
+
+// ParseProfile maps a profile name (see ProfileName) or decimal profile_id
+// to the ID of a profile this server implements.
+func ParseProfile(name string) (uint64, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for id, n := range profileNames {
+		if n == name {
+			return id, nil
+		}
+	}
+	if id, err := strconv.ParseUint(name, 10, 64); err == nil {
+		if _, ok := profileNames[id]; ok {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown profile %q", name)
+}
+
+// profileEnabled reports whether profileID is served under o.
+func (o *options) profileEnabled(profileID uint64) bool {
+	if o.enabledProfiles != nil && !o.enabledProfiles[profileID] {
+		return false
+	}
+	return !o.disabledProfiles[profileID]
+}
+
+// checkProfile applies env's ProfileLimits payload limit to a whole
+// message. Violations are non-fatal.
+func (s *Server) checkProfile(env core.Envelope) error {
+	pl, ok := s.profileLimits[env.ProfileID]
+	if ok && pl.MaxPayloadBytes > 0 && uint64(len(env.Payload)) > uint64(pl.MaxPayloadBytes) {
+		return core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("payload length %d exceeds %s max %d", len(env.Payload), ProfileName(env.ProfileID), pl.MaxPayloadBytes))
+	}
+	return nil
+}
+
+// checkProfileRate charges env against its ProfileLimits rate limit.
+// Violations are non-fatal.
+func (s *Server) checkProfileRate(sess *runtimecontext.Session, env core.Envelope, now time.Time) error {
+	pl, ok := s.profileLimits[env.ProfileID]
+	if ok && pl.RateLimit != nil && !pl.RateLimit.Allow(sess.ID, now) {
+		return core.Wrap(core.CodeRateLimitExceeded, fmt.Errorf("rate limit exceeded (profile %s)", ProfileName(env.ProfileID)))
+	}
+	return nil
+}
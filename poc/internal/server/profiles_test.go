@@ -0,0 +1,86 @@
+package server
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+	runtimecontext "swp-spec-kit/poc/internal/runtime/context"
+)
+
+func TestDisabledProfileIsUnknown(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0), WithProfiles(ProfileMCPMap, ProfileSWPRPC, ProfileSWPEvents), WithoutProfiles(ProfileSWPEvents))
+	served := make(map[uint64]bool)
+	for _, r := range s.Routes() {
+		served[r.ProfileID] = true
+	}
+	if !served[ProfileMCPMap] || !served[ProfileSWPRPC] || served[ProfileSWPEvents] || served[ProfileA2A] {
+		t.Fatalf("unexpected profiles %v", served)
+	}
+	for _, p := range s.hello.Profiles {
+		if p.ProfileID != ProfileMCPMap && p.ProfileID != ProfileSWPRPC {
+			t.Fatalf("hello advertises disabled profile %d", p.ProfileID)
+		}
+	}
+
+	conn := startTestConn(t, s)
+	env := testRPCReq(t, "msg-a2a-00000001", "rpc-1", "demo.echo")
+	env.ProfileID = ProfileA2A
+	writeTestEnvelope(t, conn, env)
+	got := readTestEnvelope(t, conn)
+	frame, err := core.DecodeErrorPayload(got.Payload)
+	if !core.IsErrorEnvelope(got) || err != nil || frame.Code != "ERR_UNKNOWN_PROFILE" || frame.Fatal {
+		t.Fatalf("expected non-fatal ERR_UNKNOWN_PROFILE, got %+v (%v)", frame, err)
+	}
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-rpc-00000001", "rpc-1", "demo.echo"))
+	if got := readTestEnvelope(t, conn); got.ProfileID != ProfileSWPRPC {
+		t.Fatalf("expected rpc response, got profile=%d", got.ProfileID)
+	}
+}
+
+func TestCheckProfileLimits(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0), WithProfileLimits(ProfileSWPRPC, ProfileLimits{
+		MaxPayloadBytes: 4,
+		RateLimit:       NewTokenBucket(0, 1),
+	}))
+	now := time.Unix(0, 0)
+	sess := runtimecontext.NewSession("conn-1", "192.0.2.1:1000", runtimecontext.PeerIdentity{})
+	other := runtimecontext.NewSession("conn-2", "192.0.2.1:2000", runtimecontext.PeerIdentity{})
+
+	if err := s.checkProfile(core.Envelope{ProfileID: ProfileSWPRPC, Payload: make([]byte, 5)}); core.CodeFromError(err) != core.CodeInvalidEnvelope {
+		t.Fatalf("expected payload limit, got %v", err)
+	}
+	if err := s.checkProfile(core.Envelope{ProfileID: ProfileSWPRPC, Payload: make([]byte, 4)}); err != nil {
+		t.Fatalf("payload at limit: %v", err)
+	}
+	if err := s.checkProfileRate(sess, core.Envelope{ProfileID: ProfileSWPRPC}, now); err != nil {
+		t.Fatalf("first envelope: %v", err)
+	}
+	if err := s.checkProfileRate(sess, core.Envelope{ProfileID: ProfileSWPRPC}, now); core.CodeFromError(err) != core.CodeRateLimitExceeded {
+		t.Fatalf("expected profile rate limit, got %v", err)
+	}
+	if err := s.checkProfileRate(other, core.Envelope{ProfileID: ProfileSWPRPC}, now); err != nil {
+		t.Fatalf("profile rate limit should be per connection: %v", err)
+	}
+	if err := s.checkProfile(core.Envelope{ProfileID: ProfileMCPMap, Payload: make([]byte, 64)}); err != nil {
+		t.Fatalf("other profiles keep server-wide limits: %v", err)
+	}
+	if err := s.checkProfileRate(sess, core.Envelope{ProfileID: ProfileMCPMap}, now); err != nil {
+		t.Fatalf("other profiles have no profile rate limit: %v", err)
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	for name, want := range map[string]uint64{"mcp": ProfileMCPMap, " RPC ": ProfileSWPRPC, "19": ProfileSWPRelay} {
+		if got, err := ParseProfile(name); err != nil || got != want {
+			t.Fatalf("ParseProfile(%q) = %d, %v", name, got, err)
+		}
+	}
+	for _, name := range []string{"", "nope", "3"} {
+		if _, err := ParseProfile(name); err == nil {
+			t.Fatalf("ParseProfile(%q) should fail", name)
+		}
+	}
+}
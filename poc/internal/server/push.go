@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+
+	"swp-spec-kit/poc/internal/core"
+	runtimeclock "swp-spec-kit/poc/internal/runtime/clock"
+)
+
+// SlowConsumerPolicy decides what Session.Send does when the connection's
+// push queue is full.
+type SlowConsumerPolicy int
+
+const (
+	// SlowConsumerDisconnect closes the connection.
+	SlowConsumerDisconnect SlowConsumerPolicy = iota
+	// SlowConsumerDrop discards the envelope and reports ErrPushQueueFull.
+	SlowConsumerDrop
+	// SlowConsumerBlock waits for space, the connection to close, or the
+	// caller's context.
+	SlowConsumerBlock
+)
+
+var (
+	ErrPushQueueFull = errors.New("push queue full")
+	ErrSlowConsumer  = errors.New("slow consumer disconnected")
+	ErrConnClosed    = errors.New("connection closed")
+)
+
+var slowConsumerNames = map[string]SlowConsumerPolicy{
+	"disconnect": SlowConsumerDisconnect,
+	"drop":       SlowConsumerDrop,
+	"block":      SlowConsumerBlock,
+}
+
+// ParseSlowConsumerPolicy maps a policy name (disconnect, drop, block) to
+// its SlowConsumerPolicy.
+func ParseSlowConsumerPolicy(name string) (SlowConsumerPolicy, error) {
+	if p, ok := slowConsumerNames[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return p, nil
+	}
+	return SlowConsumerDisconnect, fmt.Errorf("unknown slow consumer policy %q", name)
+}
+
+func (p SlowConsumerPolicy) String() string {
+	switch p {
+	case SlowConsumerDisconnect:
+		return "disconnect"
+	case SlowConsumerDrop:
+		return "drop"
+	case SlowConsumerBlock:
+		return "block"
+	default:
+		return fmt.Sprintf("SlowConsumerPolicy(%d)", int(p))
+	}
+}
+
+// push queues env for the writer on behalf of Session.Send.
+func (d *connDispatcher) push(ctx context.Context, env core.Envelope) error {
+	env, err := d.s.preparePush(env)
+	if err != nil {
+		return err
+	}
+	if err := core.CheckPeerPayload(env, d.maxPayload.Load()); err != nil {
+		return err
+	}
+	d.pushMu.RLock()
+	defer d.pushMu.RUnlock()
+	select {
+	case <-d.failed:
+		return ErrConnClosed
+	case <-d.pushStop:
+		return ErrConnClosed
+	default:
+	}
+
+	select {
+	case d.pushq <- env:
+		return nil
+	default:
+	}
+	switch d.s.slowConsumer {
+	case SlowConsumerDrop:
+		return ErrPushQueueFull
+	case SlowConsumerBlock:
+		select {
+		case d.pushq <- env:
+			return nil
+		case <-d.failed:
+			return ErrConnClosed
+		case <-d.pushStop:
+			return ErrConnClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	default:
+		d.s.logger.Printf("slow consumer: push queue full (%d), closing connection", cap(d.pushq))
+		d.fail()
+		return ErrSlowConsumer
+	}
+}
+
+// preparePush fills in the envelope header fields a backend may leave
+// unset.
+func (s *Server) preparePush(env core.Envelope) (core.Envelope, error) {
+	if env.Version == 0 {
+		env.Version = core.CoreVersion
+	}
+	if env.TsUnixMs == 0 {
+		env.TsUnixMs = runtimeclock.UnixMilli(nil)
+	}
+	if len(env.MsgID) == 0 {
+		env.MsgID = make([]byte, coreErrorMsgIDBytes)
+		if _, err := rand.Read(env.MsgID); err != nil {
+			return env, fmt.Errorf("push msg_id: %w", err)
+		}
+	}
+	return env, nil
+}
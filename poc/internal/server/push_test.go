@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+	runtimecontext "swp-spec-kit/poc/internal/runtime/context"
+)
+
+// pushTestSession opens a connection and returns the session the server
+// created for it.
+func pushTestSession(t *testing.T, s *Server) (net.Conn, *runtimecontext.Session) {
+	t.Helper()
+	sessions := make(chan *runtimecontext.Session, 1)
+	s.router.Use(func(next core.Handler) core.Handler {
+		return func(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
+			if sess, ok := runtimecontext.SessionFromContext(ctx); ok {
+				select {
+				case sessions <- sess:
+				default:
+				}
+			}
+			return next(ctx, env)
+		}
+	})
+	conn := startTestConn(t, s)
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-rpc-00000001", "rpc-1", "demo.echo"))
+	readTestEnvelope(t, conn)
+	return conn, <-sessions
+}
+
+func testPushEnvelope(seq byte) core.Envelope {
+	return core.Envelope{ProfileID: ProfileSWPEvents, MsgType: eventsMsgTypeBatch, Payload: []byte{seq}}
+}
+
+// fillPushQueue sends until Send fails, which happens once the writer is
+// blocked on the unread pipe and the queue is full.
+func fillPushQueue(t *testing.T, sess *runtimecontext.Session) error {
+	t.Helper()
+	for i := 0; i < 10; i++ {
+		if err := sess.Send(context.Background(), testPushEnvelope(byte(i))); err != nil {
+			return err
+		}
+	}
+	t.Fatalf("expected push queue to fill")
+	return nil
+}
+
+func TestSessionSendPushesEnvelopes(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0))
+	conn, sess := pushTestSession(t, s)
+
+	for i := byte(0); i < 3; i++ {
+		if err := sess.Send(context.Background(), testPushEnvelope(i)); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	for i := byte(0); i < 3; i++ {
+		env := readTestEnvelope(t, conn)
+		if env.ProfileID != ProfileSWPEvents || env.Version != core.CoreVersion || len(env.MsgID) == 0 || env.TsUnixMs == 0 || env.Payload[0] != i {
+			t.Fatalf("unexpected push %d: %+v", i, env)
+		}
+	}
+
+	if err := runtimecontext.NewSession("detached", "", runtimecontext.PeerIdentity{}).Send(context.Background(), testPushEnvelope(0)); !errors.Is(err, runtimecontext.ErrPushUnsupported) {
+		t.Fatalf("expected ErrPushUnsupported, got %v", err)
+	}
+}
+
+func TestSessionSendDropPolicy(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0), WithPushQueue(1, SlowConsumerDrop))
+	conn, sess := pushTestSession(t, s)
+
+	if err := fillPushQueue(t, sess); !errors.Is(err, ErrPushQueueFull) {
+		t.Fatalf("expected ErrPushQueueFull, got %v", err)
+	}
+	// The connection survives and delivers what was queued.
+	readTestEnvelope(t, conn)
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-rpc-00000002", "rpc-2", "demo.echo"))
+	for {
+		if env := readTestEnvelope(t, conn); env.ProfileID == ProfileSWPRPC {
+			break
+		}
+	}
+}
+
+func TestSessionSendBlockPolicy(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0), WithPushQueue(1, SlowConsumerBlock))
+	conn, sess := pushTestSession(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = sess.Send(ctx, testPushEnvelope(byte(i)))
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected blocked send to honor ctx, got %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- sess.Send(context.Background(), testPushEnvelope(99)) }()
+	for {
+		if env := readTestEnvelope(t, conn); env.Payload[0] == 99 {
+			break
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("blocked send: %v", err)
+	}
+}
+
+func TestSessionSendDisconnectPolicy(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0), WithPushQueue(1, SlowConsumerDisconnect))
+	conn, sess := pushTestSession(t, s)
+
+	if err := fillPushQueue(t, sess); !errors.Is(err, ErrSlowConsumer) {
+		t.Fatalf("expected ErrSlowConsumer, got %v", err)
+	}
+	if err := sess.Send(context.Background(), testPushEnvelope(0)); !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("expected ErrConnClosed after disconnect, got %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("expected connection to be closed, got %v", err)
+	}
+}
+
+func TestPushAfterCloseFails(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0))
+	srv, peer := net.Pipe()
+	defer peer.Close()
+	go func() { _, _ = io.Copy(io.Discard, peer) }()
+	d := newConnDispatcher(s, srv, 1)
+	if err := d.push(context.Background(), testPushEnvelope(0)); err != nil {
+		t.Fatalf("push before close: %v", err)
+	}
+	d.close()
+	if err := d.push(context.Background(), testPushEnvelope(1)); !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("expected ErrConnClosed after close, got %v", err)
+	}
+	if n := len(d.pushq); n != 0 {
+		t.Fatalf("expected empty push queue after close, got %d", n)
+	}
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+	runtimecontext "swp-spec-kit/poc/internal/runtime/context"
+)
+
+const defaultConnFramesPerSecond = 128
+
+var errConnLimit = core.Wrap(core.CodeRateLimitExceeded, errors.New("connection limit reached"))
+
+// Limiter admits or refuses one envelope for key. Implementations must be
+// safe for concurrent use; a limiter is shared by every connection.
+type Limiter interface {
+	Allow(key string, now time.Time) bool
+}
+
+// RateScope selects the key a Limiter is applied with.
+type RateScope int
+
+const (
+	// RateScopeConn keys by connection.
+	RateScopeConn RateScope = iota
+	// RateScopeIP keys by the remote IP, across its connections.
+	RateScopeIP
+	// RateScopeIdentity keys by the TLS peer identity. Connections without
+	// an authenticated peer are not limited by this scope.
+	RateScopeIdentity
+	// RateScopeProfile keys by profile_id, across all connections.
+	RateScopeProfile
+
+	rateScopeCount
+)
+
+func (sc RateScope) String() string {
+	switch sc {
+	case RateScopeConn:
+		return "conn"
+	case RateScopeIP:
+		return "ip"
+	case RateScopeIdentity:
+		return "identity"
+	case RateScopeProfile:
+		return "profile"
+	default:
+		return fmt.Sprintf("RateScope(%d)", int(sc))
+	}
+}
+
+// rateKey returns the key env is limited under in scope sc, or false when
+// the scope does not apply.
+func rateKey(sc RateScope, sess *runtimecontext.Session, env core.Envelope) (string, bool) {
+	switch sc {
+	case RateScopeConn:
+		return sess.ID, true
+	case RateScopeIP:
+		host, _, err := net.SplitHostPort(sess.RemoteAddr)
+		if err != nil {
+			return sess.RemoteAddr, true
+		}
+		return host, true
+	case RateScopeIdentity:
+		return sess.Peer.ID, sess.Peer.ID != ""
+	case RateScopeProfile:
+		return strconv.FormatUint(env.ProfileID, 10), true
+	default:
+		return "", false
+	}
+}
+
+// checkRate applies every configured limiter to env. A refused envelope is
+// answered with a non-fatal ERR_RATE_LIMIT_EXCEEDED; the connection stays
+// open.
+func (s *Server) checkRate(sess *runtimecontext.Session, env core.Envelope, now time.Time) error {
+	for sc, l := range s.live.Load().rateLimits {
+		if l == nil {
+			continue
+		}
+		key, ok := rateKey(RateScope(sc), sess, env)
+		if !ok {
+			continue
+		}
+		if !l.Allow(key, now) {
+			return core.Wrap(core.CodeRateLimitExceeded, fmt.Errorf("rate limit exceeded (%s)", RateScope(sc)))
+		}
+	}
+	return nil
+}
+
+// refuseConn tells a peer refused by the connection cap why it is being
+// closed.
+func (s *Server) refuseConn(ctx context.Context, conn net.Conn, err error) {
+	s.logger.Printf("refusing connection from %s: %v", conn.RemoteAddr(), err)
+	if tc, ok := conn.(*tls.Conn); ok {
+		if _, _, err := s.tlsHandshake(ctx, tc); err != nil {
+			return
+		}
+	}
+	env, ok := s.coreErrorEnvelope(nil, err, true)
+	if !ok {
+		return
+	}
+	body, err := core.EncodeEnvelopeE1(env)
+	if err != nil {
+		s.logger.Printf("encode core error: %v", err)
+		return
+	}
+	_ = conn.SetWriteDeadline(deadlineAfter(s.live.Load().timeouts.Write))
+	_ = core.WriteFrame(conn, body, s.limits.MaxFrameBytes)
+}
+
+// TokenBucket is a Limiter holding one bucket per key. Each bucket refills
+// at a steady rate up to its burst size, so bursts are bounded at any point
+// in time rather than per window. Buckets that have refilled completely are
+// discarded.
+type TokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenState
+	lastSweep time.Time
+}
+
+type tokenState struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket allows perSecond envelopes per key on average and up to
+// burst at once. A burst below 1 is raised to 1.
+func NewTokenBucket(perSecond float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{rate: perSecond, burst: float64(burst), buckets: make(map[string]*tokenState)}
+}
+
+func (b *TokenBucket) Allow(key string, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sweep(now)
+	st, ok := b.buckets[key]
+	if !ok {
+		st = &tokenState{tokens: b.burst, last: now}
+		b.buckets[key] = st
+	}
+	st.refill(now, b.rate, b.burst)
+	if st.tokens < 1 {
+		return false
+	}
+	st.tokens--
+	return true
+}
+
+func (st *tokenState) refill(now time.Time, rate, burst float64) {
+	if elapsed := now.Sub(st.last).Seconds(); elapsed > 0 {
+		st.tokens = math.Min(burst, st.tokens+elapsed*rate)
+		st.last = now
+	}
+}
+
+// sweep drops full buckets, at most once per refill period.
+func (b *TokenBucket) sweep(now time.Time) {
+	period := time.Second
+	if b.rate > 0 {
+		period = time.Duration(b.burst / b.rate * float64(time.Second))
+	}
+	if now.Sub(b.lastSweep) < period {
+		return
+	}
+	b.lastSweep = now
+	for key, st := range b.buckets {
+		st.refill(now, b.rate, b.burst)
+		if st.tokens >= b.burst {
+			delete(b.buckets, key)
+		}
+	}
+}
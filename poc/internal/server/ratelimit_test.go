@@ -0,0 +1,134 @@
+package server
+
+import (
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+	runtimecontext "swp-spec-kit/poc/internal/runtime/context"
+)
+
+func TestTokenBucketBoundsBursts(t *testing.T) {
+	base := time.Unix(0, 0)
+	b := NewTokenBucket(2, 2)
+
+	if !b.Allow("a", base) || !b.Allow("a", base.Add(100*time.Millisecond)) {
+		t.Fatalf("burst should pass")
+	}
+	if b.Allow("a", base.Add(200*time.Millisecond)) {
+		t.Fatalf("expected empty bucket to refuse")
+	}
+	if !b.Allow("b", base.Add(200*time.Millisecond)) {
+		t.Fatalf("keys should have separate buckets")
+	}
+	// A fixed window would reset here and admit a second full burst.
+	if !b.Allow("a", base.Add(700*time.Millisecond)) {
+		t.Fatalf("expected one refilled token")
+	}
+	if b.Allow("a", base.Add(700*time.Millisecond)) {
+		t.Fatalf("expected refill to be bounded by the rate")
+	}
+	if !b.Allow("a", base.Add(time.Hour)) || !b.Allow("a", base.Add(time.Hour)) || b.Allow("a", base.Add(time.Hour)) {
+		t.Fatalf("expected refill to be capped at the burst")
+	}
+}
+
+func TestCheckRateScopes(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0),
+		WithRateLimit(RateScopeConn, nil),
+		WithRateLimit(RateScopeIP, NewTokenBucket(0, 1)),
+		WithRateLimit(RateScopeIdentity, NewTokenBucket(0, 1)),
+	)
+	now := time.Unix(0, 0)
+	env := core.Envelope{ProfileID: ProfileSWPRPC}
+	anon1 := runtimecontext.NewSession("conn-1", "192.0.2.1:1000", runtimecontext.PeerIdentity{})
+	anon2 := runtimecontext.NewSession("conn-2", "192.0.2.1:2000", runtimecontext.PeerIdentity{})
+	if err := s.checkRate(anon1, env, now); err != nil {
+		t.Fatalf("first envelope from ip: %v", err)
+	}
+	if err := s.checkRate(anon2, env, now); core.CodeFromError(err) != core.CodeRateLimitExceeded {
+		t.Fatalf("expected ip limit across connections, got %v", err)
+	}
+
+	peer := runtimecontext.PeerIdentity{ID: "spiffe://example.org/agent"}
+	id1 := runtimecontext.NewSession("conn-3", "192.0.2.2:1000", peer)
+	id2 := runtimecontext.NewSession("conn-4", "192.0.2.3:1000", peer)
+	if err := s.checkRate(id1, env, now); err != nil {
+		t.Fatalf("first envelope from identity: %v", err)
+	}
+	if err := s.checkRate(id2, env, now); core.CodeFromError(err) != core.CodeRateLimitExceeded {
+		t.Fatalf("expected identity limit across addresses, got %v", err)
+	}
+}
+
+func TestRateLimitRejectKeepsConnection(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0), WithRateLimit(RateScopeConn, NewTokenBucket(0, 1)))
+	conn := startTestConn(t, s)
+
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-rpc-00000001", "rpc-1", "demo.echo"))
+	if got := readTestEnvelope(t, conn); got.ProfileID != ProfileSWPRPC {
+		t.Fatalf("expected rpc response, got profile=%d", got.ProfileID)
+	}
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-rpc-00000002", "rpc-2", "demo.echo"))
+	env := readTestEnvelope(t, conn)
+	frame, err := core.DecodeErrorPayload(env.Payload)
+	if !core.IsErrorEnvelope(env) || err != nil || frame.Code != "ERR_RATE_LIMIT_EXCEEDED" || frame.Fatal {
+		t.Fatalf("expected non-fatal ERR_RATE_LIMIT_EXCEEDED, got %+v (%v)", frame, err)
+	}
+	// The connection is still served.
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-rpc-00000003", "rpc-3", "demo.echo"))
+	if got := readTestEnvelope(t, conn); !core.IsErrorEnvelope(got) {
+		t.Fatalf("expected another rate limit reject, got profile=%d", got.ProfileID)
+	}
+}
+
+func TestRateLimitChargesFragmentedMessageOnFirstFrame(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0), WithRateLimit(RateScopeConn, NewTokenBucket(0, 1)))
+	conn := startTestConn(t, s)
+	fragments := func(msgID string) []core.Envelope {
+		t.Helper()
+		env := testRPCReq(t, msgID, "rpc-"+msgID, "demo.echo")
+		env.Payload = append(env.Payload, make([]byte, 200)...)
+		frags, err := core.Fragment(env, 96)
+		if err != nil || len(frags) < 3 {
+			t.Fatalf("fragment request: %d fragments (%v)", len(frags), err)
+		}
+		return frags
+	}
+
+	// All fragments of one message cost a single token.
+	for _, f := range fragments("msg-frag-0000001") {
+		writeTestEnvelope(t, conn, f)
+	}
+	if got := readTestEnvelope(t, conn); core.IsErrorEnvelope(got) {
+		f, _ := core.DecodeErrorPayload(got.Payload)
+		t.Fatalf("expected fragmented message to be served, got %s", f.Code)
+	}
+
+	// The next message is refused on its first fragment, before the
+	// rest is buffered.
+	writeTestEnvelope(t, conn, fragments("msg-frag-0000002")[0])
+	assertCoreError(t, readTestEnvelope(t, conn), "ERR_RATE_LIMIT_EXCEEDED", false)
+}
+
+func TestMaxConnectionsRefusesExtraConnections(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0), WithMaxConnections(1))
+	first, _ := serveTestListener(t, s)
+	writeTestEnvelope(t, first, testRPCReq(t, "msg-rpc-00000001", "rpc-1", "demo.echo"))
+	readTestEnvelope(t, first)
+
+	second, err := net.Dial("tcp", first.RemoteAddr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer second.Close()
+	env := readTestEnvelope(t, second)
+	frame, err := core.DecodeErrorPayload(env.Payload)
+	if !core.IsErrorEnvelope(env) || err != nil || frame.Code != "ERR_RATE_LIMIT_EXCEEDED" || !frame.Fatal {
+		t.Fatalf("expected fatal ERR_RATE_LIMIT_EXCEEDED, got %+v (%v)", frame, err)
+	}
+	expectClosed(t, second)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime/debug"
+
+	"swp-spec-kit/poc/internal/core"
+)
+
+// recoverMiddleware turns a handler panic into ERR_INTERNAL_ERROR and emits
+// swp.<profile>.panic. The panic value and stack are only logged.
+func (s *Server) recoverMiddleware(next core.Handler) core.Handler {
+	return func(ctx context.Context, env core.Envelope) (out []core.Envelope, err error) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			name := ProfileName(env.ProfileID)
+			s.logger.Printf("panic in %s handler (msg_type %d): %v\n%s", name, env.MsgType, r, debug.Stack())
+			s.emitProfileEvent(ctx, env, "swp."+name+".panic", "error", map[string]any{
+				"msg_type": env.MsgType,
+				"code":     string(core.CodeInternalError),
+			}, nil, nil)
+			out, err = nil, core.Wrap(core.CodeInternalError, fmt.Errorf("%s handler failed", name))
+		}()
+		return next(ctx, env)
+	}
+}
+
+// dispatchBounded runs the handler chain for env but stops waiting once ctx
+// is done, so a handler that ignores its context is answered with
+// ERR_INTERNAL_ERROR on time. The handler is left to finish on its own and
+// its result is discarded; the returned channel is closed once it returns,
+// and the caller must hold the request's dispatch slot and ordering key
+// until then. Without a deadline on ctx the handler runs inline.
+func (s *Server) dispatchBounded(ctx context.Context, env core.Envelope) ([]core.Envelope, <-chan struct{}, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		out, err := s.router.Dispatch(ctx, env)
+		return out, nil, err
+	}
+	type result struct {
+		out []core.Envelope
+		err error
+	}
+	done := make(chan result, 1)
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		out, err := s.router.Dispatch(ctx, env)
+		done <- result{out, err}
+	}()
+	select {
+	case r := <-done:
+		return r.out, nil, r.err
+	case <-ctx.Done():
+	}
+	select {
+	case r := <-done:
+		return r.out, nil, r.err
+	default:
+	}
+	name := ProfileName(env.ProfileID)
+	s.emitProfileEvent(ctx, env, "swp."+name+".timeout", "error", map[string]any{
+		"msg_type": env.MsgType,
+		"code":     string(core.CodeInternalError),
+	}, nil, nil)
+	return nil, returned, core.Wrap(core.CodeInternalError, fmt.Errorf("%s handler abandoned: %w", name, ctx.Err()))
+}
+
+// recoverConn keeps a panic while serving conn from taking down the
+// process. Deferred cleanup has already closed the connection's dispatcher.
+func (s *Server) recoverConn(conn net.Conn) {
+	if r := recover(); r != nil {
+		s.logger.Printf("panic serving %s: %v\n%s", conn.RemoteAddr(), r, debug.Stack())
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+	"swp-spec-kit/poc/internal/p1rpc"
+)
+
+type panicRPCBackend struct{}
+
+func (panicRPCBackend) HandleCancel() (p1rpc.RpcErr, error) {
+	return p1rpc.RpcErr{ErrorCode: "cancelled"}, nil
+}
+
+func (panicRPCBackend) HandleRequest(req p1rpc.RpcReq) ([]RPCBackendMessage, error) {
+	if req.Method == "boom" {
+		panic("backend bug")
+	}
+	return []RPCBackendMessage{{
+		MsgType: rpcMsgTypeResp,
+		Resp:    p1rpc.RpcResp{RPCID: req.RPCID, Result: []byte(req.Method)},
+	}}, nil
+}
+
+func TestHandlerPanicBecomesInternalError(t *testing.T) {
+	events := &mockEventsBackend{}
+	s := New(log.New(io.Discard, "", 0), WithRPCBackend(panicRPCBackend{}), WithEventsBackend(events))
+	conn := startTestConn(t, s)
+
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-boom-00000001", "rpc-1", "boom"))
+	assertCoreError(t, readTestEnvelope(t, conn), "ERR_INTERNAL_ERROR", false)
+	panicked := false
+	for _, ev := range events.published {
+		panicked = panicked || ev.EventType == "swp.rpc.panic"
+	}
+	if !panicked {
+		t.Fatalf("expected swp.rpc.panic event")
+	}
+
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-echo-00000001", "rpc-2", "echo"))
+	if got := readTestEnvelope(t, conn); got.ProfileID != ProfileSWPRPC {
+		t.Fatalf("expected connection to keep serving, got profile=%d", got.ProfileID)
+	}
+}
+
+func TestHandlerTimeoutKeepsOrderingUntilHandlerReturns(t *testing.T) {
+	backend := &blockingRPCBackend{release: make(chan struct{})}
+	s := New(log.New(io.Discard, "", 0), WithRPCBackend(backend), WithTimeouts(Timeouts{Handler: 50 * time.Millisecond}))
+	conn := startTestConn(t, s)
+
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-slow-0001", "rpc-a", "slow"))
+	assertCoreError(t, readTestEnvelope(t, conn), "ERR_INTERNAL_ERROR", false)
+	// Same rpc_id: still ordered behind the abandoned handler.
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-fast-0001", "rpc-a", "fast"))
+	_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := core.ReadFrame(conn, core.DefaultMaxFrameBytes); !isTimeout(err) {
+		t.Fatalf("expected no response while the abandoned handler runs, got %v", err)
+	}
+
+	close(backend.release)
+	if got := readTestEnvelope(t, conn); string(got.MsgID) != "msg-fast-0001" || core.IsErrorEnvelope(got) {
+		t.Fatalf("expected fast response, got msg_id %q", got.MsgID)
+	}
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if len(backend.order) != 2 || backend.order[0] != "slow" || backend.order[1] != "fast" {
+		t.Fatalf("expected slow to finish before fast, got %v", backend.order)
+	}
+}
+
+func TestProfileHandlerTimeoutOverridesDefault(t *testing.T) {
+	backend := &blockingRPCBackend{release: make(chan struct{})}
+	defer close(backend.release)
+	s := New(log.New(io.Discard, "", 0), WithRPCBackend(backend),
+		WithTimeouts(Timeouts{Handler: time.Hour}),
+		WithProfileLimits(ProfileSWPRPC, ProfileLimits{HandlerTimeout: 50 * time.Millisecond}))
+	conn := startTestConn(t, s)
+
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-slow-0001", "rpc-a", "slow"))
+	assertCoreError(t, readTestEnvelope(t, conn), "ERR_INTERNAL_ERROR", false)
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+	runtimecontext "swp-spec-kit/poc/internal/runtime/context"
+)
+
+const (
+	defaultReplayWindow = 5 * time.Second
+	// replayBuckets is how many expiry buckets a window spans.
+	replayBuckets = 16
+)
+
+// ReplayScope selects which envelopes share a duplicate msg_id namespace.
+type ReplayScope int
+
+const (
+	// ReplayScopeConn detects replays within one connection.
+	ReplayScopeConn ReplayScope = iota
+	// ReplayScopeServer detects replays across every connection.
+	ReplayScopeServer
+	// ReplayScopeIdentity detects replays across the connections of one TLS
+	// peer identity. Unauthenticated connections share one namespace.
+	ReplayScopeIdentity
+)
+
+var replayScopeNames = map[string]ReplayScope{
+	"conn":     ReplayScopeConn,
+	"server":   ReplayScopeServer,
+	"identity": ReplayScopeIdentity,
+}
+
+// ParseReplayScope maps a scope name (conn, server, identity) to its
+// ReplayScope.
+func ParseReplayScope(name string) (ReplayScope, error) {
+	if sc, ok := replayScopeNames[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return sc, nil
+	}
+	return ReplayScopeConn, fmt.Errorf("unknown replay scope %q", name)
+}
+
+func (sc ReplayScope) String() string {
+	switch sc {
+	case ReplayScopeConn:
+		return "conn"
+	case ReplayScopeServer:
+		return "server"
+	case ReplayScopeIdentity:
+		return "identity"
+	default:
+		return fmt.Sprintf("ReplayScope(%d)", int(sc))
+	}
+}
+
+// replayCache remembers keys until they expire. Keys are indexed by expiry
+// bucket, so expiring them costs time proportional to the keys removed
+// rather than to the size of the cache. It is safe for concurrent use.
+type replayCache struct {
+	gran time.Duration
+
+	mu      sync.Mutex
+	entries map[string]time.Time
+	buckets map[int64][]string
+	// next is the lowest bucket index that may still hold keys.
+	next int64
+}
+
+func newReplayCache(window time.Duration) *replayCache {
+	gran := window / replayBuckets
+	if gran < time.Millisecond {
+		gran = time.Millisecond
+	}
+	return &replayCache{
+		gran:    gran,
+		entries: make(map[string]time.Time),
+		buckets: make(map[int64][]string),
+	}
+}
+
+// seen reports whether key was recorded and has not expired by now. If not,
+// it records key until expires.
+func (c *replayCache) seen(key string, now, expires time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(now)
+	if exp, ok := c.entries[key]; ok && now.Before(exp) {
+		return true
+	}
+	if !expires.After(now) {
+		return false
+	}
+	c.entries[key] = expires
+	// Round up so a bucket is only expired once all of its keys have.
+	idx := (expires.UnixNano() + int64(c.gran) - 1) / int64(c.gran)
+	c.buckets[idx] = append(c.buckets[idx], key)
+	return false
+}
+
+func (c *replayCache) expire(now time.Time) {
+	nowIdx := now.UnixNano() / int64(c.gran)
+	if len(c.buckets) == 0 || nowIdx-c.next > int64(len(c.buckets)) {
+		// Fewer buckets than elapsed indexes: visit the buckets instead.
+		for idx, keys := range c.buckets {
+			if idx <= nowIdx {
+				c.expireBucket(now, keys)
+				delete(c.buckets, idx)
+			}
+		}
+		c.next = nowIdx + 1
+		return
+	}
+	for ; c.next <= nowIdx; c.next++ {
+		c.expireBucket(now, c.buckets[c.next])
+		delete(c.buckets, c.next)
+	}
+}
+
+func (c *replayCache) expireBucket(now time.Time, keys []string) {
+	for _, key := range keys {
+		// A key recorded again since this bucket was filled stays.
+		if exp, ok := c.entries[key]; ok && !now.Before(exp) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// checkReplay rejects env if its msg_id was already seen in the scope of
+// cache. With timestamp enforcement on, a timestamped envelope is
+// remembered for as long as the validator would accept its timestamp;
+// otherwise for the replay window.
+func (s *Server) checkReplay(cache *replayCache, sess *runtimecontext.Session, env core.Envelope, now time.Time) error {
+	key := string(env.MsgID)
+	if s.replayScope == ReplayScopeIdentity {
+		key = sess.Peer.ID + "\x00" + key
+	}
+	expires := now.Add(s.replayWindow)
+	if s.validator.EnforceTimestamp && env.TsUnixMs != 0 {
+		expires = time.UnixMilli(int64(env.TsUnixMs)).Add(s.validator.MaxClockSkew)
+	}
+	if cache.seen(key, now, expires) {
+		return errDuplicateMsgID
+	}
+	return nil
+}
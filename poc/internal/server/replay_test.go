@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+	runtimecontext "swp-spec-kit/poc/internal/runtime/context"
+)
+
+func TestReplayCacheExpires(t *testing.T) {
+	base := time.Unix(0, 0)
+	c := newReplayCache(2 * time.Second)
+
+	if c.seen("same-id", base, base.Add(2*time.Second)) {
+		t.Fatalf("first message should pass")
+	}
+	if !c.seen("same-id", base.Add(500*time.Millisecond), base.Add(2500*time.Millisecond)) {
+		t.Fatalf("expected duplicate within window")
+	}
+	if c.seen("same-id", base.Add(3*time.Second), base.Add(5*time.Second)) {
+		t.Fatalf("message after window should pass")
+	}
+	if !c.seen("same-id", base.Add(4*time.Second), base.Add(6*time.Second)) {
+		t.Fatalf("expected re-recorded msg_id to be a duplicate")
+	}
+}
+
+func TestReplayCacheDropsExpiredEntries(t *testing.T) {
+	base := time.Unix(0, 0)
+	c := newReplayCache(time.Second)
+	for i := 0; i < 100; i++ {
+		now := base.Add(time.Duration(i) * 10 * time.Millisecond)
+		c.seen(fmt.Sprintf("msg-%d", i), now, now.Add(time.Second))
+	}
+	// Jump well past every expiry: a single call empties the cache.
+	c.seen("late", base.Add(time.Hour), base.Add(time.Hour+time.Second))
+	if len(c.entries) != 1 || len(c.buckets) != 1 {
+		t.Fatalf("expected only the new entry, got %d entries in %d buckets", len(c.entries), len(c.buckets))
+	}
+}
+
+func TestCheckReplayScopes(t *testing.T) {
+	now := time.Unix(1000, 0)
+	env := core.Envelope{MsgID: []byte("msg-replay-0001")}
+	peerA := runtimecontext.NewSession("conn-1", "192.0.2.1:1000", runtimecontext.PeerIdentity{ID: "agent-a"})
+	peerA2 := runtimecontext.NewSession("conn-2", "192.0.2.1:2000", runtimecontext.PeerIdentity{ID: "agent-a"})
+	peerB := runtimecontext.NewSession("conn-3", "192.0.2.2:1000", runtimecontext.PeerIdentity{ID: "agent-b"})
+
+	s := New(log.New(io.Discard, "", 0), WithReplayProtection(time.Minute, ReplayScopeServer))
+	if err := s.checkReplay(s.replay, peerA, env, now); err != nil {
+		t.Fatalf("first envelope: %v", err)
+	}
+	if err := s.checkReplay(s.replay, peerB, env, now); core.CodeFromError(err) != core.CodeDuplicateMsgID {
+		t.Fatalf("expected server-wide duplicate, got %v", err)
+	}
+
+	s = New(log.New(io.Discard, "", 0), WithReplayProtection(time.Minute, ReplayScopeIdentity))
+	if err := s.checkReplay(s.replay, peerA, env, now); err != nil {
+		t.Fatalf("first envelope: %v", err)
+	}
+	if err := s.checkReplay(s.replay, peerB, env, now); err != nil {
+		t.Fatalf("other identity should pass: %v", err)
+	}
+	if err := s.checkReplay(s.replay, peerA2, env, now); core.CodeFromError(err) != core.CodeDuplicateMsgID {
+		t.Fatalf("expected duplicate on a fresh connection of the same identity, got %v", err)
+	}
+}
+
+func TestCheckReplayFollowsClockSkew(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s := New(log.New(io.Discard, "", 0), WithTimestampSkew(time.Minute), WithReplayProtection(time.Second, ReplayScopeServer))
+	sess := runtimecontext.NewSession("conn-1", "192.0.2.1:1000", runtimecontext.PeerIdentity{})
+	env := core.Envelope{MsgID: []byte("msg-replay-0001"), TsUnixMs: uint64(now.UnixMilli())}
+
+	if err := s.checkReplay(s.replay, sess, env, now); err != nil {
+		t.Fatalf("first envelope: %v", err)
+	}
+	// Past the replay window but within the accepted skew.
+	if err := s.checkReplay(s.replay, sess, env, now.Add(30*time.Second)); core.CodeFromError(err) != core.CodeDuplicateMsgID {
+		t.Fatalf("expected duplicate while the timestamp is accepted, got %v", err)
+	}
+	if err := s.checkReplay(s.replay, sess, env, now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("expected entry to expire with the skew, got %v", err)
+	}
+}
+
+func TestReplayOnFreshConnectionRejected(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0), WithReplayProtection(time.Minute, ReplayScopeServer))
+	req := testRPCReq(t, "msg-rpc-00000001", "rpc-1", "demo.echo")
+
+	first := startTestConn(t, s)
+	writeTestEnvelope(t, first, req)
+	if got := readTestEnvelope(t, first); got.ProfileID != ProfileSWPRPC {
+		t.Fatalf("expected rpc response, got profile=%d", got.ProfileID)
+	}
+
+	second := startTestConn(t, s)
+	writeTestEnvelope(t, second, req)
+	env := readTestEnvelope(t, second)
+	frame, err := core.DecodeErrorPayload(env.Payload)
+	if !core.IsErrorEnvelope(env) || err != nil || frame.Code != "ERR_DUPLICATE_MSG_ID" {
+		t.Fatalf("expected ERR_DUPLICATE_MSG_ID, got %+v (%v)", frame, err)
+	}
+}
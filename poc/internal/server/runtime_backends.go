@@ -2,11 +2,13 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"sync"
 
+	"swp-spec-kit/poc/internal/core"
 	"swp-spec-kit/poc/internal/p1agdisc"
 	"swp-spec-kit/poc/internal/p1artifact"
 	"swp-spec-kit/poc/internal/p1events"
@@ -15,6 +17,7 @@ import (
 	"swp-spec-kit/poc/internal/p1rpc"
 	"swp-spec-kit/poc/internal/p1state"
 	"swp-spec-kit/poc/internal/p1tooldisc"
+	runtimecontext "swp-spec-kit/poc/internal/runtime/context"
 )
 
 var (
@@ -122,98 +125,122 @@ type runtimeBackends struct {
 	obs        OBSBackend
 }
 
-type Option func(*runtimeBackends)
+// SessionScoped is implemented by backends that keep per-connection state.
+// Before each dispatch the server calls ForSession with the request's
+// session and uses the returned backend for that request.
+type SessionScoped[T any] interface {
+	ForSession(*runtimecontext.Session) T
+}
+
+func sessionBackend[T any](ctx context.Context, b T) T {
+	scoped, ok := any(b).(SessionScoped[T])
+	if !ok {
+		return b
+	}
+	if sess, ok := runtimecontext.SessionFromContext(ctx); ok {
+		return scoped.ForSession(sess)
+	}
+	return b
+}
+
+// withBackend adapts a per-msg_type handler to core.Handler, resolving b
+// for the request's session on each call.
+func withBackend[T any](b T, fn func(context.Context, core.Envelope, T) ([]core.Envelope, error)) core.Handler {
+	return func(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
+		return fn(ctx, env, sessionBackend(ctx, b))
+	}
+}
 
 func WithA2ABackend(b A2ABackend) Option {
-	return func(r *runtimeBackends) {
+	return func(o *options) {
 		if b != nil {
-			r.a2a = b
+			o.runtime.a2a = b
 		}
 	}
 }
 
 func WithArtifactBackend(b ArtifactBackend) Option {
-	return func(r *runtimeBackends) {
+	return func(o *options) {
 		if b != nil {
-			r.artifact = b
+			o.runtime.artifact = b
 		}
 	}
 }
 
 func WithStateBackend(b StateBackend) Option {
-	return func(r *runtimeBackends) {
+	return func(o *options) {
 		if b != nil {
-			r.state = b
+			o.runtime.state = b
 		}
 	}
 }
 
 func WithAGDISCBackend(b AGDISCBackend) Option {
-	return func(r *runtimeBackends) {
+	return func(o *options) {
 		if b != nil {
-			r.agdisc = b
+			o.runtime.agdisc = b
 		}
 	}
 }
 
 func WithToolDiscBackend(b ToolDiscBackend) Option {
-	return func(r *runtimeBackends) {
+	return func(o *options) {
 		if b != nil {
-			r.tooldisc = b
+			o.runtime.tooldisc = b
 		}
 	}
 }
 
 func WithRPCBackend(b RPCBackend) Option {
-	return func(r *runtimeBackends) {
+	return func(o *options) {
 		if b != nil {
-			r.rpc = b
+			o.runtime.rpc = b
 		}
 	}
 }
 
 func WithEventsBackend(b EventsBackend) Option {
-	return func(r *runtimeBackends) {
+	return func(o *options) {
 		if b != nil {
-			r.events = b
+			o.runtime.events = b
 		}
 	}
 }
 
 func WithCredBackend(b CredBackend) Option {
-	return func(r *runtimeBackends) {
+	return func(o *options) {
 		if b != nil {
-			r.cred = b
+			o.runtime.cred = b
 		}
 	}
 }
 
 func WithPolicyHintBackend(b PolicyHintBackend) Option {
-	return func(r *runtimeBackends) {
+	return func(o *options) {
 		if b != nil {
-			r.policyHint = b
+			o.runtime.policyHint = b
 		}
 	}
 }
 
 func WithRelayBackend(b RelayBackend) Option {
-	return func(r *runtimeBackends) {
+	return func(o *options) {
 		if b != nil {
-			r.relay = b
+			o.runtime.relay = b
 		}
 	}
 }
 
 func WithOBSBackend(b OBSBackend) Option {
-	return func(r *runtimeBackends) {
+	return func(o *options) {
 		if b != nil {
-			r.obs = b
+			o.runtime.obs = b
 		}
 	}
 }
 
-func newRuntimeBackends(opts ...Option) runtimeBackends {
-	r := runtimeBackends{
+func newRuntimeBackends() runtimeBackends {
+	return runtimeBackends{
 		a2a:        newInMemoryA2ABackend(),
 		artifact:   newInMemoryArtifactBackend(),
 		state:      newInMemoryStateBackend(),
@@ -226,12 +253,6 @@ func newRuntimeBackends(opts ...Option) runtimeBackends {
 		relay:      newInMemoryRelayBackend(),
 		obs:        newInMemoryOBSBackend(),
 	}
-	for _, opt := range opts {
-		if opt != nil {
-			opt(&r)
-		}
-	}
-	return r
 }
 
 var defaultBackends = newRuntimeBackends()
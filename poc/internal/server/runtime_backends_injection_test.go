@@ -684,7 +684,7 @@ func TestA2ABackendFaultInjection(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := handleA2AWithBackend(context.Background(), tt.env, tt.backend)
+			_, err := route(context.Background(), tt.env, a2aHandlers(tt.backend))
 			if err == nil {
 				t.Fatalf("expected error")
 			}
@@ -726,7 +726,7 @@ func TestArtifactBackendFaultInjection(t *testing.T) {
 	}
 
 	t.Run("ordering-error-maps-to-artifact-err-envelope", func(t *testing.T) {
-		out, err := handleSWPArtifactWithBackend(context.Background(), env, &faultArtifactBackend{appendErr: errArtifactChunkOrdering})
+		out, err := handleArtifactChunk(context.Background(), env, &faultArtifactBackend{appendErr: errArtifactChunkOrdering})
 		if err != nil {
 			t.Fatalf("expected artifact error envelope, got dispatch err: %v", err)
 		}
@@ -743,7 +743,7 @@ func TestArtifactBackendFaultInjection(t *testing.T) {
 	})
 
 	t.Run("unexpected-error-maps-to-internal-error", func(t *testing.T) {
-		_, err := handleSWPArtifactWithBackend(context.Background(), env, &faultArtifactBackend{appendErr: errors.New("disk failure")})
+		_, err := handleArtifactChunk(context.Background(), env, &faultArtifactBackend{appendErr: errors.New("disk failure")})
 		if err == nil {
 			t.Fatalf("expected error")
 		}
@@ -773,7 +773,7 @@ func TestPolicyHintConflictFromInjectedBackend(t *testing.T) {
 		t.Fatalf("encode POLICYHINT set payload: %v", err)
 	}
 
-	out, err := handleSWPPolicyHintWithBackend(context.Background(), core.Envelope{
+	out, err := handlePolicyHintSet(context.Background(), core.Envelope{
 		ProfileID: ProfileSWPPolicyHint,
 		MsgType:   policyHintMsgTypeSet,
 		MsgID:     []byte("12345678abcdefgh"),
@@ -820,7 +820,7 @@ func TestRelayDuplicatePublishFromInjectedBackend(t *testing.T) {
 		t.Fatalf("encode RELAY publish payload: %v", err)
 	}
 
-	out, err := handleSWPRelayWithBackend(context.Background(), core.Envelope{
+	out, err := handleRelayPublish(context.Background(), core.Envelope{
 		ProfileID: ProfileSWPRelay,
 		MsgType:   relayMsgTypePublish,
 		MsgID:     []byte("12345678abcdefgh"),
@@ -866,7 +866,7 @@ func TestStateMissingParentFromInjectedBackend(t *testing.T) {
 		t.Fatalf("encode STATE put payload: %v", err)
 	}
 
-	_, err = handleSWPStateWithBackend(context.Background(), core.Envelope{
+	_, err = handleStatePut(context.Background(), core.Envelope{
 		ProfileID: ProfileSWPState,
 		MsgType:   stateMsgTypePut,
 		MsgID:     []byte("12345678abcdefgh"),
@@ -911,12 +911,12 @@ func TestRPCBackendFaultInjection(t *testing.T) {
 	}
 
 	t.Run("request-error-maps-to-internal", func(t *testing.T) {
-		_, err := handleSWPRPCWithBackend(context.Background(), core.Envelope{
+		_, err := handleRPCReq(context.Background(), core.Envelope{
 			ProfileID: ProfileSWPRPC,
 			MsgType:   rpcMsgTypeReq,
 			MsgID:     []byte("12345678abcdefgh"),
 			Payload:   reqPayload,
-		}, &faultRPCBackend{requestErr: errors.New("rpc backend failed")}, nil)
+		}, &faultRPCBackend{requestErr: errors.New("rpc backend failed")})
 		if err == nil {
 			t.Fatalf("expected error")
 		}
@@ -926,14 +926,14 @@ func TestRPCBackendFaultInjection(t *testing.T) {
 	})
 
 	t.Run("unsupported-backend-message-type-maps-to-internal", func(t *testing.T) {
-		_, err := handleSWPRPCWithBackend(context.Background(), core.Envelope{
+		_, err := handleRPCReq(context.Background(), core.Envelope{
 			ProfileID: ProfileSWPRPC,
 			MsgType:   rpcMsgTypeReq,
 			MsgID:     []byte("12345678abcdefgh"),
 			Payload:   reqPayload,
 		}, &faultRPCBackend{
 			responseTypes: []RPCBackendMessage{{MsgType: 99}},
-		}, nil)
+		})
 		if err == nil {
 			t.Fatalf("expected error")
 		}
@@ -969,7 +969,7 @@ func TestEventsBackendFaultInjection(t *testing.T) {
 		t.Fatalf("encode EVENTS publish payload: %v", err)
 	}
 
-	_, err = handleSWPEventsWithBackend(context.Background(), core.Envelope{
+	_, err = handleEventsPublish(context.Background(), core.Envelope{
 		ProfileID: ProfileSWPEvents,
 		MsgType:   eventsMsgTypePublish,
 		MsgID:     []byte("12345678abcdefgh"),
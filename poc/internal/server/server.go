@@ -2,15 +2,23 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"swp-spec-kit/poc/internal/core"
+	"swp-spec-kit/poc/internal/pipeconn"
+	runtimeclock "swp-spec-kit/poc/internal/runtime/clock"
 	runtimecontext "swp-spec-kit/poc/internal/runtime/context"
+	runtimeerrors "swp-spec-kit/poc/internal/runtime/errors"
 )
 
 const (
@@ -28,116 +36,158 @@ const (
 	ProfileSWPRelay      uint64 = 19
 )
 
-type Server struct {
-	logger    *log.Logger
-	limits    core.Limits
-	validator core.Validator
-	router    *core.Router
-	runtime   runtimeBackends
+var profileNames = map[uint64]string{
+	ProfileMCPMap:        "mcp",
+	ProfileA2A:           "a2a",
+	ProfileSWPAGDISC:     "agdisc",
+	ProfileSWPToolDisc:   "tooldisc",
+	ProfileSWPRPC:        "rpc",
+	ProfileSWPEvents:     "events",
+	ProfileSWPArtifact:   "artifact",
+	ProfileSWPCred:       "cred",
+	ProfileSWPPolicyHint: "policyhint",
+	ProfileSWPState:      "state",
+	ProfileSWPOBS:        "obs",
+	ProfileSWPRelay:      "relay",
 }
 
-const (
-	defaultConnRateWindow         = time.Second
-	defaultConnMaxFramesPerWindow = 128
-	defaultDuplicateMsgIDWindow   = 5 * time.Second
-)
-
-var (
-	errRateLimitExceeded = errors.New("rate limit exceeded")
-	errDuplicateMsgID    = errors.New("duplicate in-flight msg_id")
-)
-
-type connPolicy struct {
-	windowStart time.Time
-	frameCount  int
-	rateWindow  time.Duration
-	maxFrames   int
-	msgIDWindow time.Duration
-	seenMsgID   map[string]time.Time
-}
-
-func newConnPolicy(now time.Time) *connPolicy {
-	return &connPolicy{
-		windowStart: now,
-		rateWindow:  defaultConnRateWindow,
-		maxFrames:   defaultConnMaxFramesPerWindow,
-		msgIDWindow: defaultDuplicateMsgIDWindow,
-		seenMsgID:   make(map[string]time.Time),
+// ProfileName returns the short profile name used in telemetry event types
+// and conformance vector categories.
+func ProfileName(profileID uint64) string {
+	if name, ok := profileNames[profileID]; ok {
+		return name
 	}
+	return "profile" + strconv.FormatUint(profileID, 10)
 }
 
-func (p *connPolicy) check(now time.Time, msgID []byte) error {
-	if now.Sub(p.windowStart) >= p.rateWindow {
-		p.windowStart = now
-		p.frameCount = 0
-	}
-	p.frameCount++
-	if p.frameCount > p.maxFrames {
-		return errRateLimitExceeded
-	}
-
-	threshold := now.Add(-p.msgIDWindow)
-	for k, ts := range p.seenMsgID {
-		if ts.Before(threshold) {
-			delete(p.seenMsgID, k)
-		}
-	}
+type Server struct {
+	logger                *log.Logger
+	limits                core.Limits
+	validator             core.Validator
+	router                *core.Router
+	runtime               runtimeBackends
+	maxConcurrentDispatch int
+	compressMinBytes      int
+	reassembly            core.ReassemblyLimits
+	hello                 core.Hello
+	helloRequired         bool
+	insecurePlaintext     bool
+	pushQueue             int
+	slowConsumer          SlowConsumerPolicy
+	replayWindow          time.Duration
+	replayScope           ReplayScope
+	replay                *replayCache
+	profileLimits         map[uint64]ProfileLimits
+	wsOrigins             []string
+	connIDs               atomic.Uint64
+	live                  atomic.Pointer[liveConfig]
 
-	key := string(msgID)
-	if last, ok := p.seenMsgID[key]; ok && now.Sub(last) < p.msgIDWindow {
-		return errDuplicateMsgID
-	}
-	p.seenMsgID[key] = now
-	return nil
+	mu           sync.Mutex
+	listeners    map[net.Listener]struct{}
+	conns        map[*trackedConn]struct{}
+	connWG       sync.WaitGroup
+	shuttingDown bool
 }
 
+const coreErrorMsgIDBytes = 16
+
+var (
+	errDuplicateMsgID    = core.Wrap(core.CodeDuplicateMsgID, errors.New("duplicate in-flight msg_id"))
+	errReassemblyTimeout = core.Wrap(core.CodeInvalidEnvelope, errors.New("fragment reassembly timed out"))
+)
+
 func New(logger *log.Logger, opts ...Option) *Server {
 	if logger == nil {
 		logger = log.Default()
 	}
-	runtime := newRuntimeBackends(opts...)
-	limits := core.DefaultLimits()
+	o := newOptions(opts...)
+	limits := o.limits
 	validator := core.DefaultValidator()
 	validator.Limits = limits
-	validator.KnownProfiles = map[uint64]struct{}{
-		ProfileMCPMap:        {},
-		ProfileA2A:           {},
-		ProfileSWPAGDISC:     {},
-		ProfileSWPToolDisc:   {},
-		ProfileSWPRPC:        {},
-		ProfileSWPEvents:     {},
-		ProfileSWPArtifact:   {},
-		ProfileSWPCred:       {},
-		ProfileSWPPolicyHint: {},
-		ProfileSWPState:      {},
-		ProfileSWPOBS:        {},
-		ProfileSWPRelay:      {},
+	if o.maxClockSkew > 0 {
+		validator.EnforceTimestamp = true
+		validator.MaxClockSkew = o.maxClockSkew
 	}
 
 	s := &Server{
-		logger:    logger,
-		limits:    limits,
-		validator: validator,
-		runtime:   runtime,
+		logger:                logger,
+		limits:                limits,
+		runtime:               o.runtime,
+		maxConcurrentDispatch: o.maxConcurrentDispatch,
+		compressMinBytes:      o.compressMinBytes,
+		reassembly:            o.reassembly,
+		helloRequired:         o.helloRequired,
+		insecurePlaintext:     o.insecurePlaintext,
+		pushQueue:             o.pushQueue,
+		slowConsumer:          o.slowConsumer,
+		replayWindow:          o.replayWindow,
+		replayScope:           o.replayScope,
+		profileLimits:         o.profileLimits,
+		wsOrigins:             o.wsOrigins,
+		listeners:             make(map[net.Listener]struct{}),
+		conns:                 make(map[*trackedConn]struct{}),
 	}
 	router := core.NewRouter()
-	router.Register(ProfileMCPMap, s.handleMCP)
-	router.Register(ProfileA2A, s.handleA2A)
-	router.Register(ProfileSWPAGDISC, s.handleSWPAGDISC)
-	router.Register(ProfileSWPToolDisc, s.handleSWPToolDisc)
-	router.Register(ProfileSWPRPC, s.handleSWPRPC)
-	router.Register(ProfileSWPEvents, s.handleSWPEvents)
-	router.Register(ProfileSWPArtifact, s.handleSWPArtifact)
-	router.Register(ProfileSWPCred, s.handleSWPCred)
-	router.Register(ProfileSWPPolicyHint, s.handleSWPPolicyHint)
-	router.Register(ProfileSWPState, s.handleSWPState)
-	router.Register(ProfileSWPOBS, s.handleSWPOBS)
-	router.Register(ProfileSWPRelay, s.handleSWPRelay)
+	router.Use(s.telemetryMiddleware, s.recoverMiddleware)
+	for _, p := range s.profileRoutes() {
+		if !o.profileEnabled(p.profileID) {
+			continue
+		}
+		for mt, h := range p.inbound {
+			router.RegisterMsgType(p.profileID, mt, h)
+		}
+		router.RegisterOutbound(p.profileID, p.outbound...)
+	}
+	validator.KnownProfiles = router.Profiles()
 	s.router = router
+	s.validator = validator
+	s.live.Store(&liveConfig{timeouts: o.timeouts, rateLimits: o.rateLimits, maxConns: o.maxConns})
+	if s.replayScope != ReplayScopeConn {
+		s.replay = newReplayCache(s.replayWindow)
+	}
+	s.hello = s.localHello()
 	return s
 }
 
+type profileRoute struct {
+	profileID uint64
+	inbound   map[uint64]core.Handler
+	outbound  []uint64
+}
+
+func (s *Server) profileRoutes() []profileRoute {
+	return []profileRoute{
+		{ProfileMCPMap, mcpHandlers(), []uint64{mcpMsgTypeResponse}},
+		{ProfileA2A, a2aHandlers(s.runtime.a2a), nil},
+		{ProfileSWPAGDISC, agdiscHandlers(s.runtime.agdisc), []uint64{agdiscMsgTypeDoc, agdiscMsgTypeNotModified, agdiscMsgTypeErr}},
+		{ProfileSWPToolDisc, tooldiscHandlers(s.runtime.tooldisc), []uint64{tooldiscMsgTypeListResp, tooldiscMsgTypeGetResp, tooldiscMsgTypeErr}},
+		{ProfileSWPRPC, rpcHandlers(s.runtime.rpc), []uint64{rpcMsgTypeResp, rpcMsgTypeErr, rpcMsgTypeStreamItem}},
+		{ProfileSWPEvents, eventsHandlers(s.runtime.events, s.runtime.obs), []uint64{eventsMsgTypeBatch, eventsMsgTypeErr}},
+		{ProfileSWPArtifact, artifactHandlers(s.runtime.artifact), []uint64{artifactMsgTypeErr}},
+		{ProfileSWPCred, credHandlers(s.runtime.cred), []uint64{credMsgTypeErr}},
+		{ProfileSWPPolicyHint, policyHintHandlers(s.runtime.policyHint), []uint64{policyHintMsgTypeAck, policyHintMsgTypeViolation, policyHintMsgTypeErr}},
+		{ProfileSWPState, stateHandlers(s.runtime.state), []uint64{stateMsgTypeErr}},
+		{ProfileSWPOBS, obsHandlers(s.runtime.obs), []uint64{obsMsgTypeDoc, obsMsgTypeErr}},
+		{ProfileSWPRelay, relayHandlers(s.runtime.relay), nil},
+	}
+}
+
+// Routes lists the (profile_id, msg_type) pairs this server registers.
+func (s *Server) Routes() []core.Route {
+	return s.router.Routes()
+}
+
+// Serve accepts connections on ln until ln is closed, ctx is done or
+// Shutdown is called. Connections already accepted keep running; use
+// Shutdown to drain them.
 func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	if !s.trackListener(ln) {
+		_ = ln.Close()
+		return nil
+	}
+	defer s.untrackListener(ln)
+	stop := context.AfterFunc(ctx, func() { _ = ln.Close() })
+	defer stop()
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
@@ -151,77 +201,272 @@ func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
 			}
 			return fmt.Errorf("accept: %w", err)
 		}
+		if s.plaintextRefused(conn) {
+			s.logger.Printf("security: refusing plaintext connection from %s on non-loopback %s", conn.RemoteAddr(), conn.LocalAddr())
+			_ = conn.Close()
+			continue
+		}
 		go s.handleConn(ctx, conn)
 	}
 }
 
-func (s *Server) handleConn(ctx context.Context, conn net.Conn) {
+// ServeConn serves one SWP connection on rwc, such as stdin/stdout or an
+// accepted Unix socket connection, and returns once it ends. Unlike Serve it
+// does not check for plaintext: the caller vouches for the channel (S1).
+// Deadlines are applied when rwc supports them.
+func (s *Server) ServeConn(ctx context.Context, rwc io.ReadWriteCloser) {
+	s.handleConn(ctx, rwc)
+}
+
+func (s *Server) handleConn(ctx context.Context, rwc io.ReadWriteCloser) {
+	conn := pipeconn.New(rwc, "pipe")
 	defer conn.Close()
-	policy := newConnPolicy(time.Now())
+	defer s.recoverConn(conn)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tracked, err := s.trackConn(conn, cancel)
+	if err != nil {
+		if errors.Is(err, errConnLimit) {
+			s.refuseConn(ctx, conn, err)
+		}
+		return
+	}
+	defer s.untrackConn(tracked)
+	defer tracked.startLifetime(s)()
+	var peer runtimecontext.PeerIdentity
+	switch c := conn.(type) {
+	case *tls.Conn:
+		id, verified, err := s.tlsHandshake(ctx, c)
+		if err != nil {
+			s.logger.Printf("security: tls handshake with %s failed: %v", conn.RemoteAddr(), err)
+			return
+		}
+		if verified {
+			peer = id
+			ctx = runtimecontext.WithPeerIdentity(ctx, id)
+		}
+	case channelConn:
+		state := c.channelState()
+		if state == nil {
+			break
+		}
+		if id, verified := peerIdentity(*state); verified {
+			peer = id
+			ctx = runtimecontext.WithPeerIdentity(ctx, id)
+		}
+	}
+	sess := runtimecontext.NewSession("conn-"+strconv.FormatUint(s.connIDs.Add(1), 10), conn.RemoteAddr().String(), peer)
+	ctx = runtimecontext.WithSession(ctx, sess)
+	d := newConnDispatcher(s, conn, s.maxConcurrentDispatch)
+	defer d.close()
+	sess.SetSender(d.push)
+
+	replay := s.replay
+	if replay == nil {
+		replay = newReplayCache(s.replayWindow)
+	}
+	fr := core.NewFrameReader(conn, s.limits.MaxFrameBytes)
+	inFrame := false
+	fr.OnFrameStart(func() {
+		inFrame = true
+		tracked.setReadDeadline(deadlineAfter(s.live.Load().timeouts.FrameRead))
+	})
+	ra := core.NewReassembler(s.reassembly)
+	validator := s.validator
+	first := true
+	// frame is the last frame read. Envelopes decoded from it alias its
+	// pooled buffer, so it is released before the next read unless submit
+	// took it over.
+	var frame core.Frame
+	defer func() { frame.Release() }()
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
 		}
+		if g, ok := tracked.drainNotice(); ok {
+			s.sendGoaway(d, g)
+			return
+		}
 
-		frame, err := core.ReadFrame(conn, s.limits.MaxFrameBytes)
+		inFrame = false
+		idle := s.live.Load().timeouts.Idle
+		deadline := deadlineAfter(idle)
+		tracked.setReadDeadline(deadline)
+		frame.Release()
+		frame, err = fr.ReadFrame()
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				return
 			}
+			if g, ok := tracked.drainNotice(); ok {
+				s.sendGoaway(d, g)
+				return
+			}
+			// A timeout before the idle deadline passed is the transport
+			// repeating an earlier failure, so it is not retried.
+			if !inFrame && isTimeout(err) && !deadline.IsZero() && !time.Now().Before(deadline) {
+				if d.busy() {
+					continue
+				}
+				s.logger.Printf("closing idle connection %s after %s", conn.RemoteAddr(), idle)
+				return
+			}
 			s.logger.Printf("read frame error: %v", err)
+			d.wait()
+			d.sendError(nil, err, true)
 			return
 		}
 
-		env, err := core.DecodeEnvelopeE1(frame, s.limits)
+		env, err := core.DecodeEnvelopeE1Aliased(frame.Body, s.limits)
 		if err != nil {
 			s.logger.Printf("decode envelope error: %v", err)
+			d.sendError(nil, err, false)
+			continue
+		}
+		if core.IsHelloEnvelope(env) {
+			if !first {
+				s.logger.Printf("hello error: %v", errHelloNotFirst)
+				d.sendError(env.MsgID, errHelloNotFirst, false)
+				continue
+			}
+			first = false
+			n, reply, err := s.handshake(env)
+			if err != nil {
+				s.logger.Printf("hello error: %v", err)
+				d.sendError(env.MsgID, err, true)
+				return
+			}
+			validator = n.Restrict(validator)
+			d.setPeer(n)
+			sess.SetCapabilities(n)
+			d.send([]core.Envelope{reply})
+			continue
+		}
+		if first && s.helloRequired {
+			s.logger.Printf("hello error: %v", errHelloRequired)
+			d.sendError(env.MsgID, errHelloRequired, true)
 			return
 		}
+		first = false
 
-		if err := s.validator.ValidateEnvelope(env); err != nil {
+		if err := validator.ValidateEnvelope(env); err != nil {
 			s.logger.Printf("validate envelope error: %v", err)
-			return
+			d.sendError(env.MsgID, err, false)
+			continue
+		}
+
+		now := time.Now()
+		for _, msgID := range ra.Expire(now) {
+			s.logger.Printf("fragment reassembly timed out for msg_id %x", msgID)
+			d.sendError(msgID, errReassemblyTimeout, false)
 		}
-		if err := policy.check(time.Now(), env.MsgID); err != nil {
-			if errors.Is(err, errRateLimitExceeded) || errors.Is(err, errDuplicateMsgID) {
+		// A message is charged when its first frame arrives, before any
+		// fragment is buffered.
+		if info, fragmented, _ := core.FragmentOf(env); !fragmented || info.Index == 0 {
+			if err := s.checkRate(sess, env, now); err != nil {
 				s.logger.Printf("connection policy violation: %v", err)
-			} else {
-				s.logger.Printf("connection policy error: %v", err)
+				d.sendError(env.MsgID, err, false)
+				continue
+			}
+			if err := s.checkProfileRate(sess, env, now); err != nil {
+				s.logger.Printf("profile limit violation: %v", err)
+				d.sendError(env.MsgID, err, false)
+				continue
 			}
-			return
+		}
+		maxPayload := s.limits.MaxPayloadBytes
+		if env.Flags&core.FlagFragment != 0 {
+			whole, complete, err := ra.Add(env, now)
+			if err != nil {
+				s.logger.Printf("fragment reassembly error: %v", err)
+				d.sendError(env.MsgID, err, false)
+				continue
+			}
+			if !complete {
+				continue
+			}
+			env = whole
+			maxPayload = s.reassembly.MaxMessageBytes
+		}
+		if env, err = core.DecompressPayload(env, maxPayload); err != nil {
+			s.logger.Printf("decompress payload error: %v", err)
+			d.sendError(env.MsgID, err, false)
+			continue
 		}
 
-		reqCtx := runtimecontext.WithMessageMeta(ctx, runtimecontext.MessageMeta{
-			ProfileID: env.ProfileID,
-			MsgID:     env.MsgID,
-		})
-		obsDoc := s.runtime.obs.GetDoc()
-		reqCtx = runtimecontext.WithCorrelation(reqCtx, runtimecontext.Correlation{
-			Traceparent: obsDoc.Traceparent,
-			Tracestate:  obsDoc.Tracestate,
-			MsgID:       obsDoc.MsgID,
-			TaskID:      obsDoc.TaskID,
-			RPCID:       obsDoc.RPCID,
-		})
-
-		responses, err := s.router.Dispatch(reqCtx, env)
-		if err != nil {
-			s.logger.Printf("dispatch error: %v", err)
+		if err := s.checkProfile(env); err != nil {
+			s.logger.Printf("profile limit violation: %v", err)
+			d.sendError(env.MsgID, err, false)
+			continue
+		}
+		if err := s.checkReplay(replay, sess, env, time.Now()); err != nil {
+			s.logger.Printf("connection policy violation: %v", err)
+			d.sendError(env.MsgID, err, false)
+			continue
+		}
+
+		held := frame
+		frame = core.Frame{}
+		if !d.submit(ctx, env, held.Release) {
 			return
 		}
+	}
+}
 
-		for _, resp := range responses {
-			encoded, err := core.EncodeEnvelopeE1(resp)
-			if err != nil {
-				s.logger.Printf("encode response error: %v", err)
-				return
-			}
-			if err := core.WriteFrame(conn, encoded, s.limits.MaxFrameBytes); err != nil {
-				s.logger.Printf("write response error: %v", err)
-				return
-			}
+func (s *Server) dispatch(ctx context.Context, env core.Envelope) ([]core.Envelope, <-chan struct{}, error) {
+	reqCtx := runtimecontext.WithMessageMeta(ctx, runtimecontext.MessageMeta{
+		ProfileID: env.ProfileID,
+		MsgID:     env.MsgID,
+	})
+	obsDoc := sessionBackend(ctx, s.runtime.obs).GetDoc()
+	corr := runtimecontext.Correlation{
+		Traceparent: obsDoc.Traceparent,
+		Tracestate:  obsDoc.Tracestate,
+		MsgID:       obsDoc.MsgID,
+		TaskID:      obsDoc.TaskID,
+		RPCID:       obsDoc.RPCID,
+	}
+	// Envelope-level trace context takes precedence over the OBS document.
+	if tc, ok, err := core.TraceContextOf(env); err == nil && ok {
+		corr.Traceparent = tc.Traceparent
+		corr.Tracestate = tc.Tracestate
+	}
+	reqCtx = runtimecontext.WithCorrelation(reqCtx, corr)
+	if deadline, ok, err := core.Deadline(env); err == nil && ok {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithDeadline(reqCtx, deadline)
+		defer cancel()
+	}
+	t := s.live.Load().timeouts.Handler
+	if pt := s.profileLimits[env.ProfileID].HandlerTimeout; pt > 0 {
+		t = pt
+	}
+	if t > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(reqCtx, t)
+		defer cancel()
+	}
+	return s.dispatchBounded(reqCtx, env)
+}
+
+// coreErrorEnvelope builds the core error envelope reporting err to the
+// peer. The caller decides whether the connection survives.
+func (s *Server) coreErrorEnvelope(msgID []byte, err error, fatal bool) (core.Envelope, bool) {
+	frame := core.ErrorFrame{
+		Code:    runtimeerrors.Canonical(string(core.CodeFromError(err))),
+		MsgID:   append([]byte(nil), msgID...),
+		Message: err.Error(),
+		Fatal:   fatal,
+	}
+	envMsgID := msgID
+	if len(envMsgID) < s.limits.MinMsgIDBytes || len(envMsgID) > s.limits.MaxMsgIDBytes {
+		envMsgID = make([]byte, coreErrorMsgIDBytes)
+		if _, err := rand.Read(envMsgID); err != nil {
+			s.logger.Printf("core error msg_id: %v", err)
+			return core.Envelope{}, false
 		}
 	}
+	return core.NewErrorEnvelope(envMsgID, runtimeclock.UnixMilli(nil), frame), true
 }
@@ -9,6 +9,15 @@ import (
 	"swp-spec-kit/poc/internal/p1rpc"
 )
 
+// route dispatches env through a router holding handlers, as Server does.
+func route(ctx context.Context, env core.Envelope, handlers map[uint64]core.Handler) ([]core.Envelope, error) {
+	r := core.NewRouter()
+	for mt, h := range handlers {
+		r.RegisterMsgType(env.ProfileID, mt, h)
+	}
+	return r.Dispatch(ctx, env)
+}
+
 func TestHandleMCPToolsList(t *testing.T) {
 	payload, _ := json.Marshal(map[string]any{
 		"jsonrpc": "2.0",
@@ -24,9 +33,9 @@ func TestHandleMCPToolsList(t *testing.T) {
 		Payload:   payload,
 	}
 
-	out, err := handleMCP(context.Background(), env)
+	out, err := route(context.Background(), env, mcpHandlers())
 	if err != nil {
-		t.Fatalf("handleMCP failed: %v", err)
+		t.Fatalf("MCP request failed: %v", err)
 	}
 	if len(out) != 1 {
 		t.Fatalf("expected 1 response, got %d", len(out))
@@ -59,9 +68,9 @@ func TestHandleSWPRPCStreaming(t *testing.T) {
 		Payload:   payload,
 	}
 
-	out, err := handleSWPRPC(context.Background(), env)
+	out, err := route(context.Background(), env, rpcHandlers(defaultBackends.rpc))
 	if err != nil {
-		t.Fatalf("handleSWPRPC failed: %v", err)
+		t.Fatalf("RPC request failed: %v", err)
 	}
 	if len(out) != 3 {
 		t.Fatalf("expected 3 envelopes (2 stream + 1 terminal), got %d", len(out))
@@ -86,3 +95,29 @@ func TestHandleSWPRPCStreaming(t *testing.T) {
 		t.Fatalf("expected rpc_id r1, got %q", string(resp.RPCID))
 	}
 }
+
+func TestServerRejectsUnsupportedMsgType(t *testing.T) {
+	s := New(nil)
+	for _, env := range []core.Envelope{
+		{ProfileID: ProfileMCPMap, MsgType: mcpMsgTypeResponse},
+		{ProfileID: ProfileSWPRPC, MsgType: 99},
+	} {
+		env.MsgID = []byte("12345678abcdefgh")
+		_, err := s.router.Dispatch(context.Background(), env)
+		if core.CodeFromError(err) != core.CodeUnsupportedMsgType {
+			t.Fatalf("profile %d msg_type %d: expected UNSUPPORTED_MSG_TYPE, got %v", env.ProfileID, env.MsgType, err)
+		}
+	}
+}
+
+func TestServerKnownProfilesDerivedFromRoutes(t *testing.T) {
+	s := New(nil)
+	if len(s.validator.KnownProfiles) != len(profileNames) {
+		t.Fatalf("expected %d known profiles, got %d", len(profileNames), len(s.validator.KnownProfiles))
+	}
+	for pid := range profileNames {
+		if _, ok := s.validator.KnownProfiles[pid]; !ok {
+			t.Fatalf("profile %d missing from validator", pid)
+		}
+	}
+}
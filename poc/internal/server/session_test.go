@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+	"swp-spec-kit/poc/internal/p1a2a"
+	runtimecontext "swp-spec-kit/poc/internal/runtime/context"
+)
+
+type sessionScopedOBSBackend struct {
+	mockOBSBackend
+	mu       sync.Mutex
+	sessions map[string]*runtimecontext.Session
+}
+
+func (b *sessionScopedOBSBackend) ForSession(sess *runtimecontext.Session) OBSBackend {
+	b.mu.Lock()
+	b.sessions[sess.ID] = sess
+	b.mu.Unlock()
+	return &b.mockOBSBackend
+}
+
+func TestHandleConnSession(t *testing.T) {
+	obs := &sessionScopedOBSBackend{sessions: make(map[string]*runtimecontext.Session)}
+	s := New(log.New(io.Discard, "", 0), WithOBSBackend(obs))
+	sessions := make(chan *runtimecontext.Session, 4)
+	s.router.Use(func(next core.Handler) core.Handler {
+		return func(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
+			out, err := next(ctx, env)
+			sess, _ := runtimecontext.SessionFromContext(ctx)
+			sessions <- sess
+			return out, err
+		}
+	})
+	recv := func() *runtimecontext.Session {
+		t.Helper()
+		select {
+		case sess := <-sessions:
+			if sess == nil {
+				t.Fatalf("request context has no session")
+			}
+			return sess
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for dispatch")
+			return nil
+		}
+	}
+
+	conn := startTestConn(t, s)
+	hello := core.NewHello(core.DefaultLimits(), core.ProfileVersion{ProfileID: ProfileA2A, Version: 1}, core.ProfileVersion{ProfileID: ProfileSWPRPC, Version: 1})
+	writeTestEnvelope(t, conn, core.NewHelloEnvelope([]byte("msg-hello-000001"), 0, hello))
+	readTestEnvelope(t, conn)
+
+	hs, err := p1a2a.EncodePayloadHandshake(p1a2a.Handshake{AgentID: "agent.demo"})
+	if err != nil {
+		t.Fatalf("encode handshake: %v", err)
+	}
+	writeTestEnvelope(t, conn, core.Envelope{Version: core.CoreVersion, ProfileID: ProfileA2A, MsgType: a2aMsgTypeHandshake, MsgID: []byte("msg-a2a-00000001"), Payload: hs})
+	sess := recv()
+	if !strings.HasPrefix(sess.ID, "conn-") || sess.RemoteAddr == "" || sess.Peer.ID != "" {
+		t.Fatalf("unexpected session %+v", sess)
+	}
+	if sess.AgentID() != "agent.demo" {
+		t.Fatalf("expected agent_id from A2A handshake, got %q", sess.AgentID())
+	}
+	if n, ok := sess.Capabilities(); !ok || !n.HasProfile(ProfileSWPRPC) || n.HasProfile(ProfileSWPState) {
+		t.Fatalf("unexpected capabilities %+v ok=%t", n, ok)
+	}
+
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-rpc-00000001", "rpc-1", "demo.echo"))
+	readTestEnvelope(t, conn)
+	if again := recv(); again != sess {
+		t.Fatalf("expected one session per connection")
+	}
+
+	other := startTestConn(t, s)
+	writeTestEnvelope(t, other, testRPCReq(t, "msg-rpc-00000002", "rpc-2", "demo.echo"))
+	readTestEnvelope(t, other)
+	if second := recv(); second == sess || second.ID == sess.ID || second.AgentID() != "" {
+		t.Fatalf("expected a fresh session for a new connection, got %+v", second)
+	}
+
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
+	if len(obs.sessions) != 2 || obs.sessions[sess.ID] != sess {
+		t.Fatalf("expected backend scoped to both sessions, got %v", obs.sessions)
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+	runtimeclock "swp-spec-kit/poc/internal/runtime/clock"
+)
+
+const goawayReasonShutdown = "server shutting down"
+
+var errShuttingDown = errors.New("server shutting down")
+
+// trackedConn is the shutdown handle of one connection served by
+// handleConn.
+type trackedConn struct {
+	conn   net.Conn
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	draining bool
+	notice   core.Goaway
+}
+
+// trackListener registers ln so Shutdown can close it. It reports false
+// once shutdown has begun.
+func (s *Server) trackListener(ln net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shuttingDown {
+		return false
+	}
+	s.listeners[ln] = struct{}{}
+	return true
+}
+
+func (s *Server) untrackListener(ln net.Listener) {
+	s.mu.Lock()
+	delete(s.listeners, ln)
+	s.mu.Unlock()
+}
+
+// trackConn registers conn so Shutdown can drain it. It fails once shutdown
+// has begun or when the connection cap is reached.
+func (s *Server) trackConn(conn net.Conn, cancel context.CancelFunc) (*trackedConn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shuttingDown {
+		return nil, errShuttingDown
+	}
+	if limit := s.live.Load().maxConns; limit > 0 && len(s.conns) >= limit {
+		return nil, errConnLimit
+	}
+	tc := &trackedConn{conn: conn, cancel: cancel}
+	s.conns[tc] = struct{}{}
+	s.connWG.Add(1)
+	return tc, nil
+}
+
+func (s *Server) untrackConn(tc *trackedConn) {
+	s.mu.Lock()
+	delete(s.conns, tc)
+	s.mu.Unlock()
+	s.connWG.Done()
+}
+
+// drainNotice reports whether the connection is draining and the GOAWAY
+// handleConn must send before it stops reading.
+func (tc *trackedConn) drainNotice() (core.Goaway, bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.notice, tc.draining
+}
+
+// goaway marks the connection as draining and unblocks its reader, which
+// sends the GOAWAY and stops reading. In-flight requests keep running;
+// handleConn returns once they are answered.
+func (tc *trackedConn) goaway(g core.Goaway) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.draining {
+		return
+	}
+	tc.draining = true
+	tc.notice = g
+	_ = tc.conn.SetReadDeadline(time.Now())
+}
+
+func (s *Server) sendGoaway(d *connDispatcher, g core.Goaway) {
+	msgID := make([]byte, coreErrorMsgIDBytes)
+	if _, err := rand.Read(msgID); err != nil {
+		s.logger.Printf("goaway msg_id: %v", err)
+		return
+	}
+	d.send([]core.Envelope{core.NewGoawayEnvelope(msgID, runtimeclock.UnixMilli(nil), g)})
+}
+
+// Shutdown stops accepting connections, sends a core GOAWAY on every open
+// connection and waits for their in-flight requests to be answered. If ctx
+// ends first, the remaining connections are closed, their request contexts
+// cancelled, and ctx.Err() returned without waiting for handlers to return.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shuttingDown = true
+	for ln := range s.listeners {
+		_ = ln.Close()
+	}
+	conns := make([]*trackedConn, 0, len(s.conns))
+	for tc := range s.conns {
+		conns = append(conns, tc)
+	}
+	s.mu.Unlock()
+
+	g := core.Goaway{Reason: goawayReasonShutdown}
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining > 0 {
+			g.DrainMs = uint64(remaining.Milliseconds())
+		}
+	}
+	for _, tc := range conns {
+		tc.goaway(g)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.connWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for tc := range s.conns {
+			tc.cancel()
+			_ = tc.conn.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+)
+
+// serveTestListener runs s on a loopback listener and returns a client
+// connection and a channel carrying Serve's result.
+func serveTestListener(t *testing.T, s *Server) (net.Conn, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(context.Background(), ln) }()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn, served
+}
+
+// startSlowRequest leaves a "slow" request in flight. The fast request
+// behind it is answered only after the reader has dispatched the slow one.
+func startSlowRequest(t *testing.T, conn net.Conn) {
+	t.Helper()
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-slow-0001", "rpc-a", "slow"))
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-fast-0001", "rpc-b", "fast"))
+	if got := readTestEnvelope(t, conn); string(got.MsgID) != "msg-fast-0001" {
+		t.Fatalf("expected fast response, got msg_id %q", got.MsgID)
+	}
+}
+
+func waitGoroutines(t *testing.T, baseline int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("goroutine leak: %d running, baseline %d\n%s", runtime.NumGoroutine(), baseline, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	backend := &blockingRPCBackend{release: make(chan struct{})}
+	s := New(log.New(io.Discard, "", 0), WithRPCBackend(backend))
+	conn, served := serveTestListener(t, s)
+	startSlowRequest(t, conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(ctx) }()
+
+	env := readTestEnvelope(t, conn)
+	if !core.IsGoawayEnvelope(env) {
+		t.Fatalf("expected GOAWAY, got profile=%d msg_type=%d", env.ProfileID, env.MsgType)
+	}
+	g, err := core.DecodeGoawayPayload(env.Payload)
+	if err != nil {
+		t.Fatalf("decode goaway: %v", err)
+	}
+	if g.Reason == "" || g.DrainMs == 0 || g.DrainMs > 5000 {
+		t.Fatalf("unexpected goaway %+v", g)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+
+	close(backend.release)
+	if got := readTestEnvelope(t, conn); string(got.MsgID) != "msg-slow-0001" {
+		t.Fatalf("expected in-flight response, got msg_id %q", got.MsgID)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := core.ReadFrame(conn, core.DefaultMaxFrameBytes); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF after drain, got %v", err)
+	}
+	_ = conn.Close()
+	waitGoroutines(t, baseline)
+}
+
+func TestShutdownForcesCloseAtDeadline(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	backend := &blockingRPCBackend{release: make(chan struct{})}
+	s := New(log.New(io.Discard, "", 0), WithRPCBackend(backend))
+	conn, served := serveTestListener(t, s)
+	startSlowRequest(t, conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	<-served
+	if !core.IsGoawayEnvelope(readTestEnvelope(t, conn)) {
+		t.Fatalf("expected GOAWAY before close")
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("expected connection to be closed, got %v", err)
+	}
+
+	// The backend ignores cancellation; its goroutines exit once released.
+	close(backend.release)
+	_ = conn.Close()
+	waitGoroutines(t, baseline)
+}
+
+func TestServeAfterShutdown(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0))
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	if err := s.Serve(context.Background(), ln); err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	if _, err := ln.Accept(); err == nil {
+		t.Fatalf("expected listener to be closed")
+	}
+}
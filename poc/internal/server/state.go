@@ -18,88 +18,86 @@ const (
 	stateMsgTypeErr   = 4
 )
 
-func handleSWPState(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
-	return handleSWPStateWithBackend(ctx, env, defaultBackends.state)
+func stateHandlers(b StateBackend) map[uint64]core.Handler {
+	return map[uint64]core.Handler{
+		stateMsgTypePut:   withBackend(b, handleStatePut),
+		stateMsgTypeGet:   withBackend(b, handleStateGet),
+		stateMsgTypeDelta: withBackend(b, handleStateDelta),
+	}
 }
 
-func (s *Server) handleSWPState(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
-	return handleSWPStateWithBackend(ctx, env, s.runtime.state)
-}
+func handleStatePut(_ context.Context, env core.Envelope, backend StateBackend) ([]core.Envelope, error) {
+	put, err := p1state.DecodePayloadPut(env.Payload)
+	if err != nil {
+		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid STATE put payload: %w", err))
+	}
+	if len(put.StateID) == 0 {
+		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("state_id required"))
+	}
+	if len(put.Blob) == 0 {
+		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("blob required"))
+	}
 
-func handleSWPStateWithBackend(_ context.Context, env core.Envelope, backend StateBackend) ([]core.Envelope, error) {
-	now := uint64(time.Now().UnixMilli())
+	sum := sha256.Sum256(put.Blob)
+	if !bytes.Equal(sum[:], put.StateID) {
+		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("state_id/hash mismatch"))
+	}
 
-	switch env.MsgType {
-	case stateMsgTypePut:
-		put, err := p1state.DecodePayloadPut(env.Payload)
-		if err != nil {
-			return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid STATE put payload: %w", err))
-		}
-		if len(put.StateID) == 0 {
-			return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("state_id required"))
-		}
-		if len(put.Blob) == 0 {
-			return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("blob required"))
+	for _, parentID := range put.ParentIDs {
+		if !backend.HasState(parentID) {
+			return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("parent state missing"))
 		}
+	}
+	backend.PutState(put)
+	return nil, nil
+}
 
-		sum := sha256.Sum256(put.Blob)
-		if !bytes.Equal(sum[:], put.StateID) {
-			return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("state_id/hash mismatch"))
-		}
+func handleStateGet(_ context.Context, env core.Envelope, backend StateBackend) ([]core.Envelope, error) {
+	now := uint64(time.Now().UnixMilli())
 
-		for _, parentID := range put.ParentIDs {
-			if !backend.HasState(parentID) {
-				return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("parent state missing"))
-			}
-		}
-		backend.PutState(put)
-		return nil, nil
+	get, err := p1state.DecodePayloadGet(env.Payload)
+	if err != nil {
+		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid STATE get payload: %w", err))
+	}
+	if len(get.StateID) == 0 {
+		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("state_id required"))
+	}
 
-	case stateMsgTypeGet:
-		get, err := p1state.DecodePayloadGet(env.Payload)
+	put, ok := backend.GetState(get.StateID)
+	if !ok {
+		errPayload, err := p1state.EncodePayloadErr(p1state.StateErr{Code: "NOT_FOUND", Message: "state not found"})
 		if err != nil {
-			return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid STATE get payload: %w", err))
-		}
-		if len(get.StateID) == 0 {
-			return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("state_id required"))
+			return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode STATE not-found error: %w", err))
 		}
+		return []core.Envelope{newStateEnvelope(env.MsgID, stateMsgTypeErr, now, errPayload)}, nil
+	}
 
-		put, ok := backend.GetState(get.StateID)
-		if !ok {
-			errPayload, err := p1state.EncodePayloadErr(p1state.StateErr{Code: "NOT_FOUND", Message: "state not found"})
-			if err != nil {
-				return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode STATE not-found error: %w", err))
-			}
-			return []core.Envelope{newStateEnvelope(env.MsgID, stateMsgTypeErr, now, errPayload)}, nil
-		}
+	payload, err := p1state.EncodePayloadPut(put)
+	if err != nil {
+		return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode STATE get response: %w", err))
+	}
+	return []core.Envelope{newStateEnvelope(env.MsgID, stateMsgTypePut, now, payload)}, nil
+}
 
-		payload, err := p1state.EncodePayloadPut(put)
-		if err != nil {
-			return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode STATE get response: %w", err))
-		}
-		return []core.Envelope{newStateEnvelope(env.MsgID, stateMsgTypePut, now, payload)}, nil
+func handleStateDelta(_ context.Context, env core.Envelope, backend StateBackend) ([]core.Envelope, error) {
+	now := uint64(time.Now().UnixMilli())
 
-	case stateMsgTypeDelta:
-		delta, err := p1state.DecodePayloadDelta(env.Payload)
-		if err != nil {
-			return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid STATE delta payload: %w", err))
-		}
-		if len(delta.StateID) == 0 {
-			return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("state_id required"))
-		}
+	delta, err := p1state.DecodePayloadDelta(env.Payload)
+	if err != nil {
+		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid STATE delta payload: %w", err))
+	}
+	if len(delta.StateID) == 0 {
+		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("state_id required"))
+	}
 
-		if !backend.HasState(delta.StateID) {
-			errPayload, err := p1state.EncodePayloadErr(p1state.StateErr{Code: "NOT_FOUND", Message: "state not found"})
-			if err != nil {
-				return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode STATE delta not-found error: %w", err))
-			}
-			return []core.Envelope{newStateEnvelope(env.MsgID, stateMsgTypeErr, now, errPayload)}, nil
+	if !backend.HasState(delta.StateID) {
+		errPayload, err := p1state.EncodePayloadErr(p1state.StateErr{Code: "NOT_FOUND", Message: "state not found"})
+		if err != nil {
+			return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode STATE delta not-found error: %w", err))
 		}
-		return nil, nil
-
-	default:
-		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid STATE msg_type %d", env.MsgType))
+		return []core.Envelope{newStateEnvelope(env.MsgID, stateMsgTypeErr, now, errPayload)}, nil
 	}
+	return nil, nil
 }
 
 func cloneStatePut(in p1state.StatePut) p1state.StatePut {
@@ -17,45 +17,28 @@ const (
 	rpcMsgTypeCancel     = 5
 )
 
-func handleSWPRPC(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
-	return handleSWPRPCWithBackend(ctx, env, defaultBackends.rpc, nil)
+func rpcHandlers(b RPCBackend) map[uint64]core.Handler {
+	return map[uint64]core.Handler{
+		rpcMsgTypeReq:    withBackend(b, handleRPCReq),
+		rpcMsgTypeCancel: withBackend(b, handleRPCCancel),
+	}
 }
 
-func (s *Server) handleSWPRPC(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
-	return handleSWPRPCWithBackend(ctx, env, s.runtime.rpc, func(eventType, severity string, body map[string]any, rpcID []byte) {
-		s.emitProfileEvent(ctx, env, eventType, severity, body, nil, rpcID)
-	})
+func handleRPCCancel(_ context.Context, env core.Envelope, backend RPCBackend) ([]core.Envelope, error) {
+	cerr, err := backend.HandleCancel()
+	if err != nil {
+		return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("backend RPC cancel: %w", err))
+	}
+	payload, err := p1rpc.EncodePayloadErr(cerr)
+	if err != nil {
+		return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode RPC error payload: %w", err))
+	}
+	return []core.Envelope{newRPCEnvelope(env.MsgID, rpcMsgTypeErr, runtimeclock.UnixMilli(nil), payload)}, nil
 }
 
-func handleSWPRPCWithBackend(
-	_ context.Context,
-	env core.Envelope,
-	backend RPCBackend,
-	emit func(eventType, severity string, body map[string]any, rpcID []byte),
-) ([]core.Envelope, error) {
+func handleRPCReq(_ context.Context, env core.Envelope, backend RPCBackend) ([]core.Envelope, error) {
 	now := runtimeclock.UnixMilli(nil)
 
-	switch env.MsgType {
-	case rpcMsgTypeCancel:
-		cerr, err := backend.HandleCancel()
-		if err != nil {
-			return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("backend RPC cancel: %w", err))
-		}
-		if emit != nil {
-			emit("swp.rpc.cancel", "info", map[string]any{
-				"code": cerr.ErrorCode,
-			}, cerr.RPCID)
-		}
-		payload, err := p1rpc.EncodePayloadErr(cerr)
-		if err != nil {
-			return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode RPC error payload: %w", err))
-		}
-		return []core.Envelope{newRPCEnvelope(env.MsgID, rpcMsgTypeErr, now, payload)}, nil
-	case rpcMsgTypeReq:
-	default:
-		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid SWP-RPC msg_type %d", env.MsgType))
-	}
-
 	req, err := p1rpc.DecodePayloadReq(env.Payload)
 	if err != nil {
 		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid RPC request protobuf payload: %w", err))
@@ -63,20 +46,9 @@ func handleSWPRPCWithBackend(
 	if req.Method == "" {
 		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("missing method"))
 	}
-	if emit != nil {
-		emit("swp.rpc.request", "info", map[string]any{
-			"method": req.Method,
-		}, req.RPCID)
-	}
 
 	msgs, err := backend.HandleRequest(req)
 	if err != nil {
-		if emit != nil {
-			emit("swp.rpc.error", "error", map[string]any{
-				"method": req.Method,
-				"code":   "INTERNAL_ERROR",
-			}, req.RPCID)
-		}
 		return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("backend RPC request: %w", err))
 	}
 
@@ -88,35 +60,18 @@ func handleSWPRPCWithBackend(
 			if err != nil {
 				return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode RPC response payload: %w", err))
 			}
-			if emit != nil {
-				emit("swp.rpc.response", "info", map[string]any{
-					"method": req.Method,
-				}, msg.Resp.RPCID)
-			}
 			out = append(out, newRPCEnvelope(env.MsgID, rpcMsgTypeResp, now, payload))
 		case rpcMsgTypeErr:
 			payload, err := p1rpc.EncodePayloadErr(msg.Err)
 			if err != nil {
 				return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode RPC error payload: %w", err))
 			}
-			if emit != nil {
-				emit("swp.rpc.response", "warn", map[string]any{
-					"method": req.Method,
-					"code":   msg.Err.ErrorCode,
-				}, msg.Err.RPCID)
-			}
 			out = append(out, newRPCEnvelope(env.MsgID, rpcMsgTypeErr, now, payload))
 		case rpcMsgTypeStreamItem:
 			payload, err := p1rpc.EncodePayloadStreamItem(msg.StreamItem)
 			if err != nil {
 				return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode RPC stream item payload: %w", err))
 			}
-			if emit != nil {
-				emit("swp.rpc.stream", "debug", map[string]any{
-					"method": req.Method,
-					"seq_no": msg.StreamItem.SeqNo,
-				}, msg.StreamItem.RPCID)
-			}
 			out = append(out, newRPCEnvelope(env.MsgID, rpcMsgTypeStreamItem, now, payload))
 		default:
 			return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("backend returned unsupported RPC message type %d", msg.MsgType))
@@ -136,3 +91,29 @@ func newRPCEnvelope(msgID []byte, msgType, ts uint64, payload []byte) core.Envel
 		Payload:   payload,
 	}
 }
+
+func rpcTelemetry(env core.Envelope, out []core.Envelope) (string, []telemetryEvent) {
+	var code string
+	var events []telemetryEvent
+	for _, resp := range out {
+		switch resp.MsgType {
+		case rpcMsgTypeErr:
+			rerr, err := p1rpc.DecodePayloadErr(resp.Payload)
+			if err != nil {
+				continue
+			}
+			if env.MsgType == rpcMsgTypeCancel {
+				events = append(events, telemetryEvent{eventType: "swp.rpc.cancel", severity: "info", body: map[string]any{"code": rerr.ErrorCode}, rpcID: rerr.RPCID})
+				continue
+			}
+			code = rerr.ErrorCode
+		case rpcMsgTypeStreamItem:
+			item, err := p1rpc.DecodePayloadStreamItem(resp.Payload)
+			if err != nil {
+				continue
+			}
+			events = append(events, telemetryEvent{eventType: "swp.rpc.stream", severity: "debug", body: map[string]any{"seq_no": item.SeqNo}, rpcID: item.RPCID})
+		}
+	}
+	return code, events
+}
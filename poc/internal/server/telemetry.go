@@ -7,12 +7,120 @@ import (
 	"time"
 
 	"swp-spec-kit/poc/internal/core"
+	"swp-spec-kit/poc/internal/p1a2a"
 	"swp-spec-kit/poc/internal/p1events"
+	"swp-spec-kit/poc/internal/p1rpc"
 	runtimeclock "swp-spec-kit/poc/internal/runtime/clock"
 	runtimecontext "swp-spec-kit/poc/internal/runtime/context"
 	runtimeerrors "swp-spec-kit/poc/internal/runtime/errors"
 )
 
+// telemetryEvent is an extra event a profile derives from a dispatched
+// request or one of its responses.
+type telemetryEvent struct {
+	eventType string
+	severity  string
+	body      map[string]any
+	rpcID     []byte
+}
+
+// telemetryClassifier inspects a successful dispatch. A non-empty code marks
+// the response as an error reply, raising swp.<profile>.response to warn;
+// events are emitted before that response event.
+type telemetryClassifier func(env core.Envelope, out []core.Envelope) (code string, events []telemetryEvent)
+
+var profileTelemetry = map[uint64]telemetryClassifier{
+	ProfileMCPMap: mcpTelemetry,
+	ProfileSWPRPC: rpcTelemetry,
+}
+
+// telemetryMiddleware emits swp.<profile>.request before dispatch and
+// swp.<profile>.response or swp.<profile>.error after it, for every profile,
+// plus whatever the profile's classifier derives from the exchange.
+func (s *Server) telemetryMiddleware(next core.Handler) core.Handler {
+	return func(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
+		prefix := "swp." + ProfileName(env.ProfileID)
+		attrs, taskID, rpcID := telemetryAttributes(env)
+		withAttrs := func(body map[string]any) map[string]any {
+			for k, v := range attrs {
+				if _, ok := body[k]; !ok {
+					body[k] = v
+				}
+			}
+			return body
+		}
+
+		s.emitProfileEvent(ctx, env, prefix+".request", "info", withAttrs(map[string]any{"msg_type": env.MsgType}), taskID, rpcID)
+
+		out, err := next(ctx, env)
+
+		body := withAttrs(map[string]any{"msg_type": env.MsgType})
+		if err != nil {
+			body["code"] = string(core.CodeFromError(err))
+			s.emitProfileEvent(ctx, env, prefix+".error", "error", body, taskID, rpcID)
+			return out, err
+		}
+		severity := "info"
+		if classify, ok := profileTelemetry[env.ProfileID]; ok {
+			code, events := classify(env, out)
+			for _, ev := range events {
+				evRPCID := rpcID
+				if len(ev.rpcID) > 0 {
+					evRPCID = ev.rpcID
+				}
+				s.emitProfileEvent(ctx, env, ev.eventType, ev.severity, withAttrs(ev.body), taskID, evRPCID)
+			}
+			if code != "" {
+				severity = "warn"
+				body["code"] = code
+			}
+		}
+		body["responses"] = len(out)
+		s.emitProfileEvent(ctx, env, prefix+".response", severity, body, taskID, rpcID)
+		return out, nil
+	}
+}
+
+// telemetryAttributes extracts the method and correlation ids that profiles
+// carry in their payloads. Undecodable payloads yield no attributes; the
+// handler reports the decode error itself.
+func telemetryAttributes(env core.Envelope) (map[string]any, []byte, []byte) {
+	switch env.ProfileID {
+	case ProfileMCPMap:
+		var req mcpRequest
+		if err := json.Unmarshal(env.Payload, &req); err == nil && req.Method != "" {
+			return map[string]any{"method": req.Method}, nil, nil
+		}
+	case ProfileSWPRPC:
+		switch env.MsgType {
+		case rpcMsgTypeReq:
+			if req, err := p1rpc.DecodePayloadReq(env.Payload); err == nil {
+				return map[string]any{"method": req.Method}, nil, req.RPCID
+			}
+		case rpcMsgTypeCancel:
+			if c, err := p1rpc.DecodePayloadCancel(env.Payload); err == nil {
+				return nil, nil, c.RPCID
+			}
+		}
+	case ProfileA2A:
+		switch env.MsgType {
+		case a2aMsgTypeTask:
+			if task, err := p1a2a.DecodePayloadTask(env.Payload); err == nil {
+				return map[string]any{"kind": task.Kind}, task.TaskID, nil
+			}
+		case a2aMsgTypeEvent:
+			if ev, err := p1a2a.DecodePayloadEvent(env.Payload); err == nil {
+				return nil, ev.TaskID, nil
+			}
+		case a2aMsgTypeResult:
+			if res, err := p1a2a.DecodePayloadResult(env.Payload); err == nil {
+				return nil, res.TaskID, nil
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
 func (s *Server) emitProfileEvent(
 	ctx context.Context,
 	env core.Envelope,
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"swp-spec-kit/poc/internal/core"
+	"swp-spec-kit/poc/internal/p1agdisc"
+	"swp-spec-kit/poc/internal/p1rpc"
+)
+
+func TestTelemetryMiddlewareInstrumentsEveryProfile(t *testing.T) {
+	evBackend := &mockEventsBackend{}
+	s := New(nil, WithEventsBackend(evBackend))
+
+	payload, err := p1agdisc.EncodePayloadGet(p1agdisc.AgdiscGet{AgentID: "agent.demo"})
+	if err != nil {
+		t.Fatalf("encode AGDISC get payload: %v", err)
+	}
+	if _, err := s.router.Dispatch(context.Background(), core.Envelope{
+		ProfileID: ProfileSWPAGDISC,
+		MsgType:   agdiscMsgTypeGet,
+		MsgID:     []byte("12345678abcdefgh"),
+		Payload:   payload,
+	}); err != nil {
+		t.Fatalf("dispatch AGDISC get: %v", err)
+	}
+	if _, err := s.router.Dispatch(context.Background(), core.Envelope{
+		ProfileID: ProfileSWPState,
+		MsgType:   99,
+		MsgID:     []byte("abcdefgh12345678"),
+	}); err == nil {
+		t.Fatalf("expected STATE dispatch error")
+	}
+
+	want := []string{"swp.agdisc.request", "swp.agdisc.response", "swp.state.request", "swp.state.error"}
+	if len(evBackend.published) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(evBackend.published))
+	}
+	for i, ev := range evBackend.published {
+		if ev.EventType != want[i] {
+			t.Fatalf("event %d: got %q want %q", i, ev.EventType, want[i])
+		}
+	}
+	if sev := evBackend.published[3].Severity; sev != "error" {
+		t.Fatalf("expected error severity, got %q", sev)
+	}
+}
+
+func TestTelemetryMiddlewareProfileEvents(t *testing.T) {
+	evBackend := &mockEventsBackend{}
+	s := New(nil, WithEventsBackend(evBackend))
+	dispatch := func(env core.Envelope) {
+		t.Helper()
+		env.MsgID = []byte("12345678abcdefgh")
+		if _, err := s.router.Dispatch(context.Background(), env); err != nil {
+			t.Fatalf("dispatch %d/%d: %v", env.ProfileID, env.MsgType, err)
+		}
+	}
+	rpcReq := func(method string, params string) []byte {
+		payload, err := p1rpc.EncodePayloadReq(p1rpc.RpcReq{RPCID: []byte("rpc-1"), Method: method, Params: []byte(params)})
+		if err != nil {
+			t.Fatalf("encode RPC request: %v", err)
+		}
+		return payload
+	}
+
+	dispatch(core.Envelope{ProfileID: ProfileSWPRPC, MsgType: rpcMsgTypeReq, Payload: rpcReq("demo.stream.count", `{"count":2}`)})
+	dispatch(core.Envelope{ProfileID: ProfileSWPRPC, MsgType: rpcMsgTypeReq, Payload: rpcReq("demo.fail", "")})
+	cancel, err := p1rpc.EncodePayloadCancel(p1rpc.RpcCancel{RPCID: []byte("rpc-1")})
+	if err != nil {
+		t.Fatalf("encode RPC cancel: %v", err)
+	}
+	dispatch(core.Envelope{ProfileID: ProfileSWPRPC, MsgType: rpcMsgTypeCancel, Payload: cancel})
+	dispatch(core.Envelope{ProfileID: ProfileMCPMap, MsgType: mcpMsgTypeNotification, Payload: []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)})
+	dispatch(core.Envelope{ProfileID: ProfileMCPMap, MsgType: mcpMsgTypeRequest, Payload: []byte(`{"jsonrpc":"2.0","id":1,"method":"nope"}`)})
+
+	type seen struct {
+		eventType, severity string
+		body                map[string]any
+		rpcID               string
+	}
+	var got []seen
+	for _, ev := range evBackend.published {
+		var body map[string]any
+		if err := json.Unmarshal(ev.Body, &body); err != nil {
+			t.Fatalf("decode %s body: %v", ev.EventType, err)
+		}
+		if ev.EventType == "swp.rpc.request" || ev.EventType == "swp.mcp.request" {
+			continue
+		}
+		got = append(got, seen{ev.EventType, ev.Severity, body, string(ev.RPCID)})
+	}
+	want := []struct {
+		eventType, severity string
+		check               func(map[string]any) bool
+	}{
+		{"swp.rpc.stream", "debug", func(b map[string]any) bool { return b["seq_no"] == 1.0 && b["method"] == "demo.stream.count" }},
+		{"swp.rpc.stream", "debug", func(b map[string]any) bool { return b["seq_no"] == 2.0 }},
+		{"swp.rpc.response", "info", func(b map[string]any) bool { return b["code"] == nil }},
+		{"swp.rpc.response", "warn", func(b map[string]any) bool { return b["code"] == "internal" }},
+		{"swp.rpc.cancel", "info", func(b map[string]any) bool { return b["code"] == "cancelled" }},
+		{"swp.rpc.response", "info", func(b map[string]any) bool { return true }},
+		{"swp.mcp.notification", "info", func(b map[string]any) bool { return b["method"] == "notifications/initialized" }},
+		{"swp.mcp.response", "info", func(b map[string]any) bool { return b["code"] == nil }},
+		{"swp.mcp.response", "warn", func(b map[string]any) bool {
+			return b["code"] == "INVALID_MCP_PAYLOAD" && b["canonical_code"] == "ERR_INVALID_MCP_PAYLOAD"
+		}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), got)
+	}
+	for i, w := range want {
+		if got[i].eventType != w.eventType || got[i].severity != w.severity || !w.check(got[i].body) {
+			t.Fatalf("event %d: got %+v, want %s/%s", i, got[i], w.eventType, w.severity)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if got[i].rpcID != "rpc-1" {
+			t.Fatalf("event %d: expected rpc_id rpc-1, got %q", i, got[i].rpcID)
+		}
+	}
+}
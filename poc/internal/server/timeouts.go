@@ -0,0 +1,84 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+)
+
+const (
+	defaultIdleTimeout      = 5 * time.Minute
+	defaultFrameReadTimeout = 30 * time.Second
+	defaultWriteTimeout     = 30 * time.Second
+
+	goawayReasonLifetime = "connection lifetime exceeded"
+)
+
+// Timeouts bounds how long a connection may hold server resources. A zero
+// field disables that timeout.
+type Timeouts struct {
+	// Idle is how long the server waits for the next frame to start while
+	// no request is in flight.
+	Idle time.Duration
+	// FrameRead is how long a frame may take to arrive once its first byte
+	// has been read.
+	FrameRead time.Duration
+	// Write bounds each write of a response batch or push.
+	Write time.Duration
+	// MaxLifetime is how long a connection is served before the server
+	// sends GOAWAY and drains it.
+	MaxLifetime time.Duration
+	// Handler bounds the context passed to each handler, for profiles
+	// without their own ProfileLimits.HandlerTimeout.
+	Handler time.Duration
+}
+
+// DefaultTimeouts returns a 5 minute idle timeout, 30 second frame read and
+// write timeouts, and no lifetime or handler limit.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Idle:      defaultIdleTimeout,
+		FrameRead: defaultFrameReadTimeout,
+		Write:     defaultWriteTimeout,
+	}
+}
+
+func deadlineAfter(d time.Duration) time.Time {
+	if d <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
+
+// setReadDeadline applies t unless the connection is draining, whose reader
+// must stay unblocked.
+func (tc *trackedConn) setReadDeadline(t time.Time) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.draining {
+		t = time.Now()
+	}
+	_ = tc.conn.SetReadDeadline(t)
+}
+
+// startLifetime drains the connection once the MaxLifetime in effect when it
+// was accepted has passed. The returned function stops the timer.
+func (tc *trackedConn) startLifetime(s *Server) func() bool {
+	lifetime := s.live.Load().timeouts.MaxLifetime
+	if lifetime <= 0 {
+		return func() bool { return false }
+	}
+	t := time.AfterFunc(lifetime, func() {
+		s.logger.Printf("connection %s reached max lifetime %s, draining", tc.conn.RemoteAddr(), lifetime)
+		tc.goaway(core.Goaway{Reason: goawayReasonLifetime})
+	})
+	return t.Stop
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout())
+}
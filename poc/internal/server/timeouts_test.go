@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+)
+
+func expectClosed(t *testing.T, conn net.Conn) {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("expected connection to be closed, got %v", err)
+	}
+}
+
+func TestIdleTimeoutClosesConnection(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0), WithTimeouts(Timeouts{Idle: 50 * time.Millisecond}))
+	conn := startTestConn(t, s)
+	expectClosed(t, conn)
+}
+
+func TestIdleTimeoutWaitsForInFlightRequests(t *testing.T) {
+	backend := &blockingRPCBackend{release: make(chan struct{})}
+	s := New(log.New(io.Discard, "", 0), WithRPCBackend(backend), WithTimeouts(Timeouts{Idle: 50 * time.Millisecond}))
+	conn := startTestConn(t, s)
+
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-slow-0001", "rpc-a", "slow"))
+	time.Sleep(200 * time.Millisecond)
+	close(backend.release)
+	if got := readTestEnvelope(t, conn); string(got.MsgID) != "msg-slow-0001" {
+		t.Fatalf("expected slow response, got msg_id %q", got.MsgID)
+	}
+	expectClosed(t, conn)
+}
+
+// stickyTimeoutConn fails every read with a timeout once tripped, like a
+// transport that latched an earlier deadline.
+type stickyTimeoutConn struct {
+	net.Conn
+	tripped atomic.Bool
+	reads   atomic.Int64
+}
+
+func (c *stickyTimeoutConn) Read(p []byte) (int, error) {
+	if c.tripped.Load() {
+		c.reads.Add(1)
+		return 0, os.ErrDeadlineExceeded
+	}
+	return c.Conn.Read(p)
+}
+
+func TestIdleTimeoutStopsOnRepeatedTimeout(t *testing.T) {
+	backend := &blockingRPCBackend{release: make(chan struct{})}
+	s := New(log.New(io.Discard, "", 0), WithRPCBackend(backend), WithTimeouts(Timeouts{Idle: 50 * time.Millisecond}))
+	client, srv := net.Pipe()
+	sticky := &stickyTimeoutConn{Conn: srv}
+	done := make(chan struct{})
+	go func() {
+		s.handleConn(context.Background(), sticky)
+		close(done)
+	}()
+	defer func() {
+		close(backend.release)
+		_ = client.Close()
+		<-done
+	}()
+	go func() { _, _ = io.Copy(io.Discard, client) }()
+
+	writeTestEnvelope(t, client, testRPCReq(t, "msg-slow-0001", "rpc-a", "slow"))
+	sticky.tripped.Store(true)
+	time.Sleep(200 * time.Millisecond)
+	if n := sticky.reads.Load(); n > 1 {
+		t.Fatalf("reader retried a repeated timeout %d times while a request was in flight", n)
+	}
+}
+
+func TestFrameReadTimeoutRejectsPartialFrame(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0), WithTimeouts(Timeouts{FrameRead: 50 * time.Millisecond}))
+	conn := startTestConn(t, s)
+
+	if _, err := conn.Write([]byte{0, 0}); err != nil {
+		t.Fatalf("write partial prefix: %v", err)
+	}
+	env := readTestEnvelope(t, conn)
+	frame, err := core.DecodeErrorPayload(env.Payload)
+	if !core.IsErrorEnvelope(env) || err != nil || frame.Code != "ERR_INVALID_FRAME" || !frame.Fatal {
+		t.Fatalf("expected fatal ERR_INVALID_FRAME, got %+v (%v)", frame, err)
+	}
+	expectClosed(t, conn)
+}
+
+func TestWriteTimeoutClosesConnection(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0), WithTimeouts(Timeouts{Write: 50 * time.Millisecond}))
+	conn := startTestConn(t, s)
+
+	// Nobody reads the response, so the write blocks until its deadline.
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-rpc-00000001", "rpc-1", "demo.echo"))
+	time.Sleep(200 * time.Millisecond)
+	expectClosed(t, conn)
+}
+
+func TestMaxLifetimeDrainsConnection(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0), WithTimeouts(Timeouts{MaxLifetime: 50 * time.Millisecond}))
+	conn := startTestConn(t, s)
+
+	env := readTestEnvelope(t, conn)
+	if !core.IsGoawayEnvelope(env) {
+		t.Fatalf("expected GOAWAY, got profile=%d msg_type=%d", env.ProfileID, env.MsgType)
+	}
+	if g, err := core.DecodeGoawayPayload(env.Payload); err != nil || g.Reason != goawayReasonLifetime {
+		t.Fatalf("unexpected goaway %+v (%v)", g, err)
+	}
+	expectClosed(t, conn)
+}
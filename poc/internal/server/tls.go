@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"swp-spec-kit/poc/internal/pipeconn"
+	runtimecontext "swp-spec-kit/poc/internal/runtime/context"
+)
+
+const defaultTLSHandshakeTimeout = 10 * time.Second
+
+// ErrPlaintextNonLoopback reports an attempt to serve plaintext SWP on an
+// address reachable from other hosts (S1).
+var ErrPlaintextNonLoopback = errors.New("plaintext SWP is only served on loopback addresses; configure TLS")
+
+var clientAuthNames = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify-if-given":    tls.VerifyClientCertIfGiven,
+	"require-and-verify": tls.RequireAndVerifyClientCert,
+}
+
+// ParseClientAuth maps a client-auth policy name (none, request, require,
+// verify-if-given, require-and-verify) to its tls.ClientAuthType.
+func ParseClientAuth(name string) (tls.ClientAuthType, error) {
+	if a, ok := clientAuthNames[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return a, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("unknown client auth policy %q", name)
+}
+
+// NewTLSConfig loads the server certificate and, for mTLS, the CA bundle
+// used to verify client certificates. Policies that verify client
+// certificates require clientCAFile.
+func NewTLSConfig(certFile, keyFile, clientCAFile string, clientAuth tls.ClientAuthType) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("tls: certificate and key files are required")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls: load key pair: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   clientAuth,
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificates in %s", clientCAFile)
+		}
+		cfg.ClientCAs = pool
+	}
+	if cfg.ClientCAs == nil && (clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert) {
+		return nil, errors.New("tls: client certificate verification requires a client CA file")
+	}
+	return cfg, nil
+}
+
+// Listen opens a TCP listener on addr, wrapped in TLS when tlsConfig is set.
+// Without TLS it refuses addresses that are not loopback.
+func Listen(addr string, tlsConfig *tls.Config) (net.Listener, error) {
+	if tlsConfig == nil {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("listen: %w", err)
+		}
+		if !isLoopbackHost(host) {
+			return nil, fmt.Errorf("listen %s: %w", addr, ErrPlaintextNonLoopback)
+		}
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	return ln, nil
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isLoopbackAddr reports whether addr can only be reached from this host:
+// a loopback TCP address, a Unix socket or a pipe.
+func isLoopbackAddr(addr net.Addr) bool {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP.IsLoopback()
+	case *net.UnixAddr, pipeconn.Addr:
+		return true
+	}
+	return false
+}
+
+// plaintextRefused reports whether conn must be dropped before any frame is
+// read: it is not TLS and arrived on a non-loopback interface.
+func (s *Server) plaintextRefused(conn net.Conn) bool {
+	if _, ok := conn.(*tls.Conn); ok || s.insecurePlaintext {
+		return false
+	}
+	return !isLoopbackAddr(conn.LocalAddr())
+}
+
+// channelConn is a connection carried inside another protocol, such as an
+// HTTP/2 stream, whose TLS state belongs to the enclosing connection.
+type channelConn interface {
+	net.Conn
+	// channelState returns nil when the enclosing connection is plaintext.
+	channelState() *tls.ConnectionState
+}
+
+// tlsHandshake completes the handshake before any frame is processed and
+// returns the verified peer identity, if the client presented one.
+func (s *Server) tlsHandshake(ctx context.Context, conn *tls.Conn) (runtimecontext.PeerIdentity, bool, error) {
+	hctx, cancel := context.WithTimeout(ctx, defaultTLSHandshakeTimeout)
+	defer cancel()
+	if err := conn.HandshakeContext(hctx); err != nil {
+		return runtimecontext.PeerIdentity{}, false, err
+	}
+	id, ok := peerIdentity(conn.ConnectionState())
+	return id, ok, nil
+}
+
+// peerIdentity derives the canonical identity from the verified leaf
+// certificate: the first URI SAN, else the first DNS SAN, else the subject
+// common name. Unverified certificates yield no identity.
+func peerIdentity(state tls.ConnectionState) (runtimecontext.PeerIdentity, bool) {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return runtimecontext.PeerIdentity{}, false
+	}
+	leaf := state.VerifiedChains[0][0]
+	sum := sha256.Sum256(leaf.Raw)
+	id := runtimecontext.PeerIdentity{
+		Subject:     leaf.Subject.String(),
+		Issuer:      leaf.Issuer.String(),
+		Fingerprint: hex.EncodeToString(sum[:]),
+	}
+	switch {
+	case len(leaf.URIs) > 0:
+		id.ID = leaf.URIs[0].String()
+	case len(leaf.DNSNames) > 0:
+		id.ID = leaf.DNSNames[0]
+	default:
+		id.ID = leaf.Subject.CommonName
+	}
+	return id, id.ID != ""
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+	runtimecontext "swp-spec-kit/poc/internal/runtime/context"
+)
+
+type testPKI struct {
+	pool   *x509.CertPool
+	server tls.Certificate
+	client tls.Certificate
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ca key: %v", err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "swp test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create ca: %v", err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	issue := func(serial int64, tmpl *x509.Certificate) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("generate key: %v", err)
+		}
+		tmpl.SerialNumber = big.NewInt(serial)
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+		tmpl.NotAfter = time.Now().Add(time.Hour)
+		tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("create certificate: %v", err)
+		}
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+	agent, _ := url.Parse("spiffe://example.test/agent/a")
+	return testPKI{
+		pool: pool,
+		server: issue(2, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "swp-server"},
+			IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}),
+		client: issue(3, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "agent-a"},
+			URIs:        []*url.URL{agent},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}),
+	}
+}
+
+func TestListenRefusesPlaintextNonLoopback(t *testing.T) {
+	if _, err := Listen("0.0.0.0:0", nil); !errors.Is(err, ErrPlaintextNonLoopback) {
+		t.Fatalf("expected ErrPlaintextNonLoopback, got %v", err)
+	}
+	if _, err := Listen(":0", nil); !errors.Is(err, ErrPlaintextNonLoopback) {
+		t.Fatalf("expected ErrPlaintextNonLoopback for wildcard, got %v", err)
+	}
+	ln, err := Listen("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatalf("loopback listen: %v", err)
+	}
+	_ = ln.Close()
+}
+
+func TestParseClientAuth(t *testing.T) {
+	if a, err := ParseClientAuth("require-and-verify"); err != nil || a != tls.RequireAndVerifyClientCert {
+		t.Fatalf("unexpected policy %v err=%v", a, err)
+	}
+	if _, err := ParseClientAuth("always"); err == nil {
+		t.Fatalf("expected error for unknown policy")
+	}
+}
+
+func TestServeMTLSPeerIdentity(t *testing.T) {
+	pki := newTestPKI(t)
+	s := New(log.New(io.Discard, "", 0))
+	identities := make(chan runtimecontext.PeerIdentity, 1)
+	s.router.Use(func(next core.Handler) core.Handler {
+		return func(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
+			id, _ := runtimecontext.PeerIdentityFromContext(ctx)
+			identities <- id
+			return next(ctx, env)
+		}
+	})
+
+	ln, err := Listen("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{pki.server},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pki.pool,
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer ln.Close()
+	go func() { _ = s.Serve(ctx, ln) }()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+		RootCAs:      pki.pool,
+		Certificates: []tls.Certificate{pki.client},
+	})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-rpc-00000001", "rpc-1", "demo.echo"))
+	if got := readTestEnvelope(t, conn); got.ProfileID != ProfileSWPRPC {
+		t.Fatalf("expected rpc response, got profile %d", got.ProfileID)
+	}
+	id := <-identities
+	if id.ID != "spiffe://example.test/agent/a" || id.Subject != "CN=agent-a" || len(id.Fingerprint) != 64 {
+		t.Fatalf("unexpected peer identity %+v", id)
+	}
+
+	// Without a client certificate the handshake fails and no frame is served.
+	anon, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{RootCAs: pki.pool})
+	if err == nil {
+		defer anon.Close()
+		_ = anon.SetDeadline(time.Now().Add(2 * time.Second))
+		writeTestEnvelope(t, anon, testRPCReq(t, "msg-rpc-00000002", "rpc-2", "demo.echo"))
+		if _, err := core.ReadFrame(anon, core.DefaultMaxFrameBytes); err == nil {
+			t.Fatalf("expected connection without client certificate to be refused")
+		}
+	}
+}
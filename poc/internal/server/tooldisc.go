@@ -19,55 +19,51 @@ const (
 	tooldiscMsgTypeErr      = 5
 )
 
-func handleSWPToolDisc(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
-	return handleSWPToolDiscWithBackend(ctx, env, defaultBackends.tooldisc)
+func tooldiscHandlers(b ToolDiscBackend) map[uint64]core.Handler {
+	return map[uint64]core.Handler{
+		tooldiscMsgTypeListReq: withBackend(b, handleToolDiscList),
+		tooldiscMsgTypeGetReq:  withBackend(b, handleToolDiscGet),
+	}
 }
 
-func (s *Server) handleSWPToolDisc(ctx context.Context, env core.Envelope) ([]core.Envelope, error) {
-	return handleSWPToolDiscWithBackend(ctx, env, s.runtime.tooldisc)
+func handleToolDiscList(_ context.Context, env core.Envelope, backend ToolDiscBackend) ([]core.Envelope, error) {
+	now := uint64(time.Now().UnixMilli())
+
+	req, err := p1tooldisc.DecodePayloadListReq(env.Payload)
+	if err != nil {
+		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid TOOLDISC list request payload: %w", err))
+	}
+	resp := listTools(req, backend.ListTools())
+	payload, err := p1tooldisc.EncodePayloadListResp(resp)
+	if err != nil {
+		return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode TOOLDISC list response: %w", err))
+	}
+	return []core.Envelope{newToolDiscEnvelope(env.MsgID, tooldiscMsgTypeListResp, now, payload)}, nil
 }
 
-func handleSWPToolDiscWithBackend(_ context.Context, env core.Envelope, backend ToolDiscBackend) ([]core.Envelope, error) {
+func handleToolDiscGet(_ context.Context, env core.Envelope, backend ToolDiscBackend) ([]core.Envelope, error) {
 	now := uint64(time.Now().UnixMilli())
 
-	switch env.MsgType {
-	case tooldiscMsgTypeListReq:
-		req, err := p1tooldisc.DecodePayloadListReq(env.Payload)
-		if err != nil {
-			return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid TOOLDISC list request payload: %w", err))
-		}
-		resp := listTools(req, backend.ListTools())
-		payload, err := p1tooldisc.EncodePayloadListResp(resp)
-		if err != nil {
-			return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode TOOLDISC list response: %w", err))
-		}
-		return []core.Envelope{newToolDiscEnvelope(env.MsgID, tooldiscMsgTypeListResp, now, payload)}, nil
-
-	case tooldiscMsgTypeGetReq:
-		req, err := p1tooldisc.DecodePayloadGetReq(env.Payload)
-		if err != nil {
-			return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid TOOLDISC get request payload: %w", err))
-		}
-		tool, ok := backend.GetTool(req.ToolID, req.Version)
-		if !ok {
-			errPayload, err := p1tooldisc.EncodePayloadErr(p1tooldisc.TooldiscErr{
-				Code:    "NOT_FOUND",
-				Message: "tool not found",
-			})
-			if err != nil {
-				return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode TOOLDISC not-found error payload: %w", err))
-			}
-			return []core.Envelope{newToolDiscEnvelope(env.MsgID, tooldiscMsgTypeErr, now, errPayload)}, nil
-		}
-		payload, err := p1tooldisc.EncodePayloadGetResp(p1tooldisc.TooldiscGetResp{Tool: tool})
+	req, err := p1tooldisc.DecodePayloadGetReq(env.Payload)
+	if err != nil {
+		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid TOOLDISC get request payload: %w", err))
+	}
+	tool, ok := backend.GetTool(req.ToolID, req.Version)
+	if !ok {
+		errPayload, err := p1tooldisc.EncodePayloadErr(p1tooldisc.TooldiscErr{
+			Code:    "NOT_FOUND",
+			Message: "tool not found",
+		})
 		if err != nil {
-			return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode TOOLDISC get response: %w", err))
+			return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode TOOLDISC not-found error payload: %w", err))
 		}
-		return []core.Envelope{newToolDiscEnvelope(env.MsgID, tooldiscMsgTypeGetResp, now, payload)}, nil
-
-	default:
-		return nil, core.Wrap(core.CodeInvalidEnvelope, fmt.Errorf("invalid TOOLDISC msg_type %d", env.MsgType))
+		return []core.Envelope{newToolDiscEnvelope(env.MsgID, tooldiscMsgTypeErr, now, errPayload)}, nil
+	}
+	payload, err := p1tooldisc.EncodePayloadGetResp(p1tooldisc.TooldiscGetResp{Tool: tool})
+	if err != nil {
+		return nil, core.Wrap(core.CodeInternalError, fmt.Errorf("encode TOOLDISC get response: %w", err))
 	}
+	return []core.Envelope{newToolDiscEnvelope(env.MsgID, tooldiscMsgTypeGetResp, now, payload)}, nil
 }
 
 func listTools(req p1tooldisc.TooldiscListReq, tools []p1tooldisc.ToolDescriptor) p1tooldisc.TooldiscListResp {
@@ -25,9 +25,9 @@ func TestHandleSWPToolDiscList(t *testing.T) {
 		Payload:   payload,
 	}
 
-	out, err := handleSWPToolDisc(context.Background(), env)
+	out, err := route(context.Background(), env, tooldiscHandlers(defaultBackends.tooldisc))
 	if err != nil {
-		t.Fatalf("handleSWPToolDisc list failed: %v", err)
+		t.Fatalf("TOOLDISC list failed: %v", err)
 	}
 	if len(out) != 1 {
 		t.Fatalf("expected 1 response, got %d", len(out))
@@ -60,9 +60,9 @@ func TestHandleSWPToolDiscGetNotFound(t *testing.T) {
 		Payload:   payload,
 	}
 
-	out, err := handleSWPToolDisc(context.Background(), env)
+	out, err := route(context.Background(), env, tooldiscHandlers(defaultBackends.tooldisc))
 	if err != nil {
-		t.Fatalf("handleSWPToolDisc get failed: %v", err)
+		t.Fatalf("TOOLDISC get failed: %v", err)
 	}
 	if len(out) != 1 {
 		t.Fatalf("expected 1 response, got %d", len(out))
@@ -100,7 +100,7 @@ func TestHandleSWPEventsPublishAndSubscribe(t *testing.T) {
 		Payload:   pubPayload,
 	}
 
-	pubOut, err := handleSWPEvents(context.Background(), pubEnv)
+	pubOut, err := route(context.Background(), pubEnv, eventsHandlers(defaultBackends.events, defaultBackends.obs))
 	if err != nil {
 		t.Fatalf("publish failed: %v", err)
 	}
@@ -119,7 +119,7 @@ func TestHandleSWPEventsPublishAndSubscribe(t *testing.T) {
 		MsgID:     []byte("12345678abcdefgh"),
 		Payload:   subPayload,
 	}
-	subOut, err := handleSWPEvents(context.Background(), subEnv)
+	subOut, err := route(context.Background(), subEnv, eventsHandlers(defaultBackends.events, defaultBackends.obs))
 	if err != nil {
 		t.Fatalf("subscribe failed: %v", err)
 	}
@@ -157,7 +157,7 @@ func TestHandleSWPEventsInvalidSeverity(t *testing.T) {
 		Payload:   pubPayload,
 	}
 
-	_, err = handleSWPEvents(context.Background(), pubEnv)
+	_, err = route(context.Background(), pubEnv, eventsHandlers(defaultBackends.events, defaultBackends.obs))
 	if err == nil {
 		t.Fatalf("expected invalid severity error")
 	}
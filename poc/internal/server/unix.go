@@ -0,0 +1,115 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultUnixSocketMode lets only the owner connect.
+const DefaultUnixSocketMode os.FileMode = 0o600
+
+// ErrUnixSocketExposed reports a Unix socket other users could connect to
+// or replace, which would not be a secure channel (S1).
+var ErrUnixSocketExposed = errors.New("unix socket must not be accessible to other users")
+
+// ParseUnixSocketMode parses an octal permission string such as "0660".
+// The empty string means DefaultUnixSocketMode.
+func ParseUnixSocketMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return DefaultUnixSocketMode, nil
+	}
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mode %q: want octal permissions such as 0600", s)
+	}
+	mode := os.FileMode(n)
+	if mode&0o007 != 0 || mode&^os.ModePerm != 0 {
+		return 0, fmt.Errorf("mode %#o: %w", mode, ErrUnixSocketExposed)
+	}
+	return mode, nil
+}
+
+// ListenUnix opens a Unix domain socket at path with permission mode (0
+// means DefaultUnixSocketMode). For local clients the filesystem
+// permissions stand in for TLS, so mode must not grant other users access
+// and the directory must not let them replace the socket. A stale socket
+// left by a process that exited is removed first.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if mode == 0 {
+		mode = DefaultUnixSocketMode
+	}
+	if mode&0o007 != 0 || mode&^os.ModePerm != 0 {
+		return nil, fmt.Errorf("listen unix %s: mode %#o: %w", path, mode, ErrUnixSocketExposed)
+	}
+	dir, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("listen unix: %w", err)
+	}
+	if dir.Mode()&0o002 != 0 && dir.Mode()&os.ModeSticky == 0 {
+		return nil, fmt.Errorf("listen unix %s: directory is writable by other users: %w", path, ErrUnixSocketExposed)
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, fmt.Errorf("listen unix: %w", err)
+	}
+
+	// The socket is created and narrowed to mode inside a directory only
+	// this user can enter, then linked into place, so it is never reachable
+	// with the umask's looser permissions. Unlike a rename, the link fails
+	// if something already exists at path.
+	tmp, err := os.MkdirTemp(filepath.Dir(path), ".swp")
+	if err != nil {
+		return nil, fmt.Errorf("listen unix: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	tmpPath := filepath.Join(tmp, "s")
+	ln, err := net.Listen("unix", tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("listen unix: %w", err)
+	}
+	if err := os.Link(tmpPath, path); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("listen unix: %w", err)
+	}
+	return &unixListener{Listener: ln, addr: &net.UnixAddr{Name: path, Net: "unix"}}, nil
+}
+
+// unixListener reports the socket's final path and removes it on Close.
+type unixListener struct {
+	net.Listener
+	addr      *net.UnixAddr
+	closeOnce sync.Once
+}
+
+func (l *unixListener) Addr() net.Addr { return l.addr }
+
+func (l *unixListener) Close() error {
+	err := l.Listener.Close()
+	l.closeOnce.Do(func() { _ = os.Remove(l.addr.Name) })
+	return err
+}
+
+// removeStaleSocket removes the socket at path if nothing accepts on it.
+// Other files are left alone so Listen reports them.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return nil
+	}
+	return os.Remove(path)
+}
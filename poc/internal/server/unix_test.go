@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"swp-spec-kit/poc/internal/pipeconn"
+)
+
+func TestListenUnixPermissions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "swp.sock")
+	if _, err := ListenUnix(path, 0o666); !errors.Is(err, ErrUnixSocketExposed) {
+		t.Fatalf("expected ErrUnixSocketExposed for mode 0666, got %v", err)
+	}
+	open := filepath.Join(t.TempDir(), "open")
+	if err := os.Mkdir(open, 0o777); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.Chmod(open, 0o777); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	if _, err := ListenUnix(filepath.Join(open, "swp.sock"), 0); !errors.Is(err, ErrUnixSocketExposed) {
+		t.Fatalf("expected ErrUnixSocketExposed in a world-writable directory, got %v", err)
+	}
+
+	// A socket left behind by an exited process is replaced.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+	ln, err := ListenUnix(path, 0)
+	if err != nil {
+		t.Fatalf("listen over stale socket: %v", err)
+	}
+	defer ln.Close()
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode().Perm() != DefaultUnixSocketMode {
+		t.Fatalf("expected socket mode %#o, got %v (%v)", DefaultUnixSocketMode, fi.Mode(), err)
+	}
+	if got := ln.Addr().String(); got != path {
+		t.Fatalf("expected listener address %s, got %s", path, got)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("expected only the socket in %s, got %v", dir, entries)
+	}
+	_ = ln.Close()
+	if _, err := os.Lstat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected socket removed on close, got %v", err)
+	}
+
+	// Other files at path are never replaced.
+	if err := os.WriteFile(path, []byte("keep"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if _, err := ListenUnix(path, 0); err == nil {
+		t.Fatalf("expected listen over a regular file to fail")
+	}
+	if b, err := os.ReadFile(path); err != nil || string(b) != "keep" {
+		t.Fatalf("expected file to be left alone, got %q (%v)", b, err)
+	}
+}
+
+func TestServeUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "swp.sock")
+	ln, err := ListenUnix(path, 0)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := New(log.New(io.Discard, "", 0))
+	go func() { _ = s.Serve(context.Background(), ln) }()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+
+	// Unix sockets are local, so plaintext is not refused.
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	writeTestEnvelope(t, conn, testRPCReq(t, "msg-unix-0000001", "rpc-unix", "demo.echo"))
+	if env := readTestEnvelope(t, conn); env.MsgType != rpcMsgTypeResp {
+		t.Fatalf("expected RPC response, got msg_type %d", env.MsgType)
+	}
+}
+
+func TestServeConnReadWriteCloser(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0))
+	toServer, fromClient := io.Pipe()
+	fromServer, toClient := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.ServeConn(context.Background(), pipeconn.Join(toServer, toClient))
+		close(done)
+	}()
+
+	client := pipeconn.New(pipeconn.Join(fromServer, fromClient), "test")
+	writeTestEnvelope(t, client, testRPCReq(t, "msg-pipe-0000001", "rpc-pipe", "demo.echo"))
+	if env := readTestEnvelope(t, client); env.MsgType != rpcMsgTypeResp {
+		t.Fatalf("expected RPC response, got msg_type %d", env.MsgType)
+	}
+	// Closing stdin ends the session.
+	_ = fromClient.Close()
+	<-done
+}
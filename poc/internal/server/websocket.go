@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"swp-spec-kit/poc/internal/websocket"
+)
+
+// WebSocketSubprotocol is the Sec-WebSocket-Protocol a client must offer
+// to open an SWP WebSocket connection.
+const WebSocketSubprotocol = "swp"
+
+// WebSocketHandler serves the WebSocket binding. Each upgraded connection
+// is one SWP connection whose binary messages each carry exactly one E1
+// envelope, without the 4-byte frame prefix used on TCP, through the same
+// validation, limits and dispatch as Serve. Browser requests are only
+// accepted from the origins allowed by WithWebSocketOrigins. Plaintext (ws)
+// requests are only served on loopback interfaces unless
+// WithInsecurePlaintext is set.
+func (s *Server) WebSocketHandler() http.Handler {
+	return http.HandlerFunc(s.serveWebSocket)
+}
+
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.originAllowed(r) {
+		s.logger.Printf("security: refusing WebSocket from %s with origin %q", r.RemoteAddr, r.Header.Get("Origin"))
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	if _, ok := s.checkPlaintextRequest(w, r, "WebSocket"); !ok {
+		return
+	}
+	ws, err := websocket.Accept(w, r, WebSocketSubprotocol)
+	if err != nil {
+		s.logger.Printf("websocket upgrade from %s failed: %v", r.RemoteAddr, err)
+		return
+	}
+	s.handleConn(r.Context(), &wsConn{
+		FrameConn: websocket.NewFrameConn(ws, s.limits.MaxFrameBytes),
+		tls:       r.TLS,
+	})
+}
+
+// originAllowed reports whether a browser on the request's Origin may
+// connect. Requests without an Origin come from non-browser clients.
+func (s *Server) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range s.wsOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// ServeWebSocket serves WebSocketHandler over HTTP/1.1 on ln until ln is
+// closed, ctx is done or Shutdown is called. With tlsConfig the
+// connections use TLS (wss). Connections already upgraded keep running;
+// use Shutdown to drain them.
+func (s *Server) ServeWebSocket(ctx context.Context, ln net.Listener, tlsConfig *tls.Config) error {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	if err := s.serveHTTP(ctx, ln, tlsConfig, "http/1.1", protocols, s.WebSocketHandler()); err != nil {
+		return fmt.Errorf("serve websocket: %w", err)
+	}
+	return nil
+}
+
+// wsConn is an upgraded WebSocket connection served by handleConn.
+type wsConn struct {
+	*websocket.FrameConn
+	tls *tls.ConnectionState
+}
+
+func (c *wsConn) channelState() *tls.ConnectionState { return c.tls }
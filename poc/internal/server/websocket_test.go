@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+	"swp-spec-kit/poc/internal/websocket"
+)
+
+func serveTestWebSocket(t *testing.T, s *Server) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = s.ServeWebSocket(context.Background(), ln, nil) }()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+	return "ws://" + ln.Addr().String() + "/swp"
+}
+
+func readTestMessage(t *testing.T, ws *websocket.Conn) core.Envelope {
+	t.Helper()
+	_ = ws.NetConn().SetReadDeadline(time.Now().Add(2 * time.Second))
+	msg, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatalf("read message: %v", err)
+	}
+	env, err := core.DecodeEnvelopeE1(msg, core.DefaultLimits())
+	if err != nil {
+		t.Fatalf("decode envelope: %v", err)
+	}
+	return env
+}
+
+func TestWebSocketMessagePerEnvelope(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0))
+	url := serveTestWebSocket(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ws, err := websocket.Dial(ctx, url, nil, WebSocketSubprotocol)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer ws.Close()
+
+	body, err := core.EncodeEnvelopeE1(testRPCReq(t, "msg-ws-000000001", "rpc-ws-1", "demo.echo"))
+	if err != nil {
+		t.Fatalf("encode envelope: %v", err)
+	}
+	if err := ws.WriteMessage(body); err != nil {
+		t.Fatalf("write message: %v", err)
+	}
+	if env := readTestMessage(t, ws); env.ProfileID != ProfileSWPRPC || env.MsgType != rpcMsgTypeResp {
+		t.Fatalf("expected RPC response, got profile %d msg_type %d", env.ProfileID, env.MsgType)
+	}
+
+	// A message that is not an envelope gets a core error, not a close.
+	if err := ws.WriteMessage([]byte{0xff}); err != nil {
+		t.Fatalf("write message: %v", err)
+	}
+	if env := readTestMessage(t, ws); !core.IsErrorEnvelope(env) {
+		t.Fatalf("expected core error, got profile %d msg_type %d", env.ProfileID, env.MsgType)
+	}
+
+	go func() { _ = s.Shutdown(context.Background()) }()
+	env := readTestMessage(t, ws)
+	if g, err := core.DecodeGoawayPayload(env.Payload); err != nil || g.Reason != goawayReasonShutdown {
+		t.Fatalf("expected shutdown GOAWAY, got %+v (%v)", g, err)
+	}
+}
+
+func TestWebSocketHandlerRejectsRequests(t *testing.T) {
+	s := New(log.New(io.Discard, "", 0), WithInsecurePlaintext(), WithWebSocketOrigins("https://app.example"))
+	h := s.WebSocketHandler()
+	for _, tc := range []struct {
+		name, origin, protocol string
+		want                   int
+	}{
+		{"foreign origin", "https://evil.example", WebSocketSubprotocol, http.StatusForbidden},
+		{"no subprotocol", "", "", http.StatusBadRequest},
+		{"allowed origin", "https://app.example", "chat", http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/swp", nil)
+		r.Header.Set("Connection", "Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Sec-WebSocket-Version", "13")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		if tc.protocol != "" {
+			r.Header.Set("Sec-WebSocket-Protocol", tc.protocol)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Fatalf("%s: got status %d want %d", tc.name, w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+// frameHeaderBytes is the SWP frame length prefix.
+const frameHeaderBytes = 4
+
+// FrameConn presents a WebSocket connection carrying one SWP frame body
+// per binary message as a net.Conn of length-prefixed frames, so the
+// stream readers and writers used for TCP work unchanged. Read prepends
+// the prefix to each message; Write strips it and sends each complete
+// frame as one message.
+type FrameConn struct {
+	ws *Conn
+
+	rbuf []byte
+	wbuf []byte
+}
+
+// NewFrameConn wraps ws. Messages larger than maxFrame bytes close the
+// connection with CloseMessageTooBig; 0 means no limit.
+func NewFrameConn(ws *Conn, maxFrame uint32) *FrameConn {
+	if maxFrame > 0 {
+		ws.SetReadLimit(int(maxFrame))
+	}
+	return &FrameConn{ws: ws}
+}
+
+// WebSocket returns the wrapped connection.
+func (c *FrameConn) WebSocket() *Conn {
+	return c.ws
+}
+
+func (c *FrameConn) Read(p []byte) (int, error) {
+	if len(c.rbuf) == 0 {
+		msg, err := c.ws.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.rbuf = binary.BigEndian.AppendUint32(make([]byte, 0, frameHeaderBytes+len(msg)), uint32(len(msg)))
+		c.rbuf = append(c.rbuf, msg...)
+	}
+	n := copy(p, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+// Write must not be called concurrently; a frame may span several calls.
+func (c *FrameConn) Write(p []byte) (int, error) {
+	c.wbuf = append(c.wbuf, p...)
+	for len(c.wbuf) >= frameHeaderBytes {
+		n := binary.BigEndian.Uint32(c.wbuf)
+		if n == 0 {
+			return 0, errors.New("websocket: zero-length frame")
+		}
+		end := frameHeaderBytes + int(n)
+		if len(c.wbuf) < end {
+			break
+		}
+		if err := c.ws.WriteMessage(c.wbuf[frameHeaderBytes:end]); err != nil {
+			return 0, err
+		}
+		c.wbuf = c.wbuf[end:]
+	}
+	if len(c.wbuf) == 0 {
+		c.wbuf = nil
+	}
+	return len(p), nil
+}
+
+func (c *FrameConn) Close() error                       { return c.ws.Close() }
+func (c *FrameConn) LocalAddr() net.Addr                { return c.ws.conn.LocalAddr() }
+func (c *FrameConn) RemoteAddr() net.Addr               { return c.ws.conn.RemoteAddr() }
+func (c *FrameConn) SetDeadline(t time.Time) error      { return c.ws.conn.SetDeadline(t) }
+func (c *FrameConn) SetReadDeadline(t time.Time) error  { return c.ws.conn.SetReadDeadline(t) }
+func (c *FrameConn) SetWriteDeadline(t time.Time) error { return c.ws.conn.SetWriteDeadline(t) }
@@ -0,0 +1,431 @@
+// Package websocket is a minimal RFC 6455 implementation for carrying SWP
+// frames in binary messages. It supports the opening handshake on both
+// sides, fragmented messages, ping/pong and the close handshake; it does
+// not implement extensions such as permessage-deflate.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Close status codes (RFC 6455 Section 7.4.1).
+const (
+	CloseNormal          = 1000
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseMessageTooBig   = 1009
+)
+
+var (
+	// ErrBadHandshake reports an opening handshake that is not a valid
+	// WebSocket upgrade.
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+	// ErrMessageTooBig reports a message larger than the read limit.
+	ErrMessageTooBig = errors.New("websocket: message too big")
+)
+
+// Conn is a WebSocket connection. ReadMessage must not be called
+// concurrently; WriteMessage and Close may be called from any goroutine.
+type Conn struct {
+	conn       net.Conn
+	br         *bufio.Reader
+	client     bool
+	maxMessage int
+
+	// readErr is set once a read fails part way through a message, after
+	// which the stream can no longer be parsed.
+	readErr error
+
+	wmu       sync.Mutex
+	closeSent bool
+}
+
+// SetReadLimit bounds the size of a reassembled message. Larger messages
+// close the connection with CloseMessageTooBig.
+func (c *Conn) SetReadLimit(n int) {
+	c.maxMessage = n
+}
+
+// NetConn returns the underlying connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Accept completes the server side of the opening handshake and takes over
+// the connection. When protocol is not empty the client must offer it in
+// Sec-WebSocket-Protocol. On failure an HTTP error has been written.
+func Accept(w http.ResponseWriter, r *http.Request, protocol string) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case r.Method != http.MethodGet:
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "websocket upgrade requires GET", http.StatusMethodNotAllowed)
+		return nil, ErrBadHandshake
+	case !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket"):
+		w.Header().Set("Upgrade", "websocket")
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return nil, ErrBadHandshake
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, ErrBadHandshake
+	case key == "":
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	case protocol != "" && !headerContains(r.Header, "Sec-WebSocket-Protocol", protocol):
+		http.Error(w, "websocket subprotocol "+protocol+" required", http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "websocket upgrade not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("websocket: hijack: %w", err)
+	}
+	resp := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + acceptKey(key) + "\r\n"
+	if protocol != "" {
+		resp += "Sec-WebSocket-Protocol: " + protocol + "\r\n"
+	}
+	if _, err := io.WriteString(conn, resp+"\r\n"); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("websocket: write handshake: %w", err)
+	}
+	return &Conn{conn: conn, br: brw.Reader}, nil
+}
+
+// Dial opens a WebSocket connection to a ws or wss URL. cfg is used for wss
+// and may be nil. ctx bounds the TCP, TLS and WebSocket handshakes.
+func Dial(ctx context.Context, rawURL string, cfg *tls.Config, protocol string) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: %w", err)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		switch u.Scheme {
+		case "ws":
+			host = net.JoinHostPort(u.Hostname(), "80")
+		case "wss":
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+	}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", host)
+	case "wss":
+		cfg = cfg.Clone()
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		cfg.NextProtos = []string{"http/1.1"}
+		d := tls.Dialer{Config: cfg}
+		conn, err = d.DialContext(ctx, "tcp", host)
+	default:
+		return nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("websocket: dial: %w", err)
+	}
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	c, err := clientHandshake(conn, u, protocol)
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func clientHandshake(conn net.Conn, u *url.URL, protocol string) (*Conn, error) {
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, fmt.Errorf("websocket: key: %w", err)
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{Path: u.Path, RawQuery: u.RawQuery},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Host:       u.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	if req.URL.Path == "" {
+		req.URL.Path = "/"
+	}
+	if protocol != "" {
+		req.Header.Set("Sec-WebSocket-Protocol", protocol)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("websocket: write handshake: %w", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: read handshake: %w", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s: %s", ErrBadHandshake, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if !headerContains(resp.Header, "Upgrade", "websocket") || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return nil, fmt.Errorf("%w: invalid upgrade response", ErrBadHandshake)
+	}
+	if protocol != "" && resp.Header.Get("Sec-WebSocket-Protocol") != protocol {
+		return nil, fmt.Errorf("%w: server did not select subprotocol %s", ErrBadHandshake, protocol)
+	}
+	return &Conn{conn: conn, br: br, client: true}, nil
+}
+
+// ReadMessage returns the next binary message, answering pings and the
+// close handshake on the way. A close from the peer ends the connection
+// with io.EOF. Text messages are refused with CloseUnsupportedData.
+//
+// A read deadline that passes between frames, before any of a message's
+// data frames arrived, leaves the connection usable even if control frames
+// were handled; one that passes part way through a frame or message does not.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	if c.readErr != nil {
+		return nil, c.readErr
+	}
+	msg, clean, err := c.readMessage()
+	if err != nil && !clean && !errors.Is(err, io.EOF) {
+		c.readErr = err
+	}
+	return msg, err
+}
+
+// readMessage reports clean when it failed at a frame boundary with no
+// message data consumed.
+func (c *Conn) readMessage() ([]byte, bool, error) {
+	var msg []byte
+	started := false
+	for {
+		if !started {
+			if _, err := c.br.Peek(1); err != nil {
+				return nil, true, err
+			}
+		}
+		fin, op, payload, err := c.readFrame(len(msg))
+		if err != nil {
+			return nil, false, err
+		}
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, false, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			code := make([]byte, 2)
+			binary.BigEndian.PutUint16(code, CloseNormal)
+			if len(payload) >= 2 {
+				code = payload[:2]
+			}
+			_ = c.sendClose(code)
+			return nil, false, io.EOF
+		case opText:
+			return nil, false, c.fail(CloseUnsupportedData, errors.New("websocket: text messages are not supported"))
+		case opBinary:
+			if started {
+				return nil, false, c.fail(CloseProtocolError, errors.New("websocket: new message inside a fragmented message"))
+			}
+			started = true
+			msg = payload
+		case opContinuation:
+			if !started {
+				return nil, false, c.fail(CloseProtocolError, errors.New("websocket: continuation without a message"))
+			}
+			msg = append(msg, payload...)
+		default:
+			return nil, false, c.fail(CloseProtocolError, fmt.Errorf("websocket: unknown opcode %d", op))
+		}
+		if fin {
+			return msg, false, nil
+		}
+	}
+}
+
+// readFrame reads one frame. buffered is the size of the message read so
+// far, for the read limit.
+func (c *Conn) readFrame(buffered int) (bool, byte, []byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op := hdr[0]&0x80 != 0, hdr[0]&0x0f
+	if hdr[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, errors.New("websocket: reserved bits set"))
+	}
+	masked := hdr[1]&0x80 != 0
+	if masked == c.client {
+		return false, 0, nil, c.fail(CloseProtocolError, errors.New("websocket: wrong frame masking"))
+	}
+	n := uint64(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= opClose && (n > 125 || !fin) {
+		return false, 0, nil, c.fail(CloseProtocolError, errors.New("websocket: invalid control frame"))
+	}
+	if op < opClose && c.maxMessage > 0 && n > uint64(c.maxMessage-buffered) {
+		return false, 0, nil, c.fail(CloseMessageTooBig, fmt.Errorf("%w: exceeds %d bytes", ErrMessageTooBig, c.maxMessage))
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+// WriteMessage sends p as one binary message.
+func (c *Conn) WriteMessage(p []byte) error {
+	return c.writeFrame(opBinary, p)
+}
+
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return net.ErrClosed
+	}
+	return c.writeFrameLocked(op, payload)
+}
+
+func (c *Conn) writeFrameLocked(op byte, payload []byte) error {
+	buf := make([]byte, 0, 14+len(payload))
+	buf = append(buf, 0x80|op)
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		buf = append(buf, maskBit|byte(n))
+	case n <= 0xffff:
+		buf = append(buf, maskBit|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, maskBit|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return fmt.Errorf("websocket: mask: %w", err)
+		}
+		buf = append(buf, mask[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		for i := range payload {
+			buf[start+i] ^= mask[i%4]
+		}
+	} else {
+		buf = append(buf, payload...)
+	}
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// sendClose sends a close frame with payload once.
+func (c *Conn) sendClose(payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return nil
+	}
+	c.closeSent = true
+	return c.writeFrameLocked(opClose, payload)
+}
+
+// fail sends a close frame with code and returns err.
+func (c *Conn) fail(code uint16, err error) error {
+	_ = c.sendClose(binary.BigEndian.AppendUint16(nil, code))
+	return err
+}
+
+// Close sends a normal close frame, unless one was already sent, and
+// closes the connection without waiting for the peer's reply.
+func (c *Conn) Close() error {
+	_ = c.sendClose(binary.BigEndian.AppendUint16(nil, CloseNormal))
+	return c.conn.Close()
+}
@@ -0,0 +1,193 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// maskedFrame encodes a client frame with an all-zero masking key.
+func maskedFrame(fin bool, op byte, payload []byte) []byte {
+	b := op
+	if fin {
+		b |= 0x80
+	}
+	return append([]byte{b, 0x80 | byte(len(payload)), 0, 0, 0, 0}, payload...)
+}
+
+func pipeConns(t *testing.T) (*Conn, net.Conn) {
+	t.Helper()
+	srv, peer := net.Pipe()
+	t.Cleanup(func() {
+		_ = srv.Close()
+		_ = peer.Close()
+	})
+	return &Conn{conn: srv, br: bufio.NewReader(srv)}, peer
+}
+
+func TestDialAccept(t *testing.T) {
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := Accept(w, r, "swp")
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := ws.WriteMessage(msg); err != nil {
+				return
+			}
+		}
+	}))
+	defer hs.Close()
+	url := "ws" + strings.TrimPrefix(hs.URL, "http")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ws, err := Dial(ctx, url, nil, "swp")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer ws.Close()
+	for _, size := range []int{1, 125, 126, 70000} {
+		want := bytes.Repeat([]byte{byte(size)}, size)
+		if err := ws.WriteMessage(want); err != nil {
+			t.Fatalf("write %d bytes: %v", size, err)
+		}
+		got, err := ws.ReadMessage()
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("echo %d bytes: got %d bytes (%v)", size, len(got), err)
+		}
+	}
+
+	if _, err := Dial(ctx, url, nil, "other"); !errors.Is(err, ErrBadHandshake) {
+		t.Fatalf("expected bad handshake for unknown subprotocol, got %v", err)
+	}
+}
+
+func TestReadMessageFragmentsAndPing(t *testing.T) {
+	ws, peer := pipeConns(t)
+	go func() {
+		_, _ = peer.Write(maskedFrame(false, opBinary, []byte("hel")))
+		_, _ = peer.Write(maskedFrame(true, opPing, []byte("p")))
+		_, _ = peer.Write(maskedFrame(true, opContinuation, []byte("lo")))
+	}()
+	pong := make(chan []byte, 1)
+	go func() {
+		b := make([]byte, 3)
+		_, _ = io.ReadFull(peer, b)
+		pong <- b
+	}()
+	msg, err := ws.ReadMessage()
+	if err != nil || string(msg) != "hello" {
+		t.Fatalf("got %q (%v), want hello", msg, err)
+	}
+	if b := <-pong; b[0] != 0x80|opPong || string(b[2:]) != "p" {
+		t.Fatalf("expected pong echoing the ping, got %x", b)
+	}
+}
+
+func TestReadMessageDeadline(t *testing.T) {
+	ws, peer := pipeConns(t)
+	go func() {
+		b := make([]byte, 3)
+		_, _ = io.ReadFull(peer, b)
+	}()
+	go func() { _, _ = peer.Write(maskedFrame(true, opPing, []byte("p"))) }()
+	_ = ws.NetConn().SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := ws.ReadMessage(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected deadline after the ping, got %v", err)
+	}
+	_ = ws.NetConn().SetReadDeadline(time.Time{})
+	go func() { _, _ = peer.Write(maskedFrame(true, opBinary, []byte("ok"))) }()
+	if msg, err := ws.ReadMessage(); err != nil || string(msg) != "ok" {
+		t.Fatalf("expected the connection to survive a deadline between frames, got %q (%v)", msg, err)
+	}
+
+	go func() { _, _ = peer.Write(maskedFrame(false, opBinary, []byte("he"))) }()
+	_ = ws.NetConn().SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := ws.ReadMessage(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected deadline inside the message, got %v", err)
+	}
+	_ = ws.NetConn().SetReadDeadline(time.Time{})
+	go func() { _, _ = peer.Write(maskedFrame(true, opContinuation, []byte("llo"))) }()
+	if _, err := ws.ReadMessage(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected the deadline inside a message to stick, got %v", err)
+	}
+}
+
+func TestReadMessageRejects(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		frame []byte
+		limit int
+		code  uint16
+	}{
+		{"text", maskedFrame(true, opText, []byte("hi")), 0, CloseUnsupportedData},
+		{"unmasked", []byte{0x80 | opBinary, 1, 'x'}, 0, CloseProtocolError},
+		{"too big", maskedFrame(true, opBinary, []byte("12345")), 4, CloseMessageTooBig},
+	} {
+		ws, peer := pipeConns(t)
+		ws.SetReadLimit(tc.limit)
+		go func() { _, _ = peer.Write(tc.frame) }()
+		closeFrame := make(chan []byte, 1)
+		go func() {
+			b := make([]byte, 4)
+			_, _ = io.ReadFull(peer, b)
+			closeFrame <- b
+		}()
+		if _, err := ws.ReadMessage(); err == nil {
+			t.Fatalf("%s: expected error", tc.name)
+		}
+		if b := <-closeFrame; b[0] != 0x80|opClose || binary.BigEndian.Uint16(b[2:]) != tc.code {
+			t.Fatalf("%s: expected close %d, got %x", tc.name, tc.code, b)
+		}
+	}
+}
+
+func TestFrameConn(t *testing.T) {
+	ws, peer := pipeConns(t)
+	fc := NewFrameConn(ws, 0)
+	go func() { _, _ = peer.Write(maskedFrame(true, opBinary, []byte("abc"))) }()
+	got := make([]byte, 7)
+	if _, err := io.ReadFull(fc, got); err != nil || !bytes.Equal(got, []byte{0, 0, 0, 3, 'a', 'b', 'c'}) {
+		t.Fatalf("read frame: got %x (%v)", got, err)
+	}
+
+	// A frame split across writes goes out as one message once complete.
+	msgs := make(chan []byte, 2)
+	go func() {
+		for {
+			b := make([]byte, 2+125)
+			if _, err := io.ReadFull(peer, b[:2]); err != nil {
+				return
+			}
+			b = b[:2+int(b[1])]
+			_, _ = io.ReadFull(peer, b[2:])
+			msgs <- b[2:]
+		}
+	}()
+	for _, p := range [][]byte{{0, 0}, {0, 2, 'h'}, {'i', 0, 0, 0, 1, '!'}} {
+		if _, err := fc.Write(p); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	for _, want := range []string{"hi", "!"} {
+		if got := <-msgs; string(got) != want {
+			t.Fatalf("got message %q want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,614 @@
+// Package swpclient is an importable SWP client that multiplexes many
+// concurrent requests over one connection, correlating responses by msg_id.
+package swpclient
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+)
+
+type Envelope = core.Envelope
+type Extension = core.Extension
+type Limits = core.Limits
+type ReassemblyLimits = core.ReassemblyLimits
+type Codec = core.Codec
+
+const (
+	CodecGzip    = core.CodecGzip
+	CodecDeflate = core.CodecDeflate
+)
+
+const (
+	CoreVersion              = core.CoreVersion
+	defaultMsgIDBytes        = 16
+	defaultStreamBufferBytes = 8 << 20
+)
+
+var (
+	ErrClosed        = errors.New("swpclient: connection closed")
+	ErrMsgIDInFlight = errors.New("swpclient: msg_id already in flight")
+	ErrStreamClosed  = errors.New("swpclient: stream closed")
+	// ErrGoingAway is returned for new requests once the server has sent a
+	// core GOAWAY; requests already in flight still complete.
+	ErrGoingAway = errors.New("swpclient: server is going away")
+	// ErrStreamOverflow ends a stream whose caller stopped reading and let
+	// more than its stream buffer pile up, so it does not hold up other
+	// streams.
+	ErrStreamOverflow = errors.New("swpclient: stream receive buffer full")
+
+	errReassemblyTimeout = core.Wrap(core.CodeInvalidEnvelope, errors.New("swpclient: fragment reassembly timed out"))
+)
+
+// RemoteError is a core error envelope received from the peer.
+type RemoteError struct {
+	Code    string
+	MsgID   []byte
+	Message string
+	Fatal   bool
+}
+
+func (e *RemoteError) Error() string {
+	if e.Message == "" {
+		return "swpclient: remote " + e.Code
+	}
+	return "swpclient: remote " + e.Code + ": " + e.Message
+}
+
+func remoteError(env Envelope) error {
+	f, err := core.DecodeErrorPayload(env.Payload)
+	if err != nil {
+		return fmt.Errorf("swpclient: malformed core error envelope: %w", err)
+	}
+	return &RemoteError{Code: f.Code, MsgID: f.MsgID, Message: f.Message, Fatal: f.Fatal}
+}
+
+func DefaultLimits() Limits {
+	return core.DefaultLimits()
+}
+
+func DefaultReassemblyLimits() ReassemblyLimits {
+	return core.DefaultReassemblyLimits()
+}
+
+type Client struct {
+	conn         net.Conn
+	limits       core.Limits
+	msgIDBytes   int
+	streamBuffer int
+	unsolicited  func(Envelope)
+
+	codec            Codec
+	compressMinBytes int
+	reassembly       ReassemblyLimits
+	helloProfiles    []ProfileVersion
+	helloOnDial      bool
+
+	writeMu sync.Mutex
+	fw      *core.FrameWriter
+
+	mu         sync.Mutex
+	pending    map[string]*Stream
+	peerCodecs []Codec
+	negotiated *Negotiated
+	goingAway  bool
+	closed     bool
+	err        error
+	done       chan struct{}
+}
+
+type Option func(*Client)
+
+func WithLimits(l Limits) Option {
+	return func(c *Client) {
+		c.limits = l
+	}
+}
+
+func WithMsgIDBytes(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.msgIDBytes = n
+		}
+	}
+}
+
+// WithStreamBuffer sets how many encoded bytes of envelopes a stream holds
+// for Recv. The reader never waits on a stream; one whose unread envelopes
+// exceed n fails with ErrStreamOverflow. A single envelope is always
+// accepted.
+func WithStreamBuffer(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.streamBuffer = n
+		}
+	}
+}
+
+// WithUnsolicited registers a callback for inbound envelopes whose msg_id
+// does not match any in-flight call. It runs on the reader goroutine.
+func WithUnsolicited(fn func(Envelope)) Option {
+	return func(c *Client) {
+		c.unsolicited = fn
+	}
+}
+
+// WithCompression advertises the codecs this client decodes on every
+// request and, once the server has advertised codec, compresses request
+// payloads of at least minBytes with it.
+func WithCompression(codec Codec, minBytes int) Option {
+	return func(c *Client) {
+		c.codec = codec
+		c.compressMinBytes = minBytes
+	}
+}
+
+// WithReassemblyLimits bounds reassembly of fragmented responses.
+func WithReassemblyLimits(l ReassemblyLimits) Option {
+	return func(c *Client) {
+		c.reassembly = l
+	}
+}
+
+func Dial(ctx context.Context, network, addr string, opts ...Option) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	return start(ctx, conn, opts...)
+}
+
+// DialTLS is Dial over TLS. Set Certificates in cfg to present a client
+// certificate to servers that require mTLS.
+func DialTLS(ctx context.Context, network, addr string, cfg *tls.Config, opts ...Option) (*Client, error) {
+	d := tls.Dialer{Config: cfg}
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	return start(ctx, conn, opts...)
+}
+
+func start(ctx context.Context, conn net.Conn, opts ...Option) (*Client, error) {
+	c := New(conn, opts...)
+	if c.helloOnDial {
+		if _, err := c.Handshake(ctx, c.helloProfiles...); err != nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("hello: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// New takes ownership of conn and starts the reader goroutine.
+func New(conn net.Conn, opts ...Option) *Client {
+	c := &Client{
+		conn:         conn,
+		limits:       core.DefaultLimits(),
+		msgIDBytes:   defaultMsgIDBytes,
+		streamBuffer: defaultStreamBufferBytes,
+		reassembly:   core.DefaultReassemblyLimits(),
+		pending:      make(map[string]*Stream),
+		done:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(c)
+		}
+	}
+	c.fw = core.NewFrameWriter(conn, c.limits.MaxFrameBytes)
+	go c.readLoop()
+	return c
+}
+
+func (c *Client) NewMsgID() ([]byte, error) {
+	b := make([]byte, c.msgIDBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("generate msg_id: %w", err)
+	}
+	return b, nil
+}
+
+// Send writes env without waiting for any response.
+func (c *Client) Send(ctx context.Context, env Envelope) error {
+	env, err := c.prepare(env)
+	if err != nil {
+		return err
+	}
+	return c.write(ctx, env)
+}
+
+// SendBatch writes envs back to back in as few writes as possible without
+// waiting for any response. Nothing is sent if any envelope cannot be
+// prepared.
+func (c *Client) SendBatch(ctx context.Context, envs ...Envelope) error {
+	prepared := make([]Envelope, len(envs))
+	for i, env := range envs {
+		env, err := c.prepare(env)
+		if err != nil {
+			return err
+		}
+		prepared[i] = env
+	}
+	return c.write(ctx, prepared...)
+}
+
+// Call sends env and returns the first envelope that carries its msg_id.
+// A core error envelope for that msg_id is returned as *RemoteError.
+func (c *Client) Call(ctx context.Context, env Envelope) (Envelope, error) {
+	st, err := c.Stream(ctx, env)
+	if err != nil {
+		return Envelope{}, err
+	}
+	defer st.Close()
+	return st.Recv(ctx)
+}
+
+// Stream sends env and returns a Stream delivering every envelope that
+// carries its msg_id until the stream is closed. Callers decide which
+// profile message is terminal and must Close the stream afterwards.
+func (c *Client) Stream(ctx context.Context, env Envelope) (*Stream, error) {
+	env, err := c.prepare(env)
+	if err != nil {
+		return nil, err
+	}
+	st := &Stream{
+		c:        c,
+		key:      string(env.MsgID),
+		MsgID:    append([]byte(nil), env.MsgID...),
+		maxBytes: c.streamBuffer,
+		ready:    make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		err := c.err
+		c.mu.Unlock()
+		return nil, err
+	}
+	if c.goingAway {
+		c.mu.Unlock()
+		return nil, ErrGoingAway
+	}
+	if _, ok := c.pending[st.key]; ok {
+		c.mu.Unlock()
+		return nil, ErrMsgIDInFlight
+	}
+	c.pending[st.key] = st
+	c.mu.Unlock()
+
+	if err := c.write(ctx, env); err != nil {
+		st.Close()
+		return nil, err
+	}
+	return st, nil
+}
+
+func (c *Client) Close() error {
+	c.fail(ErrClosed)
+	return c.conn.Close()
+}
+
+// Done is closed once the connection is no longer usable.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err reports why the connection stopped, or nil while it is open.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Client) prepare(env Envelope) (Envelope, error) {
+	n, negotiated := c.Negotiated()
+	if negotiated && env.ProfileID != core.ProfileCore && !n.HasProfile(env.ProfileID) {
+		return Envelope{}, fmt.Errorf("%w: profile_id %d", ErrProfileNotNegotiated, env.ProfileID)
+	}
+	if env.Version == 0 {
+		env.Version = core.CoreVersion
+		if negotiated {
+			env.Version = n.Version
+		}
+	}
+	if env.TsUnixMs == 0 {
+		env.TsUnixMs = uint64(time.Now().UnixMilli())
+	}
+	if len(env.MsgID) == 0 {
+		id, err := c.NewMsgID()
+		if err != nil {
+			return Envelope{}, err
+		}
+		env.MsgID = id
+	}
+	if c.codec != core.CodecIdentity {
+		env = core.WithAcceptedCodecs(env, core.SupportedCodecs())
+		if c.peerAccepts(c.codec) {
+			compressed, err := core.CompressPayload(env, c.codec, c.compressMinBytes)
+			if err != nil {
+				return Envelope{}, err
+			}
+			env = compressed
+		}
+	}
+	return env, nil
+}
+
+func (c *Client) peerAccepts(codec Codec) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, pc := range c.peerCodecs {
+		if pc == codec {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) write(ctx context.Context, envs ...Envelope) error {
+	maxFrame, maxPayload, fragment := c.outboundLimits()
+	var frames []Envelope
+	for _, env := range envs {
+		if err := core.CheckPeerPayload(env, maxPayload); err != nil {
+			return err
+		}
+		if !fragment {
+			if n := core.EncodedLenE1(env); uint64(n) > uint64(maxFrame) {
+				return core.Wrap(core.CodeInvalidFrame, fmt.Errorf("frame length %d exceeds peer max %d", n, maxFrame))
+			}
+			frames = append(frames, env)
+			continue
+		}
+		frags, err := core.Fragment(env, maxFrame)
+		if err != nil {
+			return err
+		}
+		frames = append(frames, frags...)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	select {
+	case <-c.done:
+		return c.Err()
+	default:
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetWriteDeadline(dl)
+		defer c.conn.SetWriteDeadline(time.Time{})
+	}
+	for _, env := range frames {
+		if err := c.fw.WriteEnvelope(env); err != nil {
+			c.fail(err)
+			_ = c.conn.Close()
+			return err
+		}
+	}
+	if err := c.fw.Flush(); err != nil {
+		c.fail(err)
+		_ = c.conn.Close()
+		return err
+	}
+	return nil
+}
+
+func (c *Client) readLoop() {
+	fr := core.NewFrameReader(c.conn, c.limits.MaxFrameBytes)
+	ra := core.NewReassembler(c.reassembly)
+	for {
+		// Envelopes go to callers with no bounded lifetime, so the client
+		// reads into owned buffers rather than pooled frames.
+		frame, err := fr.ReadOwnedFrame()
+		if err != nil {
+			c.fail(err)
+			_ = c.conn.Close()
+			return
+		}
+		// Frames are length-prefixed, so a bad envelope only costs the
+		// stream it belongs to. One that cannot be decoded names no stream
+		// and is dropped.
+		env, err := core.DecodeEnvelopeE1Aliased(frame, c.limits)
+		if err != nil {
+			continue
+		}
+		maxPayload := c.limits.MaxPayloadBytes
+		if env.Flags&core.FlagFragment != 0 {
+			now := time.Now()
+			for _, msgID := range ra.Expire(now) {
+				c.failStream(msgID, errReassemblyTimeout)
+			}
+			whole, complete, err := ra.Add(env, now)
+			if err != nil {
+				c.failStream(env.MsgID, err)
+				continue
+			}
+			if !complete {
+				continue
+			}
+			env = whole
+			maxPayload = c.reassembly.MaxMessageBytes
+		}
+		if env, err = core.DecompressPayload(env, maxPayload); err != nil {
+			c.failStream(env.MsgID, err)
+			continue
+		}
+		offered, _ := core.AcceptedCodecs(env)
+
+		c.mu.Lock()
+		if offered != nil {
+			c.peerCodecs = offered
+		}
+		st := c.pending[string(env.MsgID)]
+		c.mu.Unlock()
+		if st == nil {
+			if core.IsGoawayEnvelope(env) {
+				c.mu.Lock()
+				c.goingAway = true
+				c.mu.Unlock()
+			}
+			if core.IsErrorEnvelope(env) {
+				if rerr, ok := remoteError(env).(*RemoteError); ok && rerr.Fatal {
+					c.fail(rerr)
+					_ = c.conn.Close()
+					return
+				}
+			}
+			if c.unsolicited != nil {
+				c.unsolicited(env)
+			}
+			continue
+		}
+		if !st.push(env) {
+			c.failStream(env.MsgID, ErrStreamOverflow)
+		}
+	}
+}
+
+// failStream ends the stream waiting on msgID, if any, with err. The
+// connection and other streams are unaffected.
+func (c *Client) failStream(msgID []byte, err error) {
+	c.mu.Lock()
+	st := c.pending[string(msgID)]
+	if st != nil {
+		delete(c.pending, st.key)
+	}
+	c.mu.Unlock()
+	if st != nil {
+		st.fail(err)
+	}
+}
+
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.err = err
+	c.pending = make(map[string]*Stream)
+	close(c.done)
+}
+
+func (c *Client) release(st *Stream) {
+	c.mu.Lock()
+	if c.pending[st.key] == st {
+		delete(c.pending, st.key)
+	}
+	c.mu.Unlock()
+}
+
+type Stream struct {
+	MsgID []byte
+
+	c        *Client
+	key      string
+	maxBytes int
+
+	mu     sync.Mutex
+	queue  []Envelope
+	queued int
+	err    error
+	// ready holds a wakeup for Recv once the queue grows or the stream
+	// fails.
+	ready chan struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// push queues env for Recv. It reports false if the unread envelopes would
+// exceed the stream buffer.
+func (s *Stream) push(env Envelope) bool {
+	n := core.EncodedLenE1(env)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) > 0 && s.queued+n > s.maxBytes {
+		return false
+	}
+	s.queue = append(s.queue, env)
+	s.queued += n
+	s.wake()
+	return true
+}
+
+func (s *Stream) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.wake()
+}
+
+func (s *Stream) wake() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pop takes the next queued envelope, or reports why the stream failed.
+func (s *Stream) pop() (Envelope, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) == 0 {
+		return Envelope{}, false, s.err
+	}
+	env := s.queue[0]
+	s.queue[0] = Envelope{}
+	s.queue = s.queue[1:]
+	s.queued -= core.EncodedLenE1(env)
+	return env, true, nil
+}
+
+// Recv returns the next envelope for the stream. Envelopes already
+// received are drained before a connection or stream error is reported, and
+// core error envelopes are returned as *RemoteError.
+func (s *Stream) Recv(ctx context.Context) (Envelope, error) {
+	for {
+		env, ok, err := s.pop()
+		if ok {
+			return s.deliver(env)
+		}
+		if err != nil {
+			return Envelope{}, err
+		}
+		select {
+		case <-s.ready:
+		case <-s.closed:
+			return Envelope{}, ErrStreamClosed
+		case <-s.c.done:
+			if env, ok, _ := s.pop(); ok {
+				return s.deliver(env)
+			}
+			return Envelope{}, s.c.Err()
+		case <-ctx.Done():
+			return Envelope{}, ctx.Err()
+		}
+	}
+}
+
+func (s *Stream) deliver(env Envelope) (Envelope, error) {
+	if core.IsErrorEnvelope(env) {
+		return Envelope{}, remoteError(env)
+	}
+	return env, nil
+}
+
+func (s *Stream) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.c.release(s)
+	})
+}
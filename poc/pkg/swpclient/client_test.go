@@ -0,0 +1,379 @@
+package swpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+	"swp-spec-kit/poc/internal/p1rpc"
+	"swp-spec-kit/poc/internal/server"
+)
+
+func startServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := server.New(log.New(io.Discard, "", 0))
+	go func() { _ = s.Serve(ctx, ln) }()
+	t.Cleanup(func() {
+		cancel()
+		_ = ln.Close()
+	})
+	return ln.Addr().String()
+}
+
+func rpcRequest(t *testing.T, rpcID, method string, params any) Envelope {
+	t.Helper()
+	raw, _ := json.Marshal(params)
+	payload, err := p1rpc.EncodePayloadReq(p1rpc.RpcReq{
+		RPCID:  []byte(rpcID),
+		Method: method,
+		Params: raw,
+	})
+	if err != nil {
+		t.Fatalf("encode rpc request: %v", err)
+	}
+	return Envelope{ProfileID: server.ProfileSWPRPC, MsgType: 1, Payload: payload}
+}
+
+func TestClientConcurrentCalls(t *testing.T) {
+	addr := startServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := Dial(ctx, "tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rpcID := fmt.Sprintf("rpc-%d", i)
+			resp, err := c.Call(ctx, rpcRequest(t, rpcID, "demo.echo", map[string]any{"i": i}))
+			if err != nil {
+				errs <- err
+				return
+			}
+			out, err := p1rpc.DecodePayloadResp(resp.Payload)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if string(out.RPCID) != rpcID {
+				errs <- fmt.Errorf("rpc_id mismatch: got %q want %q", out.RPCID, rpcID)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("call failed: %v", err)
+	}
+}
+
+func TestClientStream(t *testing.T) {
+	addr := startServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := Dial(ctx, "tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+
+	// More envelopes than any fixed queue depth arrive before the stream is
+	// read, and other calls still get through meanwhile.
+	st, err := c.Stream(ctx, rpcRequest(t, "rpc-stream", "demo.stream.count", map[string]any{"count": 100}))
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer st.Close()
+	time.Sleep(50 * time.Millisecond)
+	if _, err := c.Call(ctx, rpcRequest(t, "rpc-during-stream", "demo.echo", nil)); err != nil {
+		t.Fatalf("call while stream is unread: %v", err)
+	}
+
+	var items int
+	for {
+		env, err := st.Recv(ctx)
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		if env.MsgType == 4 {
+			items++
+			continue
+		}
+		if env.MsgType != 2 {
+			t.Fatalf("unexpected msg_type %d", env.MsgType)
+		}
+		break
+	}
+	if items != 100 {
+		t.Fatalf("expected 100 stream items, got %d", items)
+	}
+}
+
+func TestClientCallContextCancel(t *testing.T) {
+	client, peer := net.Pipe()
+	defer peer.Close()
+	go func() { _, _ = io.Copy(io.Discard, peer) }()
+
+	c := New(client)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.Call(ctx, Envelope{ProfileID: server.ProfileSWPRPC, MsgType: 1})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	c.mu.Lock()
+	n := len(c.pending)
+	c.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("expected no pending calls after cancel, got %d", n)
+	}
+}
+
+func TestClientFailsPendingOnClose(t *testing.T) {
+	client, peer := net.Pipe()
+	go func() { _, _ = io.Copy(io.Discard, peer) }()
+
+	c := New(client)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	st, err := c.Stream(ctx, Envelope{ProfileID: server.ProfileSWPRPC, MsgType: 1})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	_ = peer.Close()
+	if _, err := st.Recv(ctx); err == nil {
+		t.Fatalf("expected error after peer close")
+	}
+	select {
+	case <-c.Done():
+	default:
+		t.Fatalf("expected client to be done")
+	}
+}
+
+func TestClientGoawayRefusesNewRequests(t *testing.T) {
+	client, peer := net.Pipe()
+	defer peer.Close()
+	go func() { _, _ = io.Copy(io.Discard, peer) }()
+
+	got := make(chan Envelope, 1)
+	c := New(client, WithUnsolicited(func(env Envelope) { got <- env }))
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	body, err := core.EncodeEnvelopeE1(core.NewGoawayEnvelope([]byte("goaway-00000001"), 1, core.Goaway{Reason: "server shutting down"}))
+	if err != nil {
+		t.Fatalf("encode goaway: %v", err)
+	}
+	go func() { _ = core.WriteFrame(peer, body, core.DefaultMaxFrameBytes) }()
+	select {
+	case env := <-got:
+		if !core.IsGoawayEnvelope(env) {
+			t.Fatalf("expected GOAWAY, got profile=%d msg_type=%d", env.ProfileID, env.MsgType)
+		}
+	case <-ctx.Done():
+		t.Fatalf("timed out waiting for GOAWAY")
+	}
+	if _, err := c.Stream(ctx, rpcRequest(t, "rpc-after-goaway", "demo.echo", nil)); !errors.Is(err, ErrGoingAway) {
+		t.Fatalf("expected ErrGoingAway, got %v", err)
+	}
+}
+
+func TestClientStreamFailuresKeepConnection(t *testing.T) {
+	client, peer := net.Pipe()
+	defer peer.Close()
+	go func() { _, _ = io.Copy(io.Discard, peer) }()
+
+	c := New(client, WithStreamBuffer(1))
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	open := func(msgID string) *Stream {
+		t.Helper()
+		st, err := c.Stream(ctx, Envelope{ProfileID: server.ProfileSWPRPC, MsgType: 1, MsgID: []byte(msgID)})
+		if err != nil {
+			t.Fatalf("stream: %v", err)
+		}
+		return st
+	}
+	slow, corrupt, ok := open("msg-slow-0000001"), open("msg-bad-00000001"), open("msg-ok-000000001")
+	reply := func(msgID string) []byte {
+		body, err := core.EncodeEnvelopeE1(Envelope{Version: CoreVersion, ProfileID: server.ProfileSWPRPC, MsgType: 2, MsgID: []byte(msgID), Payload: []byte("x")})
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		return body
+	}
+	badCodec, err := core.EncodeEnvelopeE1(Envelope{Version: CoreVersion, ProfileID: server.ProfileSWPRPC, MsgType: 2, Flags: core.FlagPayloadCompressed, MsgID: []byte("msg-bad-00000001"), Payload: []byte("x")})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	// The slow stream overflows, an undecodable frame is dropped and a
+	// payload that cannot be decompressed fails its own stream only.
+	go func() {
+		for _, body := range [][]byte{reply("msg-slow-0000001"), reply("msg-slow-0000001"), {0xff}, badCodec, reply("msg-ok-000000001")} {
+			_ = core.WriteFrame(peer, body, core.DefaultMaxFrameBytes)
+		}
+	}()
+	if env, err := ok.Recv(ctx); err != nil || string(env.Payload) != "x" {
+		t.Fatalf("expected reply on healthy stream, got %q (%v)", env.Payload, err)
+	}
+	if _, err := slow.Recv(ctx); err != nil {
+		t.Fatalf("expected buffered reply before overflow, got %v", err)
+	}
+	if _, err := slow.Recv(ctx); !errors.Is(err, ErrStreamOverflow) {
+		t.Fatalf("expected ErrStreamOverflow, got %v", err)
+	}
+	if _, err := corrupt.Recv(ctx); core.CodeFromError(err) != core.CodeInvalidEnvelope {
+		t.Fatalf("expected INVALID_ENVELOPE on corrupt stream, got %v", err)
+	}
+	if err := c.Err(); err != nil {
+		t.Fatalf("expected connection to stay open, got %v", err)
+	}
+}
+
+func TestClientRemoteErrorKeepsConnection(t *testing.T) {
+	addr := startServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := Dial(ctx, "tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+
+	_, err = c.Call(ctx, Envelope{ProfileID: 99, MsgType: 1})
+	var rerr *RemoteError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected RemoteError, got %v", err)
+	}
+	if rerr.Code != "ERR_UNKNOWN_PROFILE" || rerr.Fatal {
+		t.Fatalf("unexpected remote error: %+v", rerr)
+	}
+
+	if _, err := c.Call(ctx, rpcRequest(t, "rpc-after-error", "demo.echo", nil)); err != nil {
+		t.Fatalf("call after recoverable error: %v", err)
+	}
+}
+
+func TestClientSendBatch(t *testing.T) {
+	addr := startServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	got := make(chan Envelope, 8)
+	c, err := Dial(ctx, "tcp", addr, WithUnsolicited(func(env Envelope) { got <- env }))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+
+	envs := make([]Envelope, 4)
+	for i := range envs {
+		envs[i] = rpcRequest(t, fmt.Sprintf("rpc-batch-%d", i), "demo.echo", map[string]any{"i": i})
+	}
+	if err := c.SendBatch(ctx, envs...); err != nil {
+		t.Fatalf("send batch: %v", err)
+	}
+	for i := range envs {
+		select {
+		case env := <-got:
+			if env.MsgType != 2 {
+				t.Fatalf("response %d: expected msg_type 2, got %d", i, env.MsgType)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out after %d responses", i)
+		}
+	}
+}
+
+func TestClientCompression(t *testing.T) {
+	addr := startServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := Dial(ctx, "tcp", addr, WithCompression(CodecGzip, 64))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+
+	data := strings.Repeat("payload ", 512)
+	for i := 0; i < 2; i++ {
+		resp, err := c.Call(ctx, rpcRequest(t, fmt.Sprintf("rpc-gz-%d", i), "demo.echo", map[string]any{"data": data}))
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		out, err := p1rpc.DecodePayloadResp(resp.Payload)
+		if err != nil {
+			t.Fatalf("call %d: decode response: %v", i, err)
+		}
+		var echoed map[string]string
+		if err := json.Unmarshal(out.Result, &echoed); err != nil || echoed["data"] != data {
+			t.Fatalf("call %d: echo mismatch: %v", i, err)
+		}
+	}
+	if !c.peerAccepts(CodecGzip) {
+		t.Fatalf("expected client to learn server codecs")
+	}
+}
+
+func TestClientHandshake(t *testing.T) {
+	addr := startServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := Dial(ctx, "tcp", addr, WithHello(ProfileVersion{ProfileID: server.ProfileSWPRPC, Version: 1}))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+
+	n, ok := c.Negotiated()
+	if !ok || n.Version != CoreVersion || !n.HasProfile(server.ProfileSWPRPC) {
+		t.Fatalf("unexpected negotiation: %+v ok=%v", n, ok)
+	}
+	if _, err := c.Call(ctx, rpcRequest(t, "rpc-hello", "demo.echo", map[string]any{"ok": true})); err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if _, err := c.Call(ctx, Envelope{ProfileID: server.ProfileMCPMap, MsgType: 1, Payload: []byte(`{}`)}); !errors.Is(err, ErrProfileNotNegotiated) {
+		t.Fatalf("expected ErrProfileNotNegotiated, got %v", err)
+	}
+
+	big := Envelope{ProfileID: server.ProfileSWPRPC, MsgType: 1, Payload: make([]byte, n.PeerMaxPayloadBytes+1)}
+	if err := c.Send(ctx, big); core.CodeFromError(err) != core.CodeInvalidEnvelope {
+		t.Fatalf("expected payload over the server's limit to be refused, got %v", err)
+	}
+	if _, err := c.Call(ctx, rpcRequest(t, "rpc-hello-2", "demo.echo", map[string]any{"ok": true})); err != nil {
+		t.Fatalf("call after refused send: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package swpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentType is the media type of an HTTP/2 stream carrying SWP frames.
+const ContentType = "application/swp"
+
+// DialHTTP2 opens one HTTP/2 stream to rawURL and runs the client over it
+// (docs/transport-binding-h2.md). https URLs use TLS with cfg, which may be
+// nil; http URLs use h2c with prior knowledge. Each call opens its own
+// HTTP/2 connection.
+func DialHTTP2(ctx context.Context, rawURL string, cfg *tls.Config, opts ...Option) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	t := &http.Transport{TLSClientConfig: cfg, Protocols: new(http.Protocols)}
+	switch u.Scheme {
+	case "https":
+		t.Protocols.SetHTTP2(true)
+	case "http":
+		t.Protocols.SetUnencryptedHTTP2(true)
+	default:
+		return nil, fmt.Errorf("dial: unsupported scheme %q", u.Scheme)
+	}
+
+	conn := &streamConn{transport: t}
+	streamCtx, cancel := context.WithCancel(context.Background())
+	conn.cancel = cancel
+	streamCtx = httptrace.WithClientTrace(streamCtx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			conn.local, conn.remote = info.Conn.LocalAddr(), info.Conn.RemoteAddr()
+		},
+	})
+	pr, pw := io.Pipe()
+	conn.pw = pw
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodPost, u.String(), pr)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	req.Header.Set("Content-Type", ContentType)
+
+	// ctx bounds opening the stream, not its lifetime.
+	stop := context.AfterFunc(ctx, cancel)
+	resp, err := t.RoundTrip(req)
+	stop()
+	if err != nil {
+		cancel()
+		t.CloseIdleConnections()
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), ContentType) {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		_ = resp.Body.Close()
+		cancel()
+		t.CloseIdleConnections()
+		return nil, fmt.Errorf("dial: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	conn.body = resp.Body
+	return start(ctx, conn, opts...)
+}
+
+// streamConn presents a client HTTP/2 stream as a net.Conn. A deadline
+// that passes ends the stream.
+type streamConn struct {
+	pw        *io.PipeWriter
+	body      io.ReadCloser
+	cancel    context.CancelFunc
+	transport *http.Transport
+	local     net.Addr
+	remote    net.Addr
+
+	mu         sync.Mutex
+	readTimer  *time.Timer
+	writeTimer *time.Timer
+	closeOnce  sync.Once
+}
+
+func (c *streamConn) Read(p []byte) (int, error)  { return c.body.Read(p) }
+func (c *streamConn) Write(p []byte) (int, error) { return c.pw.Write(p) }
+
+func (c *streamConn) Close() error {
+	c.closeOnce.Do(func() {
+		_ = c.pw.Close()
+		_ = c.body.Close()
+		c.cancel()
+		c.transport.CloseIdleConnections()
+	})
+	return nil
+}
+
+func (c *streamConn) LocalAddr() net.Addr  { return c.local }
+func (c *streamConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *streamConn) SetDeadline(t time.Time) error {
+	_ = c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *streamConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readTimer = resetDeadline(c.readTimer, t, c.cancel)
+	return nil
+}
+
+func (c *streamConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeTimer = resetDeadline(c.writeTimer, t, func() { _ = c.pw.CloseWithError(os.ErrDeadlineExceeded) })
+	return nil
+}
+
+// resetDeadline stops timer and, for a non-zero t, starts one running
+// expire at t.
+func resetDeadline(timer *time.Timer, t time.Time, expire func()) *time.Timer {
+	if timer != nil {
+		timer.Stop()
+	}
+	if t.IsZero() {
+		return nil
+	}
+	return time.AfterFunc(time.Until(t), expire)
+}
@@ -0,0 +1,60 @@
+package swpclient
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"swp-spec-kit/poc/internal/server"
+)
+
+func TestDialHTTP2(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := server.New(log.New(io.Discard, "", 0))
+	go func() { _ = s.ServeHTTP2(context.Background(), ln, nil) }()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := DialHTTP2(ctx, "http://"+ln.Addr().String()+"/swp", nil, WithHello(ProfileVersion{ProfileID: server.ProfileSWPRPC, Version: 1}))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+	if _, ok := c.Negotiated(); !ok {
+		t.Fatalf("expected HELLO over the stream")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := c.Call(ctx, rpcRequest(t, "rpc-h2-"+strings.Repeat("x", i), "demo.echo", map[string]any{"i": i}))
+			if err == nil && resp.MsgType != 2 {
+				err = io.ErrUnexpectedEOF
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("call: %v", err)
+		}
+	}
+
+	if _, err := DialHTTP2(ctx, "ftp://"+ln.Addr().String(), nil); err == nil {
+		t.Fatalf("expected unsupported scheme error")
+	}
+}
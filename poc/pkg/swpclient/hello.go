@@ -0,0 +1,82 @@
+package swpclient
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"swp-spec-kit/poc/internal/core"
+)
+
+type Hello = core.Hello
+type ProfileVersion = core.ProfileVersion
+type Negotiated = core.Negotiated
+
+var ErrProfileNotNegotiated = errors.New("swpclient: profile not negotiated")
+
+// WithHello makes Dial perform a HELLO handshake advertising profiles before
+// returning the client.
+func WithHello(profiles ...ProfileVersion) Option {
+	return func(c *Client) {
+		c.helloProfiles = profiles
+		c.helloOnDial = true
+	}
+}
+
+// Handshake exchanges core HELLO envelopes with the server. It must be the
+// first envelope sent on the connection. Afterwards the client rejects
+// envelopes for profiles the server did not accept and keeps outbound frames
+// and payloads within the server's advertised limits.
+func (c *Client) Handshake(ctx context.Context, profiles ...ProfileVersion) (Negotiated, error) {
+	local := core.NewHello(c.limits, profiles...)
+	id, err := c.NewMsgID()
+	if err != nil {
+		return Negotiated{}, err
+	}
+	resp, err := c.Call(ctx, core.NewHelloEnvelope(id, uint64(time.Now().UnixMilli()), local))
+	if err != nil {
+		return Negotiated{}, err
+	}
+	if !core.IsHelloEnvelope(resp) {
+		return Negotiated{}, core.Wrap(core.CodeInvalidEnvelope, errors.New("swpclient: expected hello response"))
+	}
+	remote, err := core.DecodeHelloPayload(resp.Payload)
+	if err != nil {
+		return Negotiated{}, err
+	}
+	n, err := core.Negotiate(local, remote)
+	if err != nil {
+		return Negotiated{}, err
+	}
+
+	c.mu.Lock()
+	c.negotiated = &n
+	c.mu.Unlock()
+	return n, nil
+}
+
+// Negotiated returns the HELLO outcome, if a handshake completed.
+func (c *Client) Negotiated() (Negotiated, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.negotiated == nil {
+		return Negotiated{}, false
+	}
+	return *c.negotiated, true
+}
+
+// outboundLimits returns the frame and payload limits for writes and
+// whether oversized envelopes may be fragmented.
+func (c *Client) outboundLimits() (maxFrame, maxPayload uint32, fragment bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	maxFrame = c.limits.MaxFrameBytes
+	if c.negotiated == nil {
+		return maxFrame, math.MaxUint32, true
+	}
+	if c.negotiated.PeerMaxFrameBytes < maxFrame {
+		maxFrame = c.negotiated.PeerMaxFrameBytes
+	}
+	return maxFrame, c.negotiated.PeerMaxPayloadBytes, c.negotiated.HasFeature(core.FeatureFragment)
+}
@@ -0,0 +1,58 @@
+package swpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+
+	"swp-spec-kit/poc/internal/pipeconn"
+)
+
+// Open runs the client over rwc, for example a pipe to a local process.
+// Deadlines apply only if rwc supports them.
+func Open(ctx context.Context, rwc io.ReadWriteCloser, opts ...Option) (*Client, error) {
+	return start(ctx, pipeconn.New(rwc, "pipe"), opts...)
+}
+
+// DialCommand starts cmd, a server speaking SWP on its stdin and stdout such
+// as "swp-server -stdio", and runs the client over its pipes. Closing the
+// client closes stdin and waits for cmd to exit.
+func DialCommand(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Client, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	return Open(ctx, pipeconn.Join(&commandOutput{ReadCloser: stdout, cmd: cmd}, stdin), opts...)
+}
+
+// commandOutput waits for the command once its output is closed. Exit
+// status is ignored: the server may exit however it likes after stdin
+// closes.
+type commandOutput struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+
+	once sync.Once
+	err  error
+}
+
+func (o *commandOutput) Close() error {
+	o.once.Do(func() {
+		o.err = o.ReadCloser.Close()
+		var exitErr *exec.ExitError
+		if err := o.cmd.Wait(); err != nil && !errors.As(err, &exitErr) {
+			o.err = errors.Join(o.err, err)
+		}
+	})
+	return o.err
+}
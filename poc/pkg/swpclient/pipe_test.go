@@ -0,0 +1,40 @@
+package swpclient
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"swp-spec-kit/poc/internal/pipeconn"
+	"swp-spec-kit/poc/internal/server"
+)
+
+func TestOpenPipe(t *testing.T) {
+	s := server.New(log.New(io.Discard, "", 0))
+	toServer, fromClient := io.Pipe()
+	fromServer, toClient := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.ServeConn(context.Background(), pipeconn.Join(toServer, toClient))
+		close(done)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := Open(ctx, pipeconn.Join(fromServer, fromClient), WithHello(ProfileVersion{ProfileID: server.ProfileSWPRPC, Version: 1}))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	resp, err := c.Call(ctx, rpcRequest(t, "rpc-pipe", "demo.echo", map[string]any{"ok": true}))
+	if err != nil || resp.MsgType != 2 {
+		t.Fatalf("call: %+v (%v)", resp, err)
+	}
+	_ = c.Close()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatalf("server session did not end after the client closed")
+	}
+}
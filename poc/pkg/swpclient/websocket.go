@@ -0,0 +1,24 @@
+package swpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+
+	"swp-spec-kit/poc/internal/websocket"
+)
+
+// WebSocketSubprotocol is the Sec-WebSocket-Protocol offered when dialing.
+const WebSocketSubprotocol = "swp"
+
+// DialWebSocket opens a WebSocket connection to rawURL and runs the client
+// over it, sending each envelope as one binary message. wss URLs use TLS
+// with cfg, which may be nil; ws URLs are plaintext. Frame size limits are
+// enforced as on TCP once a message has been received.
+func DialWebSocket(ctx context.Context, rawURL string, cfg *tls.Config, opts ...Option) (*Client, error) {
+	ws, err := websocket.Dial(ctx, rawURL, cfg, WebSocketSubprotocol)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	return start(ctx, websocket.NewFrameConn(ws, 0), opts...)
+}
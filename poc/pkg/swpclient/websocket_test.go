@@ -0,0 +1,46 @@
+package swpclient
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"swp-spec-kit/poc/internal/server"
+)
+
+func TestDialWebSocket(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := server.New(log.New(io.Discard, "", 0))
+	go func() { _ = s.ServeWebSocket(context.Background(), ln, nil) }()
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := DialWebSocket(ctx, "ws://"+ln.Addr().String()+"/swp", nil, WithHello(ProfileVersion{ProfileID: server.ProfileSWPRPC, Version: 1}))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+	if _, ok := c.Negotiated(); !ok {
+		t.Fatalf("expected HELLO over the WebSocket")
+	}
+	for i := 0; i < 4; i++ {
+		resp, err := c.Call(ctx, rpcRequest(t, "rpc-ws-"+string(rune('a'+i)), "demo.echo", map[string]any{"i": i}))
+		if err != nil {
+			t.Fatalf("call: %v", err)
+		}
+		if resp.MsgType != 2 {
+			t.Fatalf("expected RPC response, got msg_type %d", resp.MsgType)
+		}
+	}
+
+	if _, err := DialWebSocket(ctx, "http://"+ln.Addr().String(), nil); err == nil {
+		t.Fatalf("expected unsupported scheme error")
+	}
+}